@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/pigeonsec/magpie/pkg/magpie"
+)
+
+// writeAppended merges domains into the existing output at path and rewrites it as the
+// deduplicated union in -sort order (alpha for none); a missing file is treated as empty. Output written by
+// -append is in order, so the old file is normally streamed and only the new domains are
+// held in memory. An unsorted file (say from a run without -append) is loaded and sorted
+// once instead. Formats with a header (rpz) need the whole union for it and collect it
+// first. Returns the number of domains in the rewritten file.
+func writeAppended(path string, domains []string) (int, error) {
+	format := outputFormats[outputFormat]
+	compare := magpie.DomainCompare(sortOrder)
+
+	added := append([]string(nil), domains...)
+	slices.SortFunc(added, compare)
+
+	old, closeOld, err := openSortedOutput(path, format.parse, compare)
+	if err != nil {
+		return 0, err
+	}
+	defer closeOld()
+
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	writer := bufio.NewWriterSize(file, 256*1024)
+
+	// fail drops the partial file, leaving the old output in place
+	fail := func(err error) (int, error) {
+		file.Close()
+		os.Remove(tmp)
+		return 0, err
+	}
+
+	var union []string
+	emit := func(domain string) { fmt.Fprintln(writer, format.line(domain)) }
+	if format.header != nil {
+		emit = func(domain string) { union = append(union, domain) }
+	}
+
+	written, err := mergeSorted(old, added, compare, emit)
+	if err != nil {
+		return fail(err)
+	}
+
+	if format.header != nil {
+		header, err := format.header(union)
+		if err != nil {
+			return fail(err)
+		}
+		for _, line := range header {
+			fmt.Fprintln(writer, line)
+		}
+		for _, domain := range union {
+			fmt.Fprintln(writer, format.line(domain))
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return fail(err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	return written, os.Rename(tmp, path)
+}
+
+// appendNote summarizes an -append merge for the results
+func appendNote(domains, written int) string {
+	return fmt.Sprintf("Append: %s domains merged into %s, which now holds %s", formatSize(domains), outputFile, formatSize(written))
+}
+
+// mergeSorted emits the union of two sorted sequences in order, each domain once, and
+// returns how many were emitted. next returns false once the old sequence is exhausted.
+func mergeSorted(next func() (string, bool, error), added []string, compare func(a, b string) int, emit func(string)) (int, error) {
+	written := 0
+	last := ""
+	put := func(domain string) {
+		if written > 0 && domain == last {
+			return
+		}
+		emit(domain)
+		last = domain
+		written++
+	}
+
+	oldDomain, ok, err := next()
+	if err != nil {
+		return 0, err
+	}
+	i := 0
+	for ok || i < len(added) {
+		if ok && (i == len(added) || compare(oldDomain, added[i]) <= 0) {
+			put(oldDomain)
+			if oldDomain, ok, err = next(); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		put(added[i])
+		i++
+	}
+	return written, nil
+}
+
+// openSortedOutput returns the domains of the output at path in compare order, read one at
+// a time. It streams the file when it is already in order and sorts it in memory otherwise.
+func openSortedOutput(path string, parse func(string) (string, bool), compare func(a, b string) int) (func() (string, bool, error), func(), error) {
+	sorted, err := outputIsSorted(path, parse, compare)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return func() (string, bool, error) { return "", false, nil }, func() {}, nil
+		}
+		return nil, nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	scanner := bufio.NewScanner(file)
+
+	if !sorted {
+		var domains []string
+		for scanner.Scan() {
+			if domain, ok := parse(scanner.Text()); ok {
+				domains = append(domains, domain)
+			}
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, nil, err
+		}
+		slices.SortFunc(domains, compare)
+		return func() (string, bool, error) {
+			if len(domains) == 0 {
+				return "", false, nil
+			}
+			domain := domains[0]
+			domains = domains[1:]
+			return domain, true, nil
+		}, func() {}, nil
+	}
+
+	next := func() (string, bool, error) {
+		for scanner.Scan() {
+			if domain, ok := parse(scanner.Text()); ok {
+				return domain, true, nil
+			}
+		}
+		return "", false, scanner.Err()
+	}
+	return next, func() { file.Close() }, nil
+}
+
+// outputIsSorted reports whether the domains in the output at path are in compare order
+func outputIsSorted(path string, parse func(string) (string, bool), compare func(a, b string) int) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	prev := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		domain, ok := parse(scanner.Text())
+		if !ok {
+			continue
+		}
+		if prev != "" && compare(domain, prev) < 0 {
+			return false, nil
+		}
+		prev = domain
+	}
+	return true, scanner.Err()
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// bucketKeys lists every bucket name for the configured -bucket-by mode. All buckets
+// are written on every run, even empty ones, so a bucket that empties out doesn't
+// leave a stale file behind.
+func bucketKeys() ([]string, error) {
+	switch bucketBy {
+	case "letter":
+		keys := make([]string, 0, 36)
+		for c := 'a'; c <= 'z'; c++ {
+			keys = append(keys, string(c))
+		}
+		for c := '0'; c <= '9'; c++ {
+			keys = append(keys, string(c))
+		}
+		return keys, nil
+	case "hash":
+		if bucketCount <= 0 {
+			return nil, fmt.Errorf("-buckets must be positive, got %d", bucketCount)
+		}
+		keys := make([]string, bucketCount)
+		width := len(fmt.Sprint(bucketCount - 1))
+		for i := range keys {
+			keys[i] = fmt.Sprintf("%0*d", width, i)
+		}
+		return keys, nil
+	default:
+		return nil, fmt.Errorf("unknown -bucket-by mode %q (use letter or hash)", bucketBy)
+	}
+}
+
+// bucketKey returns the bucket a domain belongs to. It depends only on the domain,
+// so a domain stays in the same file across runs.
+func bucketKey(domain string, keys []string) string {
+	if bucketBy == "letter" {
+		// Validated domains always start with a-z or 0-9
+		return domain[:1]
+	}
+	h := fnv.New32a()
+	h.Write([]byte(domain))
+	return keys[h.Sum32()%uint32(len(keys))]
+}
+
+// bucketPath names a bucket file after the output file, e.g. blocklist.txt -> blocklist.a.txt
+func bucketPath(key string) string {
+	ext := filepath.Ext(outputFile)
+	return strings.TrimSuffix(outputFile, ext) + "." + key + ext
+}
+
+// writeBuckets writes the domains split into deterministic buckets, each sorted
+func writeBuckets(validDomains []string) (string, error) {
+	keys, err := bucketKeys()
+	if err != nil {
+		return "", err
+	}
+
+	buckets := make(map[string][]string, len(keys))
+	for _, domain := range validDomains {
+		key := bucketKey(domain, keys)
+		buckets[key] = append(buckets[key], domain)
+	}
+
+	for _, key := range keys {
+		domains := buckets[key]
+		sort.Strings(domains)
+		if err := writeOutput(bucketPath(key), domains, nil); err != nil {
+			return "", err
+		}
+		recordGenerated("bucket", bucketPath(key), outputFormat, key, len(domains))
+	}
+
+	return fmt.Sprintf("Buckets: %d files by %s (%s ... %s)", len(keys), bucketBy, bucketPath(keys[0]), bucketPath(keys[len(keys)-1])), nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// loadConfigFile applies the settings of a -config file, YAML (.yaml, .yml) or TOML
+// (.toml), to the flags. Every top-level key is a flag name without the dash, as in
+// "data-dir" or "data_dir", and its value a string, number, boolean or list. A list is
+// one value per entry for a repeatable flag (-header, -include, ...) and is joined with
+// commas for the others (-resolvers). The values go through the same parsing as on the
+// command line, and a flag given there, under any of its names, keeps its value.
+func loadConfigFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	settings := make(map[string]interface{})
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &settings)
+	case ".toml":
+		_, err = toml.Decode(string(data), &settings)
+	default:
+		return fmt.Errorf("unknown config format %q (use .yaml, .yml or .toml)", ext)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	// Flags from the command line, by the variable they set so a shorthand counts too
+	fromCLI := make(map[interface{}]bool)
+	flag.Visit(func(f *flag.Flag) {
+		fromCLI[flagTarget(f)] = true
+	})
+
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		name := strings.ReplaceAll(strings.TrimLeft(key, "-"), "_", "-")
+		f := flag.Lookup(name)
+		if f == nil {
+			return fmt.Errorf("%s: unknown setting %q", path, key)
+		}
+		if name == "config" {
+			return fmt.Errorf("%s: a config file can't load another one", path)
+		}
+		if fromCLI[flagTarget(f)] {
+			continue
+		}
+
+		values, err := configValues(settings[key])
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", path, key, err)
+		}
+		if !repeatableFlag(f) {
+			values = []string{strings.Join(values, ",")}
+		}
+		for _, value := range values {
+			if err := flag.Set(name, value); err != nil {
+				return fmt.Errorf("%s: invalid %s %q: %w", path, key, value, err)
+			}
+		}
+	}
+	return nil
+}
+
+// configValues turns a config value into flag values: one for a scalar, one per entry
+// for a list
+func configValues(value interface{}) ([]string, error) {
+	list, ok := value.([]interface{})
+	if !ok {
+		list = []interface{}{value}
+	}
+
+	values := make([]string, 0, len(list))
+	for _, entry := range list {
+		switch v := entry.(type) {
+		case string:
+			values = append(values, v)
+		case bool:
+			values = append(values, strconv.FormatBool(v))
+		case int:
+			values = append(values, strconv.Itoa(v))
+		case int64:
+			values = append(values, strconv.FormatInt(v, 10))
+		case float64:
+			values = append(values, strconv.FormatFloat(v, 'g', -1, 64))
+		default:
+			return nil, fmt.Errorf("expected a string, number, boolean or list of them, got %T", entry)
+		}
+	}
+	return values, nil
+}
+
+// repeatableFlag reports whether a flag collects a value per use instead of taking one
+func repeatableFlag(f *flag.Flag) bool {
+	switch f.Value.(type) {
+	case *urlList, headerList, *patternList:
+		return true
+	}
+	return false
+}
+
+// flagTarget identifies the variable a flag sets, which a flag and its shorthand (-s and
+// -source) share
+func flagTarget(f *flag.Flag) interface{} {
+	v := reflect.ValueOf(f.Value)
+	switch {
+	case v.Kind() == reflect.Pointer || v.Kind() == reflect.Map:
+		return v.Pointer()
+	case v.Type().Comparable():
+		return f.Value
+	}
+	return f.Name
+}
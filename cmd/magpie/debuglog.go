@@ -0,0 +1,18 @@
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// debugTraces is where -debug writes the validation traces, nil unless the flag is set
+var debugTraces io.Writer
+
+// openDebugLog opens -log-file, or uses stderr without one
+func openDebugLog(path string) (io.Writer, error) {
+	if path == "" {
+		return os.Stderr, nil
+	}
+	// Left open for the rest of the run; every block is written straight through
+	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pigeonsec/magpie/internal/fetcher"
+)
+
+// dedupeFile is one input of -dedupe-only and what it contributed
+type dedupeFile struct {
+	path      string
+	domains   int // distinct domains parsed from the file
+	new       int // domains not seen in any earlier file
+	exclusive int // domains found in no other file
+}
+
+// runDedupeOnly parses local domain or hosts files, dedupes them and reports the unique
+// count and each file's contribution. No network and no validation. The merged list is
+// written only when -output is given explicitly.
+func runDedupeOnly() {
+	var paths []string
+	for _, path := range strings.Split(dedupeOnly, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		log.Fatalf("-dedupe-only needs at least one file")
+	}
+
+	// How many files list each domain, and the first one that did
+	seenIn := make(map[string]int)
+	firstFile := make(map[string]int)
+	files := make([]*dedupeFile, len(paths))
+
+	for i, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			log.Fatalf("Failed to open %s: %v", path, err)
+		}
+		domains, err := fetcher.ParseBody(context.Background(), file)
+		file.Close()
+		if err != nil {
+			log.Fatalf("Failed to parse %s: %v", path, err)
+		}
+
+		files[i] = &dedupeFile{path: path, domains: len(domains)}
+		for _, domain := range domains {
+			domain, _ = fetcher.SplitSubdomains(domain)
+			if seenIn[domain] == 0 {
+				firstFile[domain] = i
+				files[i].new++
+			}
+			seenIn[domain]++
+		}
+	}
+
+	overlapping := 0
+	for domain, count := range seenIn {
+		if count == 1 {
+			files[firstFile[domain]].exclusive++
+		} else {
+			overlapping++
+		}
+	}
+
+	width := len("File")
+	for _, file := range files {
+		if len(file.path) > width {
+			width = len(file.path)
+		}
+	}
+
+	fmt.Printf("%-*s  %10s  %10s  %10s\n", width, "File", "Domains", "New", "Exclusive")
+	for _, file := range files {
+		fmt.Printf("%-*s  %10d  %10d  %10d\n", width, file.path, file.domains, file.new, file.exclusive)
+	}
+	fmt.Printf("\nUnique domains: %d (%d listed by more than one file)\n", len(seenIn), overlapping)
+
+	if !outputFlagSet() {
+		return
+	}
+
+	merged := make([]string, 0, len(seenIn))
+	for domain := range seenIn {
+		merged = append(merged, domain)
+	}
+	sort.Strings(merged)
+	if err := writeOutput(outputFile, merged, nil); err != nil {
+		log.Fatalf("Failed to write output: %v", err)
+	}
+	fmt.Printf("Merged list written to %s\n", outputFile)
+}
+
+// outputFlagSet reports whether -output or -o was given on the command line or in -config
+func outputFlagSet() bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "output" || f.Name == "o" {
+			set = true
+		}
+	})
+	return set
+}
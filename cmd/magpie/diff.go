@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// writeDiff compares the output file about to be replaced with the new domains and
+// writes <output>.diff with one +domain / -domain line per change and a summary line.
+// The old file is streamed, so only the new list is held in memory. On the first run,
+// with no previous output, every domain is an addition.
+func writeDiff(domains []string) (string, error) {
+	// pending[d] stays true until d is found in the old output
+	pending := make(map[string]bool, len(domains))
+	for _, domain := range domains {
+		pending[domain] = true
+	}
+
+	diffPath := outputFile + ".diff"
+	file, err := os.Create(diffPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	writer := bufio.NewWriterSize(file, 256*1024)
+
+	removed, err := streamRemoved(writer, pending)
+	if err != nil {
+		return "", err
+	}
+
+	var added []string
+	for domain, isNew := range pending {
+		if isNew {
+			added = append(added, domain)
+		}
+	}
+	sort.Strings(added)
+	for _, domain := range added {
+		fmt.Fprintf(writer, "+%s\n", domain)
+	}
+
+	fmt.Fprintf(writer, "# %d added, %d removed\n", len(added), removed)
+	if err := writer.Flush(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Diff: +%s / -%s domains written to %s", formatSize(len(added)), formatSize(removed), diffPath), nil
+}
+
+// streamRemoved writes a -domain line for every domain of the previous output that is
+// missing from pending, marking the others as unchanged. A missing file means no removals.
+func streamRemoved(writer *bufio.Writer, pending map[string]bool) (int, error) {
+	old, err := openOutput(outputFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer old.Close()
+
+	parse := outputFormats[outputFormat].parse
+	removed := 0
+	scanner := bufio.NewScanner(old)
+	for scanner.Scan() {
+		domain, ok := parse(scanner.Text())
+		if !ok {
+			continue
+		}
+		// -append keeps every old domain, so nothing is removed
+		if _, listed := pending[domain]; listed || appendOutput {
+			pending[domain] = false
+			continue
+		}
+		fmt.Fprintf(writer, "-%s\n", domain)
+		// Remember it so a domain listed twice in the old file counts once
+		pending[domain] = false
+		removed++
+	}
+	return removed, scanner.Err()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pigeonsec/magpie/internal/stats"
+)
+
+// errorReportEntry is one failed source in the -error-report
+type errorReportEntry struct {
+	URL   string `json:"url"`
+	Error string `json:"error"`
+	// FailureCount is the tracker's consecutive failure count after this run, 0 with -no-tracking
+	FailureCount  int  `json:"failure_count"`
+	TotalFailures int  `json:"total_failures"`
+	Blacklisted   bool `json:"blacklisted"`
+}
+
+// writeErrorReport writes every failed source with its error and tracker counts to path,
+// as JSON for a .json path and CSV otherwise
+func writeErrorReport(path string, failures []sourceFailure, tracker *stats.Tracker) error {
+	entries := make([]errorReportEntry, 0, len(failures))
+	for _, failure := range failures {
+		entry := errorReportEntry{URL: failure.URL, Error: failure.Error}
+		if tracker != nil {
+			if stat := tracker.GetStats(failure.URL); stat != nil {
+				entry.FailureCount = stat.FailureCount
+				entry.TotalFailures = stat.TotalFailures
+				entry.Blacklisted = stat.Blacklisted
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	}
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"url", "error", "failure_count", "total_failures", "blacklisted"})
+	for _, entry := range entries {
+		writer.Write([]string{
+			entry.URL,
+			entry.Error,
+			strconv.Itoa(entry.FailureCount),
+			strconv.Itoa(entry.TotalFailures),
+			strconv.FormatBool(entry.Blacklisted),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
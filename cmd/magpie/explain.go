@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pigeonsec/magpie/internal/fetcher"
+	"github.com/pigeonsec/magpie/pkg/magpie"
+)
+
+// runExplain traces a single domain through the same validation path a run uses,
+// printing every lookup and check, and the final verdict. Sources aren't fetched.
+func runExplain(domain string) {
+	fmt.Printf("Explaining %q\n\n", domain)
+
+	cleaned, ok := fetcher.NormalizeDomain(domain)
+	if !ok {
+		fmt.Println("  cleaned:  (not a valid domain name)")
+		fmt.Println("\nVerdict: dropped while parsing, never validated")
+		os.Exit(1)
+	}
+	fmt.Printf("  cleaned:  %s\n", cleaned)
+	fmt.Printf("  checks:   %s\n\n", explainMethod())
+
+	if !validating() {
+		fmt.Println("Verdict: kept (validation disabled)")
+		return
+	}
+
+	var traceMu sync.Mutex
+	start := time.Now()
+	v := newValidator()
+	v.Trace = func(format string, args ...interface{}) {
+		traceMu.Lock()
+		defer traceMu.Unlock()
+		fmt.Printf("  [%6.0fms] %s\n", float64(time.Since(start).Microseconds())/1000, fmt.Sprintf(format, args...))
+	}
+
+	// One worker, so the trace lines come in the order the checks ran
+	cfg := validationConfig(v)
+	cfg.Workers = 1
+	cfg.RecordInvalid = false
+	cfg.OnSecondPass = func(int) {
+		v.Trace("dns result inconclusive, second pass with a longer timeout")
+	}
+	result, err := magpie.Validate(context.Background(), cfg, []string{cleaned})
+	valid := err == nil && result.Valid > 0
+
+	fmt.Println()
+	switch {
+	case result.DeadTLDSkipped > 0:
+		fmt.Println("  note:     rejected by the dead TLD list (-dead-tlds)")
+	case result.NoMX > 0:
+		fmt.Println("  note:     no MX records (-mx)")
+	case result.DNSTrusted > 0:
+		fmt.Println("  note:     common TLD, DNS trusted without an HTTP check (-http-targeted)")
+	case result.HTTPDeadlineSkipped > 0:
+		fmt.Printf("  note:     HTTP check skipped by -http-deadline, %sed by policy\n", httpDeadlinePolicy)
+	}
+	if err != nil {
+		fmt.Printf("  error:    %v\n", err)
+	}
+
+	if valid {
+		fmt.Println("Verdict: VALID - kept in the output")
+		return
+	}
+	fmt.Println("Verdict: INVALID - dropped from the output")
+	os.Exit(1)
+}
+
+// explainMethod describes which checks the current flags enable
+func explainMethod() string {
+	method := baseExplainMethod()
+	if mxCheck {
+		if method == "none" {
+			return "mx"
+		}
+		method += ", mx required"
+	}
+	if detectWildcard && (enableDNS || enableHTTP) {
+		method += ", wildcard parents dropped"
+	}
+	return method
+}
+
+// baseExplainMethod describes the DNS / HTTP checks in use
+func baseExplainMethod() string {
+	switch {
+	case enableHTTP && httpTargeted:
+		return "dns, then http for risky domains (-http-targeted)"
+	case enableHTTP:
+		return "dns, then http"
+	case enableDNS && wildcardCheck:
+		return "dns, http only under wildcard TLDs"
+	case enableDNS:
+		return "dns"
+	}
+	return "none"
+}
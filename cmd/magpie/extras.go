@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/pigeonsec/magpie/internal/stats"
+)
+
+// processExtraOutputs runs the optional steps on the final domain list (first-seen tracking,
+// newly-seen export, bucketed files, manifest) and returns one human-readable note per step for the results summary.
+// Failures are logged as warnings so they never cost the main output. written is the
+// number of domains in the main output, which -append can make larger than this run's.
+func processExtraOutputs(validDomains []string, written int) []string {
+	var notes []string
+
+	// The main output was written just before
+	recordGenerated("output", outputFile, outputFormat, "", written)
+	if unboundChunk > 0 {
+		for n, left := 1, written; left > 0; n, left = n+1, left-unboundChunk {
+			recordGenerated("chunk", chunkPath(outputFile, n), outputFormat, "", min(left, unboundChunk))
+		}
+	}
+
+	if trackFirstSeen || newlySeenDays > 0 {
+		if note, err := updateFirstSeen(validDomains); err != nil {
+			log.Printf("Warning: First-seen tracking failed: %v", err)
+		} else {
+			notes = append(notes, note)
+		}
+	}
+
+	if bucketBy != "" {
+		if note, err := writeBuckets(validDomains); err != nil {
+			log.Printf("Warning: Bucketed output failed: %v", err)
+		} else {
+			notes = append(notes, note)
+		}
+	}
+
+	if manifestPath != "" {
+		if note, err := writeManifest(); err != nil {
+			log.Printf("Warning: Manifest failed: %v", err)
+		} else {
+			notes = append(notes, note)
+		}
+	}
+
+	return notes
+}
+
+// updateFirstSeen records newly-appearing domains and optionally writes newly-seen.txt
+func updateFirstSeen(validDomains []string) (string, error) {
+	dataPath, err := filepath.Abs(dataDir)
+	if err != nil {
+		return "", err
+	}
+
+	store, err := stats.LoadFirstSeen(dataPath)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	added := store.Record(validDomains, now)
+	if err := store.Save(); err != nil {
+		return "", err
+	}
+
+	note := fmt.Sprintf("First-seen: %s new domains this run", formatSize(added))
+
+	if newlySeenDays > 0 {
+		cutoff := now.Add(-time.Duration(newlySeenDays) * 24 * time.Hour)
+		recent := store.SeenSince(validDomains, cutoff)
+		path := filepath.Join(filepath.Dir(outputFile), newlySeenFile)
+		if err := writeLines(path, recent); err != nil {
+			return "", err
+		}
+		recordGenerated("newly-seen", path, "plain", "", len(recent))
+		note += fmt.Sprintf(", %s seen in last %dd written to %s", formatSize(len(recent)), newlySeenDays, path)
+	}
+
+	return note, nil
+}
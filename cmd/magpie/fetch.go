@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pigeonsec/magpie/internal/fetcher"
+	"github.com/pigeonsec/magpie/internal/stats"
+	"github.com/pigeonsec/magpie/internal/validator"
+	"github.com/pigeonsec/magpie/pkg/magpie"
+)
+
+// headerList collects the repeatable -header "Key: Value" flag
+type headerList http.Header
+
+func (h headerList) String() string {
+	keys := make([]string, 0, len(h))
+	for key := range h {
+		keys = append(keys, key)
+	}
+	return strings.Join(keys, ", ")
+}
+
+func (h headerList) Set(value string) error {
+	key, val, ok := strings.Cut(value, ":")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" {
+		return fmt.Errorf("expected \"Key: Value\", got %q", value)
+	}
+	http.Header(h).Add(key, strings.TrimSpace(val))
+	return nil
+}
+
+// aggregateConfig maps the flags onto the magpie.Aggregate run of urls. The frontends
+// add their hooks; sorting and writing stay with the CLI, which post-processes the
+// valid domains first. v is nil when no validation is enabled.
+func aggregateConfig(urls []string, tracker *stats.Tracker, v *validator.Validator) magpie.Config {
+	cfg := validationConfig(v)
+	cfg.Sources = urls
+	cfg.Priority = sourcePriority
+	cfg.FetchWorkers = fetchWorkers
+	cfg.FetchAdaptive = fetchAdaptive
+	cfg.FetchWorkersMin = fetchWorkersMin
+	cfg.FetchWorkersMax = fetchWorkersMax
+	cfg.ParseWorkers = parseWorkers
+	cfg.MaxSize = maxSize
+	if maxSize == 0 {
+		cfg.MaxSize = -1
+	}
+	cfg.UserAgent = userAgent
+	if len(extraHeaders) > 0 {
+		cfg.Header = http.Header(extraHeaders)
+	}
+	cfg.Proxy = proxyOverride
+	cfg.PerHostLimit = perHostLimit
+	cfg.PerHostRate = perHostRate
+	cfg.RetryFailed = retryFailed
+	cfg.RetryFailedDelay = retryFailedDelay
+	cfg.Tracker = tracker
+	cfg.MinInterval = minInterval
+	cfg.Master = masterFilter
+	cfg.GroupBySource = groupBySource
+	cfg.Overlap = overlapStages
+	cfg.Sort = "none"
+	cfg.Keep = keepValid
+	if !noFetchCache {
+		cache, err := openFetchCache()
+		if err != nil {
+			log.Printf("Warning: fetch cache disabled: %v", err)
+		} else {
+			cfg.Cache = cache
+		}
+	}
+	return cfg
+}
+
+// validationConfig maps the validation flags onto a magpie.Config using v
+func validationConfig(v *validator.Validator) magpie.Config {
+	return magpie.Config{
+		DNS:                enableDNS,
+		HTTP:               enableHTTP,
+		MX:                 mxCheck,
+		Workers:            workers,
+		Validator:          v,
+		SecondPass:         secondPass,
+		HTTPTargeted:       httpTargeted,
+		HTTPRiskSample:     httpRiskSample,
+		HTTPDeadline:       httpDeadline,
+		HTTPDeadlineReject: httpDeadlinePolicy == "reject",
+		Verdicts:           domainVerdicts,
+		Ramp:               validationRamp,
+		RecordInvalid:      invalidLog != "",
+		Debug:              debugTraces,
+		DebugSample:        debugSample,
+	}
+}
+
+// saveFetchCache writes the fetch cache of a finished run for the next one
+func saveFetchCache(cfg magpie.Config) {
+	if cfg.Cache == nil {
+		return
+	}
+	if err := cfg.Cache.Save(); err != nil {
+		log.Printf("Warning: failed to save fetch cache: %v", err)
+	}
+}
+
+// openFetchCache opens the conditional fetch cache in the data directory,
+// wiping it first with -clear-fetch-cache
+func openFetchCache() (*fetcher.FetchCache, error) {
+	dataPath, err := filepath.Abs(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(dataPath, fetcher.CacheDir)
+	if clearFetchCache {
+		if err := os.RemoveAll(dir); err != nil {
+			return nil, err
+		}
+	}
+	return fetcher.NewFetchCache(dir)
+}
+
+// describeFetchers describes the fetch concurrency for the log, e.g. "5 parallel
+// fetchers (adaptive, 1-8)"
+func describeFetchers() string {
+	if !fetchAdaptive {
+		return fmt.Sprintf("%d parallel fetchers", fetchWorkers)
+	}
+	start := max(fetchWorkersMin, min(fetchWorkers, fetchWorkersMax))
+	return fmt.Sprintf("%d parallel fetchers (adaptive, %d-%d)", start, fetchWorkersMin, fetchWorkersMax)
+}
+
+// sourceFailures converts the failed sources of a run for -json-summary and -error-report
+func sourceFailures(failures []*magpie.SourceError) []sourceFailure {
+	converted := make([]sourceFailure, 0, len(failures))
+	for _, failure := range failures {
+		converted = append(converted, sourceFailure{URL: failure.URL, Error: failure.Err.Error()})
+	}
+	return converted
+}
+
+// failureMessages returns the message of each failed source, for the results and -error-log
+func failureMessages(failures []*magpie.SourceError) []string {
+	messages := make([]string, 0, len(failures))
+	for _, failure := range failures {
+		messages = append(messages, failure.Error())
+	}
+	return messages
+}
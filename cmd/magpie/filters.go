@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/pigeonsec/magpie/internal/fetcher"
+	"github.com/pigeonsec/magpie/pkg/magpie"
+)
+
+// domainTLD returns the last label of a domain
+func domainTLD(domain string) string {
+	if idx := strings.LastIndex(domain, "."); idx != -1 {
+		return domain[idx+1:]
+	}
+	return domain
+}
+
+// loadAllowlist reads domains that must never be blocked, one per line. Entries are
+// normalized like blocklist lines, so hosts-style lines, comments and Adblock @@
+// exceptions work too.
+func loadAllowlist(path string) (map[string]struct{}, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open allowlist: %w", err)
+	}
+	defer file.Close()
+
+	allow := make(map[string]struct{})
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		rule := fetcher.ParseDomain(scanner.Text())
+		if (rule.Type == fetcher.RuleBlock || rule.Type == fetcher.RuleAllow) && fetcher.IsValidDomain(rule.Domain) {
+			allow[rule.Domain] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading allowlist: %w", err)
+	}
+	return allow, nil
+}
+
+// applyAllowlist removes allowlisted domains and their subdomains and returns how many were removed
+func applyAllowlist(domains, allow map[string]struct{}) int {
+	if len(allow) == 0 {
+		return 0
+	}
+
+	removed := 0
+	for domain := range domains {
+		if allowlisted(domain, allow) {
+			delete(domains, domain)
+			removed++
+		}
+	}
+	return removed
+}
+
+// allowlisted reports whether the domain or one of its parent domains is allowlisted
+func allowlisted(domain string, allow map[string]struct{}) bool {
+	for {
+		if _, ok := allow[domain]; ok {
+			return true
+		}
+		idx := strings.IndexByte(domain, '.')
+		if idx == -1 {
+			return false
+		}
+		domain = domain[idx+1:]
+	}
+}
+
+// capPerTLD keeps at most max domains per TLD and returns the number dropped per capped TLD.
+// Domains are kept in lexical order so the surviving set is reproducible between runs.
+func capPerTLD(domains map[string]struct{}, max int) map[string]int {
+	if max <= 0 {
+		return nil
+	}
+
+	byTLD := make(map[string][]string)
+	for domain := range domains {
+		tld := domainTLD(domain)
+		byTLD[tld] = append(byTLD[tld], domain)
+	}
+
+	capped := make(map[string]int)
+	for tld, list := range byTLD {
+		if len(list) <= max {
+			continue
+		}
+		sort.Strings(list)
+		for _, domain := range list[max:] {
+			delete(domains, domain)
+		}
+		capped[tld] = len(list) - max
+	}
+
+	return capped
+}
+
+// limitDomains keeps the first max domains in -sort order (lexical for none), so the
+// same input always gives the same sample, and returns how many were dropped
+func limitDomains(domains map[string]struct{}, max int) int {
+	if max <= 0 || len(domains) <= max {
+		return 0
+	}
+
+	list := make([]string, 0, len(domains))
+	for domain := range domains {
+		list = append(list, domain)
+	}
+	slices.SortFunc(list, magpie.DomainCompare(sortOrder))
+	for _, domain := range list[max:] {
+		delete(domains, domain)
+	}
+	return len(list) - max
+}
+
+// formatCappedTLDs renders capped TLDs as ".cn (-1.2M), .xyz (-340)", largest first
+func formatCappedTLDs(capped map[string]int) string {
+	tlds := make([]string, 0, len(capped))
+	for tld := range capped {
+		tlds = append(tlds, tld)
+	}
+	sort.Slice(tlds, func(i, j int) bool {
+		if capped[tlds[i]] != capped[tlds[j]] {
+			return capped[tlds[i]] > capped[tlds[j]]
+		}
+		return tlds[i] < tlds[j]
+	})
+
+	parts := make([]string, len(tlds))
+	for i, tld := range tlds {
+		parts[i] = fmt.Sprintf(".%s (-%s)", tld, formatSize(capped[tld]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatWildcardTLDs renders wildcard TLDs as ".tk, .xyz", keeping summary lines short
+func formatWildcardTLDs(tlds []string) string {
+	const maxShown = 6
+
+	parts := make([]string, 0, maxShown+1)
+	for i, tld := range tlds {
+		if i == maxShown {
+			parts = append(parts, fmt.Sprintf("+%d more", len(tlds)-maxShown))
+			break
+		}
+		parts = append(parts, "."+tld)
+	}
+	return strings.Join(parts, ", ")
+}
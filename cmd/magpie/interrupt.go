@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/pigeonsec/magpie/internal/stats"
+	"github.com/pigeonsec/magpie/pkg/magpie"
+)
+
+// partialSuffix marks the output of an interrupted run
+const partialSuffix = ".partial"
+
+// saveInterrupted keeps what an interrupted run gathered: the tracker stats and the
+// valid domains found so far, written to <output>.partial in the configured format. The
+// output itself is left as it was. Returns a note for the log or TUI.
+func saveInterrupted(tracker *stats.Tracker, validDomains []string) string {
+	if dryRun {
+		return fmt.Sprintf("%s valid domains found so far (dry run, nothing saved)", formatSize(len(validDomains)))
+	}
+
+	if tracker != nil {
+		if err := tracker.Save(); err != nil {
+			log.Printf("Warning: Failed to save stats: %v", err)
+		}
+	}
+
+	partial := outputFile + partialSuffix
+	if validStream != nil {
+		written, err := validStream.CloseTo(partial)
+		if err != nil {
+			return fmt.Sprintf("stats saved, but writing %s failed: %v", partial, err)
+		}
+		return fmt.Sprintf("stats saved, %s valid domains found so far written to %s (%s untouched)", formatSize(written), partial, outputFile)
+	}
+	if validDomains == nil {
+		return fmt.Sprintf("stats saved, no domains validated yet (%s untouched)", outputFile)
+	}
+
+	magpie.SortDomains(validDomains, sortOrder)
+	if err := writeOutput(partial, validDomains, nil); err != nil {
+		return fmt.Sprintf("stats saved, but writing %s failed: %v", partial, err)
+	}
+	return fmt.Sprintf("stats saved, %s valid domains found so far written to %s (%s untouched)", formatSize(len(validDomains)), partial, outputFile)
+}
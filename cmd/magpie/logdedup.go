@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// logDedupWindow is how long repeats of the same error are folded into one line
+const logDedupWindow = 30 * time.Second
+
+// dedupEntry tracks one message key within the current window
+type dedupEntry struct {
+	since   time.Time
+	repeats int
+}
+
+// dedupLog collapses identical messages logged within logDedupWindow. The first one in
+// a window is logged in full; repeats are counted and reported as a single
+// "<key> (xN)" line when the window is over or on Flush.
+type dedupLog struct {
+	mu      sync.Mutex
+	window  time.Duration
+	entries map[string]*dedupEntry
+}
+
+func newDedupLog(window time.Duration) *dedupLog {
+	return &dedupLog{window: window, entries: make(map[string]*dedupEntry)}
+}
+
+// Printf logs the message unless key was already logged within the window
+func (d *dedupLog) Printf(key, format string, args ...interface{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	if entry, ok := d.entries[key]; ok {
+		if now.Sub(entry.since) < d.window {
+			entry.repeats++
+			return
+		}
+		d.report(key, entry)
+	}
+
+	d.entries[key] = &dedupEntry{since: now}
+	log.Printf(format, args...)
+}
+
+// Flush reports repeats still pending for every key
+func (d *dedupLog) Flush() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	keys := make([]string, 0, len(d.entries))
+	for key := range d.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		d.report(key, d.entries[key])
+	}
+	d.entries = make(map[string]*dedupEntry)
+}
+
+// report logs the repeat count of a window, counting its first message too
+func (d *dedupLog) report(key string, entry *dedupEntry) {
+	if entry.repeats > 0 {
+		log.Printf("ERROR: %s (x%d)", key, entry.repeats+1)
+	}
+}
+
+// errorKey reduces an error to its innermost cause, so the same failure on different
+// URLs ("connection refused", "HTTP 404: Not Found") shares one key
+func errorKey(err error) string {
+	for {
+		inner := errors.Unwrap(err)
+		if inner == nil {
+			return err.Error()
+		}
+		err = inner
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"log"
+	"log/slog"
+)
+
+// logFormats are the -log-format choices
+var logFormats = []string{"text", "json"}
+
+// structured is the -log-format json logger; nil keeps the usual free-text lines
+var structured *slog.Logger
+
+// setupLogging turns the log output into JSON records for -log-format json. The key
+// events of a run carry their own fields (see logEvent); every other log line becomes a
+// record with just a msg. Call once the log output is final (-silent).
+func setupLogging() {
+	if logFormat != "json" {
+		return
+	}
+	structured = slog.New(slog.NewJSONHandler(log.Writer(), nil))
+	slog.SetDefault(structured)
+}
+
+// logEvent logs one of the key events of a run: text in text mode, or a record named
+// msg with fields as attributes in json mode. An empty text logs nothing in text mode.
+func logEvent(msg, text string, fields ...any) {
+	if structured != nil {
+		structured.Info(msg, fields...)
+		return
+	}
+	if text != "" {
+		log.Print(text)
+	}
+}
@@ -3,16 +3,24 @@ package main
 import (
 	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"net/netip"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
-	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
+	"unicode/utf8"
 
 	"github.com/fatih/color"
 	tea "github.com/charmbracelet/bubbletea"
@@ -22,9 +30,27 @@ import (
 	"github.com/pigeonsec/magpie/internal/stats"
 	"github.com/pigeonsec/magpie/internal/ui"
 	"github.com/pigeonsec/magpie/internal/validator"
+	"github.com/pigeonsec/magpie/pkg/magpie"
+	"golang.org/x/net/publicsuffix"
 	"golang.org/x/term"
 )
 
+// newlySeenFile is written next to the output when -newly-seen-days is set
+const newlySeenFile = "newly-seen.txt"
+
+// exitEmptyResult is the exit code for a run that found no domains under -keep-on-empty
+const exitEmptyResult = 3
+
+// exitSourceFailures is the exit code for a completed run in which more than
+// -fail-threshold percent of the sources failed
+const exitSourceFailures = 4
+
+// exitInterrupted is the exit code after SIGINT or SIGTERM, as shells report an interrupt
+const exitInterrupted = 130
+
+// exitDataDirLocked is the exit code when another run holds the -data-dir lock
+const exitDataDirLocked = 5
+
 const logo = `
 🦅 Magpie - Blocklist Aggregation & Validation Tool
 `
@@ -34,63 +60,317 @@ var (
 
 	// Input/Output
 	sourceFile string
+	sourceTags string
 	outputFile string
 
+	// Bucketed output next to the main output file
+	bucketBy    string
+	bucketCount int
+
+	// Output line format and optional per-source grouping
+	outputFormat       string
+	groupBySource      bool
+	listHeader         bool
+	zoneSerialStrategy string
+
+	// JSON index of every list file written this run
+	manifestPath string
+
+	// Write <output>.diff against the previous output
+	diffOutput bool
+
+	// Merge into the existing output instead of overwriting it
+	appendOutput bool
+	unboundChunk int
+	streamOutput bool
+
+	// Order of the output domains: alpha, tld or none
+	sortOrder string
+
 	// Validation
 	enableDNS    bool
 	enableHTTP   bool
-	workers      int
-	dnsResolvers string
+	workers        int
+	autoWorkers    bool
+	resolverQPS    float64
+	httpWorkers    int
+	httpAccept     string
+	validationRamp time.Duration
+	overlapStages  bool
+	dnsResolvers   string
+	resolverOrder  string
+	bulkResolver   string
+	bulkBatch      int
+	httpTargeted   bool
+	httpRiskSample float64
+	retryServFail  bool
+	dnsRetries     int
+	dnsRecordList  string
+	ignoreIPList   string
+	deadTLDs       string
+	wildcardCheck  bool
+	detectWildcard bool
+	requireWWW     bool
+	mxCheck        bool
+	secondPass     bool
+
+	// acceptStatus is the parsed -http-accept rule (nil for the default, below 500)
+	acceptStatus func(status int) bool
+	// dnsRecords is the parsed -dns-records set
+	dnsRecords validator.RecordSet
+	// ignoreIPs is the parsed -ignore-ips set (nil with 'none')
+	ignoreIPs map[netip.Addr]struct{}
+
+	// HTTP time budget: after httpDeadline, DNS-valid domains are accepted or rejected per policy
+	httpDeadline       time.Duration
+	httpDeadlinePolicy string
 
 	// Performance
-	fetchWorkers int
-	enableCache  bool
+	fetchWorkers  int
+	parseWorkers  int
+	perHostLimit  int
+	perHostRate   float64
+	enableCache   bool
+	cacheTTLAware bool
+	cacheMaxTTL   time.Duration
+	persistCache  bool
+	cacheMax      int
+
+	// Fetch concurrency that adapts to failures with -fetch-adaptive, within min and max
+	fetchAdaptive   bool
+	fetchWorkersMin int
+	fetchWorkersMax int
+
+	// Per-domain DNS verdicts kept across runs with -domain-cache-ttl
+	domainCacheTTL string
+	domainVerdicts *stats.DomainCache
+
+	// Retry failed sources once more at the end of the fetch stage
+	retryFailed      bool
+	retryFailedDelay time.Duration
+
+	// Largest body accepted from one source, in bytes
+	maxSize int64
+
+	// Request identity for sources that filter clients or need credentials
+	userAgent    string
+	extraHeaders = headerList{}
+
+	// Proxy for all HTTP traffic; overrides HTTP_PROXY / HTTPS_PROXY / ALL_PROXY
+	proxyURL      string
+	proxyOverride netutil.ProxyFunc
+
+	// How the internet connection is checked before and during a run
+	connectivityCheck string
+	connectivityURL   string
+	probeHosts        string
 
 	// Stats & Filtering
-	dataDir    string
-	noTracking bool
+	dataDir     string
+	noTracking  bool
+	maxPerTLD   int
+	domainLimit int
+
+	// Conditional fetches via cached ETag / Last-Modified (stored in data-dir)
+	noFetchCache    bool
+	clearFetchCache bool
+	minInterval     time.Duration
+
+	// Domains that must never be blocked (with their subdomains)
+	allowlistFile string
+
+	// Regular expressions the output domains must match (-include) or must not (-exclude)
+	includePatterns patternList
+	excludePatterns patternList
+
+	// Drop subdomains whose registrable parent is also in the output
+	collapseSubs bool
+	// Write leading-dot source entries as wildcards in the -format (see addWildcards)
+	wildcardOutput bool
+
+	// Existing master list; domains already in it are skipped as duplicates
+	masterFile   string
+	bloomSize    int
+	masterFilter *stats.BloomFilter
+	allowDomains  map[string]struct{}
+	// Extra failures allowed for sources that have never fetched successfully
+	newSourceGrace int
+	// Period after which one failure of a source is forgiven (0 = never)
+	failureDecay time.Duration
+
+	// First-seen tracking
+	trackFirstSeen bool
+	newlySeenDays  int
 
 	// Options
-	quiet     bool
-	silent    bool
-	showVer   bool
-	showStats bool
+	configFile       string
+	quiet            bool
+	silent           bool
+	showVer          bool
+	showStats        bool
+	statsJSON        string
+	pruneStats       bool
+	pruneAge         string
+	statsSince       string
+	sortStats        string
+	mergeStats       string
+	resetURLs        urlList
+	resetAll         bool
+	mergePolicy      string
+	mergeOutput      string
+	explainDomain    string
+	dedupeOnly       string
+	maxErrorsDisplay int
+	errorLogFile     string
+	errorReport      string
+	failThreshold    float64
+	invalidLog       string
+	debugMode        bool
+	debugLogFile     string
+	debugSample      int
+	logFormat        string
+	promTextfile     string
+	jsonSummary      string
+	keepOnEmpty      bool
+	dryRun           bool
+
+	// runStart marks when this run began, for duration metrics
+	runStart time.Time
 )
 
 func init() {
 	// Input/Output flags
-	flag.StringVar(&sourceFile, "source", "", "Source file containing URLs to fetch (one per line)")
+	flag.StringVar(&sourceFile, "source", "", "Source file containing URLs to fetch (one per line), or - for stdin")
 	flag.StringVar(&sourceFile, "s", "", "Shorthand for -source")
+	flag.StringVar(&sourceTags, "tags", "", "Only fetch sources tagged with any of these comma-separated tags (#tags: in the source file)")
 	flag.StringVar(&outputFile, "output", "aggregated.txt", "Output file for aggregated domains")
 	flag.StringVar(&outputFile, "o", "aggregated.txt", "Shorthand for -output")
+	flag.StringVar(&outputFormat, "format", "plain", "Output format: plain (one domain per line), hosts (0.0.0.0 domain), pihole (Pi-hole adlist), dnsmasq, unbound, rpz (Response Policy Zone) or adguard (||domain^ rules)")
+	flag.StringVar(&zoneSerialStrategy, "zone-serial", "date", "SOA serial for zone formats: date (YYYYMMDDNN, counter kept in data-dir), unix or hash (of the content)")
+	flag.BoolVar(&groupBySource, "group-by-source", false, "Group the output under '# From: <url>' comments, attributing each domain to the first source that listed it")
+	flag.BoolVar(&listHeader, "list-header", false, "Start the output with comment lines giving the generation time, entry count, Magpie version and source URLs")
+	flag.BoolVar(&diffOutput, "diff", false, "Before overwriting the output, write <output>.diff with the domains added (+) and removed (-)")
+	flag.StringVar(&sortOrder, "sort", "alpha", "Order of the output domains: alpha (lexical), tld (by reversed labels, grouping siblings) or none (unordered)")
+	flag.IntVar(&unboundChunk, "unbound-chunk", 0, "With -format unbound, write files of at most this many domains and make the output an index of include: lines (0 = one file)")
+	flag.BoolVar(&streamOutput, "stream-output", false, "Write valid domains to the output as they validate instead of collecting them first (unsorted, lower memory)")
+	flag.BoolVar(&appendOutput, "append", false, "Merge the valid domains into the existing output file (sorted union) instead of overwriting it")
+	flag.StringVar(&manifestPath, "manifest", "", "Write a JSON manifest of the generated files (path, format, domain count, SHA-256, timestamp)")
+	flag.StringVar(&bucketBy, "bucket-by", "", "Also write the output split into deterministic buckets: letter (first character) or hash")
+	flag.IntVar(&bucketCount, "buckets", 16, "Number of buckets for -bucket-by hash")
 
 	// Validation flags
 	flag.BoolVar(&enableDNS, "dns", true, "Enable DNS validation (A, AAAA, CNAME)")
 	flag.BoolVar(&enableDNS, "d", true, "Shorthand for -dns")
 	flag.BoolVar(&enableHTTP, "http", false, "Enable HTTP validation (in addition to DNS)")
 	flag.BoolVar(&enableHTTP, "H", false, "Shorthand for -http")
-	flag.IntVar(&workers, "workers", 100, "Number of concurrent validation workers")
-	flag.IntVar(&workers, "w", 100, "Shorthand for -workers")
+	flag.BoolVar(&retryServFail, "retry-servfail", true, "Retry lookups that fail with SERVFAIL on a different resolver")
+	flag.IntVar(&dnsRetries, "dns-retries", 1, "Ask up to this many other resolvers when a lookup times out or fails with SERVFAIL, before marking the domain invalid")
+	flag.StringVar(&dnsRecordList, "dns-records", "a,aaaa,cname", "Record types that make a domain valid, comma-separated (a, aaaa, cname); only these are looked up")
+	flag.StringVar(&ignoreIPList, "ignore-ips", strings.Join(validator.DefaultIgnoreIPs, ","), "Comma-separated addresses that don't count as an answer; a domain resolving only to them is invalid ('none' disables)")
+	flag.BoolVar(&secondPass, "second-pass", false, "Recheck domains whose DNS lookup timed out or hit SERVFAIL once more before dropping them")
+	flag.BoolVar(&mxCheck, "mx", false, "Only keep domains with MX records; with -dns=false the MX lookup replaces the A/AAAA/CNAME check")
+	flag.BoolVar(&requireWWW, "require-apex-and-www", false, "Strict: only accept a domain if both it and its www. variant resolve")
+	flag.BoolVar(&detectWildcard, "detect-wildcard", false, "Drop subdomains that resolve to the same address as a random name under their parent (parking/sinkhole wildcards)")
+	flag.BoolVar(&wildcardCheck, "wildcard-check", true, "In DNS-only mode, HTTP-check domains under TLDs that wildcard-resolve nonexistent names")
+	flag.StringVar(&deadTLDs, "dead-tlds", "", "Comma-separated TLDs marked invalid without a lookup (replaces the built-in list; 'none' disables)")
+	flag.BoolVar(&httpTargeted, "http-targeted", false, "With -http, only HTTP-check risky domains (uncommon TLDs or sampled) and trust DNS for the rest")
+	flag.Float64Var(&httpRiskSample, "http-risk-sample", 0, "Percentage of common-TLD domains still HTTP-checked in targeted mode")
+	workers = defaultWorkers
+	flag.Var(workersFlag{}, "workers", "Number of concurrent validation workers, or auto to size the pool from the resolver count and -resolver-qps")
+	flag.Var(workersFlag{}, "w", "Shorthand for -workers")
+	flag.Float64Var(&resolverQPS, "resolver-qps", 500, "With -workers auto, the queries per second aimed at each resolver")
+	flag.BoolVar(&overlapStages, "overlap", false, "Validate domains as sources are fetched instead of after the whole fetch")
+	flag.DurationVar(&validationRamp, "ramp", 0, "Start validation workers in staggered waves over this period instead of all at once (e.g. 5s)")
+	flag.IntVar(&httpWorkers, "http-workers", 0, "Maximum concurrent HTTP checks with -http (0 = same as -workers)")
+	flag.StringVar(&httpAccept, "http-accept", "", "HTTP status codes that count as reachable with -http, e.g. 2xx,3xx or 200-399 (default: anything below 500)")
+	flag.DurationVar(&httpDeadline, "http-deadline", 0, "Time budget for HTTP checks, counted from the first one; afterwards DNS-valid domains skip HTTP (0 = no limit)")
+	flag.StringVar(&httpDeadlinePolicy, "http-deadline-policy", "accept", "What to do with DNS-valid domains left unchecked at -http-deadline: accept or reject")
 	flag.StringVar(&dnsResolvers, "resolvers", "1.1.1.1:53,1.0.0.1:53,8.8.8.8:53,8.8.4.4:53,9.9.9.9:53,149.112.112.112:53", "Comma-separated DNS resolvers")
+	flag.StringVar(&resolverOrder, "resolver-strategy", "roundrobin", "How each lookup picks a resolver: roundrobin, or hash so a domain always goes to the same resolver (reproducible runs)")
+	flag.StringVar(&bulkResolver, "bulk-resolver", "", "Validate DNS through this bulk-resolution HTTP endpoint in batches instead of one query per domain")
+	flag.IntVar(&bulkBatch, "bulk-batch", validator.DefaultBulkBatchSize, "Domains per request with -bulk-resolver")
 	flag.StringVar(&dnsResolvers, "r", "1.1.1.1:53,1.0.0.1:53,8.8.8.8:53,8.8.4.4:53,9.9.9.9:53,149.112.112.112:53", "Shorthand for -resolvers")
 
 	// Performance flags
 	flag.IntVar(&fetchWorkers, "fetch-workers", 5, "Number of concurrent URL fetchers")
 	flag.IntVar(&fetchWorkers, "f", 5, "Shorthand for -fetch-workers")
+	flag.BoolVar(&fetchAdaptive, "fetch-adaptive", false, "Halve the parallel fetchers when many fetches fail (e.g. a degrading connection) and add them back as fetches succeed again")
+	flag.IntVar(&fetchWorkersMin, "fetch-workers-min", 1, "With -fetch-adaptive, the fewest parallel fetchers")
+	flag.IntVar(&fetchWorkersMax, "fetch-workers-max", 0, "With -fetch-adaptive, the most parallel fetchers (0 = -fetch-workers)")
+	flag.IntVar(&parseWorkers, "parse-workers", 0, "Parse downloaded lists on a separate worker pool (0 = parse inside fetch workers)")
+	flag.IntVar(&perHostLimit, "per-host-limit", 0, "Maximum concurrent requests to one hostname (0 = unlimited)")
+	flag.Float64Var(&perHostRate, "per-host-rate", 0, "Maximum requests per second to one hostname (0 = unlimited)")
+	flag.BoolVar(&retryFailed, "retry-failed", false, "Retry failed sources once at the end of the fetch stage before recording the failure")
+	flag.DurationVar(&retryFailedDelay, "retry-failed-delay", 30*time.Second, "Wait this long before retrying failed sources")
+	flag.Int64Var(&maxSize, "max-size", fetcher.DefaultMaxSize, "Largest download accepted from one source, in bytes (0 = unlimited)")
+	flag.StringVar(&userAgent, "user-agent", fetcher.DefaultUserAgent, "User-Agent sent when fetching sources")
+	flag.StringVar(&connectivityCheck, "connectivity-check", netutil.CheckDNS, "How to check the internet connection: dns (UDP/53 to public resolvers), http (GET -connectivity-url) or none")
+	flag.StringVar(&connectivityURL, "connectivity-url", netutil.DefaultProbeURL, "URL for -connectivity-check http; must answer 200 or 204")
+	flag.StringVar(&probeHosts, "probe-hosts", "", "Comma-separated DNS servers (host or host:port) for -connectivity-check dns, in place of Cloudflare, Google and Quad9")
+	flag.StringVar(&proxyURL, "proxy", "", "Send all HTTP requests (fetches, HTTP checks, -bulk-resolver) through this proxy: http://, https:// or socks5:// (overrides HTTP_PROXY/HTTPS_PROXY/ALL_PROXY)")
+	flag.Var(extraHeaders, "header", "Extra request header \"Key: Value\" sent when fetching sources (repeatable, overrides the defaults)")
 	flag.BoolVar(&enableCache, "cache", true, "Enable DNS result caching (5min TTL)")
 	flag.BoolVar(&enableCache, "c", true, "Shorthand for -cache")
+	flag.BoolVar(&cacheTTLAware, "cache-ttl-aware", false, "Cache each DNS result for its real record TTL instead of 5min (needs -resolvers)")
+	flag.DurationVar(&cacheMaxTTL, "cache-max-ttl", time.Hour, "Upper bound for TTL-aware cache entries")
+	flag.IntVar(&cacheMax, "cache-max", validator.DefaultMaxCacheEntries, "Maximum DNS cache entries; the oldest are evicted first (0 = unlimited)")
+	flag.BoolVar(&persistCache, "persist-cache", true, "Keep unexpired DNS cache entries across runs (stored in data-dir)")
+	flag.StringVar(&domainCacheTTL, "domain-cache-ttl", "", "Skip DNS for domains found invalid within this window (e.g. 7d); valid verdicts last a quarter of it")
 
 	// Stats & Filtering flags
 	flag.StringVar(&dataDir, "data-dir", "./data", "Directory for stats.json and persistent data")
 	flag.BoolVar(&noTracking, "no-tracking", false, "Disable URL health tracking and filtering")
+	flag.BoolVar(&noFetchCache, "no-fetch-cache", false, "Always download sources in full instead of sending If-None-Match / If-Modified-Since")
+	flag.BoolVar(&clearFetchCache, "clear-fetch-cache", false, "Drop the cached source bodies and validators before fetching")
+	flag.DurationVar(&minInterval, "min-interval", 0, "Reuse the cached copy of sources fetched successfully within this window, without any request (0 = always fetch)")
+	flag.IntVar(&maxPerTLD, "max-per-tld", 0, "Maximum domains kept per TLD (0 = unlimited)")
+	flag.IntVar(&domainLimit, "limit", 0, "Validate only the first N unique domains in -sort order, for quick test runs (0 = no limit)")
+	flag.BoolVar(&collapseSubs, "collapse-subdomains", false, "Drop domains whose parent (at or below the public suffix) is also in the output")
+	flag.BoolVar(&wildcardOutput, "wildcards", false, "Write domains listed as leading-dot entries (.example.com) so they block all subdomains too, and drop the subdomains they cover")
+	flag.StringVar(&masterFile, "master", "", "Existing master list; domains already in it count as duplicates and aren't validated or written again")
+	flag.IntVar(&bloomSize, "bloom-size", defaultBloomSize, "Number of master domains the -master bloom filter is sized for (0.1% false positives at that size)")
+	flag.StringVar(&allowlistFile, "allowlist", "", "File of domains never to block; they and their subdomains are removed before validation")
+	flag.Var(&includePatterns, "include", "Keep only domains matching this regular expression (repeatable, a domain matching any is kept)")
+	flag.Var(&excludePatterns, "exclude", "Drop domains matching this regular expression (repeatable)")
+	flag.IntVar(&newSourceGrace, "new-source-grace", 2, "Extra failures allowed before blacklisting a source that has never worked")
+	flag.DurationVar(&failureDecay, "failure-decay", 24*time.Hour, "Forgive one failure of a source per period without failures, so blacklisted sources are retried (0 = never)")
+	flag.BoolVar(&trackFirstSeen, "first-seen", false, "Track when each output domain first appeared (stored in data-dir)")
+	flag.IntVar(&newlySeenDays, "newly-seen-days", 0, "Write domains first seen within N days to newly-seen.txt (implies -first-seen)")
 
 	// Options flags
+	flag.StringVar(&configFile, "config", "", "Load settings from a YAML or TOML file, keyed by flag name; flags on the command line override it")
 	flag.BoolVar(&quiet, "quiet", false, "Quiet mode - minimal output")
 	flag.BoolVar(&quiet, "q", false, "Shorthand for -quiet")
 	flag.BoolVar(&silent, "silent", false, "Silent mode - no output (perfect for cronjobs)")
 	flag.BoolVar(&showVer, "version", false, "Show version information")
 	flag.BoolVar(&showVer, "v", false, "Shorthand for -version")
 	flag.BoolVar(&showStats, "stats", false, "Display stats table and exit")
+	flag.StringVar(&statsJSON, "stats-json", "", "Write the full stats data (every tracked source and the last run's totals) to this file as JSON and exit ('-' for stdout)")
+	flag.BoolVar(&pruneStats, "prune-stats", false, "Remove the stats of sources no longer in the -source file, then exit")
+	flag.StringVar(&pruneAge, "prune-age", "", "With -prune-stats, also remove sources not checked within this window (e.g. 90d)")
+	flag.Var(&resetURLs, "reset", "Clear the blacklist and failure count of this source URL, then exit (repeatable)")
+	flag.BoolVar(&resetAll, "reset-all", false, "Clear the blacklist and failure counts of every source, then exit")
+	flag.StringVar(&mergeStats, "merge-stats", "", "Merge stats from comma-separated data-dirs and display the combined table")
+	flag.StringVar(&mergePolicy, "merge-policy", "recent", "Blacklist conflict rule for -merge-stats: recent, majority or any")
+	flag.StringVar(&mergeOutput, "merge-output", "", "Write the merged stats.json into this directory instead of displaying it")
+	flag.StringVar(&explainDomain, "explain", "", "Trace why a single domain passes or fails validation, then exit (sources aren't fetched)")
+	flag.StringVar(&dedupeOnly, "dedupe-only", "", "Count unique domains across comma-separated local files and report each file's contribution, then exit (no network)")
+	flag.StringVar(&sortStats, "sort-stats", "name", "Order of the -stats table: name, reliability (lowest success rate first), lastchecked or contribution (most domains first)")
+	flag.StringVar(&statsSince, "since", "", "With -stats, only show sources checked within this window (e.g. 12h, 7d)")
+	flag.IntVar(&maxErrorsDisplay, "max-errors-display", 3, "Maximum number of errors shown in the summary")
+	flag.StringVar(&errorLogFile, "error-log", "", "Write all fetch errors (untruncated) to this file")
+	flag.StringVar(&errorReport, "error-report", "", "Write every failed source with its error and failure count to this file (JSON for .json, CSV otherwise)")
+	flag.StringVar(&invalidLog, "invalid-log", "", "Write every dropped domain with its outcome (dead, dns_only_alive) to this file as NDJSON")
+	flag.BoolVar(&debugMode, "debug", false, "Log the validation trace of every failed domain: record types queried, the resolver that answered and the error")
+	flag.StringVar(&debugLogFile, "log-file", "", "Append the -debug traces to this file instead of stderr")
+	flag.IntVar(&debugSample, "debug-sample", 1, "With -debug, trace only 1 in N failed domains (picked by a hash of the name)")
+	flag.StringVar(&logFormat, "log-format", "text", "Format of the log lines without the TUI: text, or json for one structured record per line")
+	flag.BoolVar(&keepOnEmpty, "keep-on-empty", false, "If no source yields any domain, keep the existing output and exit with code 3")
+	flag.Float64Var(&failThreshold, "fail-threshold", 50, "Exit with code 4 when more than this percentage of the fetched sources failed (100 = never)")
+	flag.StringVar(&promTextfile, "prom-textfile", "", "Write run metrics in Prometheus textfile format to this path")
+	flag.StringVar(&promTextfile, "metrics", "", "Shorthand for -prom-textfile")
+	flag.StringVar(&jsonSummary, "json-summary", "", "Write a JSON summary of the run to this file at the very end ('-' for stdout, with all other output moved to stderr)")
+	flag.BoolVar(&dryRun, "dry-run", false, "Fetch and validate as usual, but write no output, stats or cache files")
 
 	// Custom usage message
 	flag.Usage = printUsage
@@ -152,10 +432,34 @@ func printUsage() {
 	// Input/Output
 	b.WriteString(headerStyle.Render("INPUT/OUTPUT:"))
 	b.WriteString("\n")
-	b.WriteString(sectionStyle.Render(flagStyle.Render("-s, -source") + " " + descStyle.Render("<file>       Source file containing URLs (one per line) ") + lipgloss.NewStyle().Foreground(lipgloss.Color("9")).Render("[REQUIRED]")))
+	b.WriteString(sectionStyle.Render(flagStyle.Render("-s, -source") + " " + descStyle.Render("<file>       Source file containing URLs (one per line, - for stdin) ") + lipgloss.NewStyle().Foreground(lipgloss.Color("9")).Render("[REQUIRED]")))
 	b.WriteString("\n")
 	b.WriteString(sectionStyle.Render(flagStyle.Render("-o, -output") + " " + descStyle.Render("<file>       Output file for aggregated domains (default: aggregated.txt)")))
 	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--format") + " " + descStyle.Render("<fmt>          Output format: plain, hosts, pihole, dnsmasq, unbound, rpz, adguard (default: plain)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--stream-output") + "          " + descStyle.Render("Write domains as they validate (unsorted, lower memory)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--unbound-chunk") + " " + descStyle.Render("<n>     Split unbound output into included files of n domains")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--zone-serial") + " " + descStyle.Render("<s>       SOA serial for zone formats: date, unix or hash (default: date)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--group-by-source") + " " + descStyle.Render("     Group output under '# From: <url>' comments per source")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--list-header") + " " + descStyle.Render("         Start the output with comments: time, count, version, sources")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--manifest") + " " + descStyle.Render("<file>       Write a JSON manifest of the generated files")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--diff") + "                   " + descStyle.Render("Write <output>.diff with domains added and removed since the last run")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--sort") + " " + descStyle.Render("<order>          Output order: alpha, tld or none (default: alpha)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--append") + "                 " + descStyle.Render("Merge into the existing output (sorted union) instead of overwriting")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--bucket-by") + " " + descStyle.Render("<mode>      Also split output into buckets: letter or hash")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--buckets") + " " + descStyle.Render("<n>           Bucket count for --bucket-by hash (default: 16)")))
+	b.WriteString("\n")
 
 	// Validation
 	b.WriteString(headerStyle.Render("VALIDATION:"))
@@ -164,18 +468,102 @@ func printUsage() {
 	b.WriteString("\n")
 	b.WriteString(sectionStyle.Render(flagStyle.Render("-H, -http") + "                " + descStyle.Render("Enable HTTP validation in addition to DNS (default: false)")))
 	b.WriteString("\n")
-	b.WriteString(sectionStyle.Render(flagStyle.Render("-w, -workers") + " " + descStyle.Render("<n>         Concurrent validation workers (default: 100)")))
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--mx") + "                     " + descStyle.Render("Require MX records; with -dns=false, instead of A/AAAA/CNAME")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--retry-servfail") + "         " + descStyle.Render("Retry SERVFAIL lookups on another resolver (default: true)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--dns-retries") + " " + descStyle.Render("<n>       Other resolvers tried on timeout or SERVFAIL (default: 1)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--dns-records") + " " + descStyle.Render("<list>    Record types that count: a, aaaa, cname (default: all)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--ignore-ips") + " " + descStyle.Render("<list>     Block-page addresses that don't count as resolving ('none' disables)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--second-pass") + "            " + descStyle.Render("Recheck timed-out/SERVFAIL domains before dropping them")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--require-apex-and-www") + "   " + descStyle.Render("Strict: both domain and www. variant must resolve")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--wildcard-check") + "         " + descStyle.Render("HTTP-check domains under wildcard-resolving TLDs (default: true)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--detect-wildcard") + "        " + descStyle.Render("Drop subdomains answered by a parent's wildcard DNS")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--dead-tlds") + " " + descStyle.Render("<list>     TLDs marked invalid without a lookup ('none' disables the built-in list)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--http-targeted") + "          " + descStyle.Render("HTTP-check only risky domains, trust DNS for the rest")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--http-risk-sample") + " " + descStyle.Render("<pct> Share of common-TLD domains still HTTP-checked (default: 0)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("-w, -workers") + " " + descStyle.Render("<n|auto>    Concurrent validation workers (default: 100)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--resolver-qps") + " " + descStyle.Render("<n>     Per-resolver query rate -workers auto aims for (default: 500)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--overlap") + "                " + descStyle.Render("Validate domains while sources are still being fetched")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--ramp") + " " + descStyle.Render("<dur>            Start workers in waves over this period (default: 0, all at once)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--http-workers") + " " + descStyle.Render("<n>     Max concurrent HTTP checks (default: 0, same as -workers)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--http-accept") + " " + descStyle.Render("<codes>   Status codes that pass the HTTP check (default: below 500)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--http-deadline") + " " + descStyle.Render("<dur>   Time budget for HTTP checks (default: 0, no limit)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--http-deadline-policy") + " " + descStyle.Render("<p> accept or reject domains left unchecked (default: accept)")))
 	b.WriteString("\n")
 	b.WriteString(sectionStyle.Render(flagStyle.Render("-r, -resolvers") + " " + descStyle.Render("<list>    Comma-separated DNS resolvers (default: Cloudflare, Google, Quad9)")))
 	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--resolver-strategy") + " " + descStyle.Render("<s> roundrobin, or hash to pin each domain to one resolver")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--bulk-resolver") + " " + descStyle.Render("<url>    Resolve through a bulk HTTP endpoint in batches")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--bulk-batch") + " " + descStyle.Render("<n>         Domains per bulk request (default: 500)")))
+	b.WriteString("\n")
 
 	// Performance
 	b.WriteString(headerStyle.Render("PERFORMANCE:"))
 	b.WriteString("\n")
 	b.WriteString(sectionStyle.Render(flagStyle.Render("-f, -fetch-workers") + " " + descStyle.Render("<n> Concurrent URL fetchers (default: 5)")))
 	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--fetch-adaptive") + "         " + descStyle.Render("Back off fetchers while fetches fail, ramp up as they recover")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--fetch-workers-min") + " " + descStyle.Render("<n> Fewest fetchers with --fetch-adaptive (default: 1)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--fetch-workers-max") + " " + descStyle.Render("<n> Most fetchers with --fetch-adaptive (default: --fetch-workers)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--parse-workers") + " " + descStyle.Render("<n>    Separate parse pool so fetchers keep downloading (default: 0, inline)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--per-host-limit") + " " + descStyle.Render("<n>   Concurrent requests per hostname (default: 0, unlimited)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--per-host-rate") + " " + descStyle.Render("<r>    Requests per second per hostname (default: 0, unlimited)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--retry-failed") + "           " + descStyle.Render("Retry failed sources once before counting the failure")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--retry-failed-delay") + " " + descStyle.Render("<d>  Wait before the retry pass (default: 30s)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--max-size") + " " + descStyle.Render("<bytes>      Largest download per source (default: 100MB)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--user-agent") + " " + descStyle.Render("<ua>       User-Agent for fetches (default: Magpie/1.0)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--proxy") + " " + descStyle.Render("<url>           Proxy for all HTTP traffic (default: from environment)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--connectivity-check") + " " + descStyle.Render("<m> Connection check: dns, http or none (default: dns)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--connectivity-url") + " " + descStyle.Render("<url> Probe URL for the http check, expects 200/204")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--probe-hosts") + " " + descStyle.Render("<h,h>     DNS servers for the dns check (default: 1.1.1.1, 8.8.8.8, 9.9.9.9)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--header") + " " + descStyle.Render("\"K: V\"         Extra request header, repeatable")))
+	b.WriteString("\n")
 	b.WriteString(sectionStyle.Render(flagStyle.Render("-c, -cache") + "               " + descStyle.Render("Enable DNS caching with 5min TTL (default: true)")))
 	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--cache-ttl-aware") + "        " + descStyle.Render("Cache results for their real DNS TTL (default: false)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--cache-max-ttl") + " " + descStyle.Render("<d>     Cap for TTL-aware cache entries (default: 1h)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--cache-max") + " " + descStyle.Render("<n>         Maximum DNS cache entries (default: 500000)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--persist-cache") + "          " + descStyle.Render("Keep DNS cache entries across runs (default: true)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--domain-cache-ttl") + " " + descStyle.Render("<d>    Reuse DNS verdicts from earlier runs (e.g. 7d)")))
+	b.WriteString("\n")
 
 	// Stats & Filtering
 	b.WriteString(headerStyle.Render("STATS & FILTERING:"))
@@ -184,6 +572,38 @@ func printUsage() {
 	b.WriteString("\n")
 	b.WriteString(sectionStyle.Render(flagStyle.Render("--no-tracking") + "            " + descStyle.Render("Disable URL health tracking and auto-filtering")))
 	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--no-fetch-cache") + "         " + descStyle.Render("Always download sources in full (no ETag / Last-Modified)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--clear-fetch-cache") + "      " + descStyle.Render("Drop cached source bodies before fetching")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--min-interval") + " " + descStyle.Render("<dur>      Reuse sources fetched within this window, no request at all")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--max-per-tld") + " " + descStyle.Render("<n>       Maximum domains kept per TLD (default: unlimited)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--limit") + " " + descStyle.Render("<n>             Only validate the first n domains, for test runs (default: 0, all)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--allowlist") + " " + descStyle.Render("<file>      Domains never to block, including their subdomains")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--include") + " " + descStyle.Render("<regex>       Keep only domains matching the pattern (repeatable)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--exclude") + " " + descStyle.Render("<regex>       Drop domains matching the pattern (repeatable)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--collapse-subdomains") + "    " + descStyle.Render("Drop subdomains already covered by a listed parent")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--wildcards") + "              " + descStyle.Render("Write .example.com source entries as wildcards (plain: *.example.com)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--master") + " " + descStyle.Render("<file>         Skip domains already in this master list (bloom filter)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--bloom-size") + " " + descStyle.Render("<n>        Master domains the filter is sized for (default: 2M)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--new-source-grace") + " " + descStyle.Render("<n>  Extra failures before blacklisting a never-worked source (default: 2)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--failure-decay") + " " + descStyle.Render("<d>     Forgive one source failure per period, retrying blacklisted sources (default: 24h, 0 = never)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--first-seen") + "             " + descStyle.Render("Track when each output domain first appeared")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--newly-seen-days") + " " + descStyle.Render("<n>   Write domains first seen within N days to newly-seen.txt")))
+	b.WriteString("\n")
 
 	// Options
 	b.WriteString(headerStyle.Render("OPTIONS:"))
@@ -194,8 +614,60 @@ func printUsage() {
 	b.WriteString("\n")
 	b.WriteString(sectionStyle.Render(flagStyle.Render("-v, -version") + "             " + descStyle.Render("Show version information")))
 	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--config") + " " + descStyle.Render("<file>         Settings from a YAML or TOML file; flags override it")))
+	b.WriteString("\n")
 	b.WriteString(sectionStyle.Render(flagStyle.Render("--stats") + "                  " + descStyle.Render("Display stats table and exit")))
 	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--stats-json") + " " + descStyle.Render("<file>     Write the full stats data as JSON and exit ('-' for stdout)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--prune-stats") + "            " + descStyle.Render("Remove stats of sources no longer in --source, then exit")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--prune-age") + " " + descStyle.Render("<dur>      With --prune-stats, also sources not checked within the window")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--since") + " " + descStyle.Render("<dur>          With --stats, only sources checked within the window (e.g. 7d)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--sort-stats") + " " + descStyle.Render("<by>       Order --stats by name, reliability, lastchecked or contribution")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--reset") + " " + descStyle.Render("<url>          Un-blacklist a source and reset its failures, then exit (repeatable)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--reset-all") + "              " + descStyle.Render("Un-blacklist every source and reset all failures, then exit")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--merge-stats") + " " + descStyle.Render("<dirs>    Merge stats.json from several data-dirs and display them")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--merge-policy") + " " + descStyle.Render("<p>      Blacklist conflicts: recent, majority, any (default: recent)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--merge-output") + " " + descStyle.Render("<dir>    Write the merged stats.json instead of displaying it")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--dedupe-only") + " " + descStyle.Render("<files>   Count unique domains across local files, then exit")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--explain") + " " + descStyle.Render("<domain>      Trace why a domain passes or fails validation, then exit")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--max-errors-display") + " " + descStyle.Render("<n> Errors shown in the summary (default: 3)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--error-log") + " " + descStyle.Render("<file>      Write all fetch errors, untruncated, to a file")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--error-report") + " " + descStyle.Render("<file>   Failed sources with error and failure count (CSV, or JSON for .json)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--invalid-log") + " " + descStyle.Render("<file>    Write dropped domains and why (dead, dns_only_alive) as NDJSON")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--debug") + "                  " + descStyle.Render("Log the lookups behind every failed domain (stderr or --log-file)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--log-file") + " " + descStyle.Render("<file>       Append the --debug traces to this file")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--debug-sample") + " " + descStyle.Render("<n>      Trace only 1 in n failed domains (default: 1)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--log-format") + " " + descStyle.Render("<fmt>      Log lines as text or json, without the TUI (default: text)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--keep-on-empty") + "          " + descStyle.Render("Keep the existing output if no domains are found; exit code 3")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--fail-threshold") + " " + descStyle.Render("<pct> Exit code 4 if more sources failed than this (default: 50)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--metrics, --prom-textfile") + " " + descStyle.Render("<file>  Write run metrics for node_exporter's textfile collector")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--json-summary") + " " + descStyle.Render("<file>   Write a JSON run summary at the end ('-' for stdout)")))
+	b.WriteString("\n")
+	b.WriteString(sectionStyle.Render(flagStyle.Render("--dry-run") + "                " + descStyle.Render("Fetch and validate, but write no output, stats or cache files")))
+	b.WriteString("\n")
 	b.WriteString(sectionStyle.Render(flagStyle.Render("-h, --help") + "               " + descStyle.Render("Show this help message")))
 	b.WriteString("\n")
 
@@ -241,16 +713,157 @@ type AggregationStats struct {
 	DuplicatesFound int
 	Errors          []string
 	FilteredURLs    []string
+	// NewlyBlacklisted holds sources that crossed the failure threshold this run
+	NewlyBlacklisted []string
+	// Allowlisted counts domains removed by -allowlist
+	Allowlisted int
+	// NotIncluded counts domains that matched no -include pattern
+	NotIncluded int
+	// Excluded counts the domains each -exclude pattern removed, in flag order
+	Excluded []int
+
+	// Collapsed counts subdomains dropped by -collapse-subdomains
+	Collapsed int
+	// InMaster counts domains skipped because the -master list already has them
+	InMaster int
+	// VerdictsReused counts domains whose DNS lookup was answered by -domain-cache-ttl
+	VerdictsReused int
+	// TLDsCapped maps TLDs that hit -max-per-tld to the number of domains dropped
+	TLDsCapped map[string]int
+	// Limited counts domains dropped by -limit
+	Limited int
+	// HTTPChecked and DNSTrusted split HTTP validation work in targeted mode
+	HTTPChecked int
+	DNSTrusted  int
+	// DeadTLDSkipped counts domains marked invalid by the known-dead TLD list without a lookup
+	DeadTLDSkipped int
+	// WildcardTLDs lists TLDs found to wildcard-resolve; WildcardChecked counts the
+	// DNS-valid domains under them that were HTTP-checked instead of trusted
+	WildcardTLDs    []string
+	WildcardChecked int
+	// WildcardSubdomains counts subdomains dropped by -detect-wildcard
+	WildcardSubdomains int
+	// NoMX counts domains dropped by -mx for having no MX records
+	NoMX int
+	// SecondPassChecked counts domains rechecked after an inconclusive DNS result;
+	// SecondPassRescued counts those that turned out valid
+	SecondPassChecked int
+	SecondPassRescued int
+	// HTTPDeadlineSkipped counts DNS-valid domains whose HTTP check was skipped by -http-deadline
+	HTTPDeadlineSkipped int
+	// DNSOnlyAlive counts dropped domains that resolve but don't serve HTTP
+	DNSOnlyAlive int
+	// RunDelta summarizes changes versus the previous run's global stats
+	RunDelta string
+	// Notes are one-line reports from optional processing steps
+	Notes []string
+	// Failures lists the sources that failed to fetch with their errors
+	Failures []sourceFailure
+	// ConnectDuration, FetchDuration, ValidationDuration and WriteDuration time the stages of the run
+	ConnectDuration    time.Duration
+	FetchDuration      time.Duration
+	ValidationDuration time.Duration
+	WriteDuration      time.Duration
+}
+
+// recordTimings copies the stage timings into the run's global stats
+func (a *AggregationStats) recordTimings(global *stats.GlobalStats) {
+	global.ConnectSeconds = a.ConnectDuration.Seconds()
+	global.FetchSeconds = a.FetchDuration.Seconds()
+	global.ValidationSeconds = a.ValidationDuration.Seconds()
+	global.WriteSeconds = a.WriteDuration.Seconds()
 }
 
 func main() {
 	flag.Parse()
+	runStart = time.Now()
+
+	if configFile != "" {
+		if err := loadConfigFile(configFile); err != nil {
+			log.Fatalf("Invalid -config: %v", err)
+		}
+	}
 
 	if showVer {
 		fmt.Printf("Magpie version %s\n", version)
 		return
 	}
 
+	// Reuse needs the cached copies and each source's last fetch time
+	if minInterval > 0 && (noFetchCache || noTracking) {
+		log.Fatalf("-min-interval needs the fetch cache and source tracking; drop -no-fetch-cache / -no-tracking")
+	}
+
+	// A dry run reads the data directory but must leave every file untouched
+	if dryRun {
+		errorLogFile, errorReport, invalidLog, manifestPath, promTextfile = "", "", "", "", ""
+		noFetchCache, persistCache = true, false
+		if jsonSummary != "-" {
+			jsonSummary = ""
+		}
+	}
+
+	// Keep stdout for the JSON alone; the TUI, logo and results box go to stderr
+	if jsonSummary == "-" {
+		os.Stdout = os.Stderr
+		color.Output = os.Stderr
+	}
+
+	if proxyURL != "" {
+		proxy, err := netutil.ParseProxy(proxyURL)
+		if err != nil {
+			log.Fatalf("Invalid -proxy: %v", err)
+		}
+		proxyOverride = proxy
+	}
+
+	if failThreshold < 0 || failThreshold > 100 {
+		log.Fatalf("Invalid -fail-threshold %g: must be a percentage from 0 to 100", failThreshold)
+	}
+
+	if httpAccept != "" {
+		rule, err := validator.ParseStatusRule(httpAccept)
+		if err != nil {
+			log.Fatalf("Invalid -http-accept: %v", err)
+		}
+		acceptStatus = rule
+	}
+
+	if err := netutil.SetConnectivityCheck(connectivityCheck, connectivityURL, proxyOverride); err != nil {
+		log.Fatalf("Invalid -connectivity-check: %v", err)
+	}
+	if probeHosts != "" {
+		if err := netutil.SetProbeHosts(strings.Split(probeHosts, ",")); err != nil {
+			log.Fatalf("Invalid -probe-hosts: %v", err)
+		}
+	}
+
+	if !slices.Contains(statsSortOrders, sortStats) {
+		log.Fatalf("Unknown -sort-stats %q (use %s)", sortStats, strings.Join(statsSortOrders, ", "))
+	}
+
+	// Un-blacklist sources and exit if requested
+	if resetAll || len(resetURLs) > 0 {
+		runReset()
+		return
+	}
+
+	// Merge stats from several hosts and exit if requested
+	if mergeStats != "" {
+		runMergeStats()
+		return
+	}
+
+	// Export or prune the stats and exit if requested
+	if statsJSON != "" {
+		runStatsJSON()
+		return
+	}
+	if pruneStats {
+		runPruneStats()
+		return
+	}
+
 	// Show stats and exit if requested
 	if showStats {
 		dataPath, err := filepath.Abs(dataDir)
@@ -258,12 +871,31 @@ func main() {
 			log.Fatalf("Failed to resolve data directory: %v", err)
 		}
 
+		since, err := parseSince(statsSince)
+		if err != nil {
+			log.Fatalf("Invalid -since value: %v", err)
+		}
+
 		tracker, err := stats.NewTracker(dataPath)
 		if err != nil {
 			log.Fatalf("Failed to load stats: %v", err)
 		}
+		tracker.NewSourceGrace = newSourceGrace
+		tracker.FailureDecay = failureDecay
 
-		displayStatsTable(tracker)
+		displayStatsTable(tracker, since)
+		return
+	}
+
+	// Count unique domains across local files and exit if requested
+	if dedupeOnly != "" {
+		runDedupeOnly()
+		return
+	}
+
+	// Trace a single domain through validation and exit if requested
+	if explainDomain != "" {
+		runExplain(explainDomain)
 		return
 	}
 
@@ -273,46 +905,226 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Waiting for a list typed at the prompt (or fighting the TUI for its keys) is never intended
+	if sourceFile == "-" && term.IsTerminal(int(os.Stdin.Fd())) {
+		log.Fatalf("-source - reads the URLs from stdin, but stdin is a terminal; pipe the list in (e.g. cat sources.txt | magpie -s -)")
+	}
+
+	if httpDeadlinePolicy != "accept" && httpDeadlinePolicy != "reject" {
+		log.Fatalf("Unknown -http-deadline-policy %q (use accept or reject)", httpDeadlinePolicy)
+	}
+
+	if _, ok := outputFormats[outputFormat]; !ok {
+		log.Fatalf("Unknown -format %q (use %s)", outputFormat, strings.Join(magpie.FormatNames(), ", "))
+	}
+
+	if !slices.Contains(magpie.SortOrders, sortOrder) {
+		log.Fatalf("Unknown -sort %q (use %s)", sortOrder, strings.Join(magpie.SortOrders, ", "))
+	}
+
+	if !slices.Contains(validator.ResolverStrategies, resolverOrder) {
+		log.Fatalf("Unknown -resolver-strategy %q (use %s)", resolverOrder, strings.Join(validator.ResolverStrategies, ", "))
+	}
+	if resolverQPS <= 0 {
+		log.Fatalf("-resolver-qps must be more than 0, got %v", resolverQPS)
+	}
+	records, err := validator.ParseRecordSet(dnsRecordList)
+	if err != nil {
+		log.Fatalf("Invalid -dns-records: %v", err)
+	}
+	dnsRecords = records
+	if fetchAdaptive {
+		if fetchWorkersMax == 0 {
+			fetchWorkersMax = max(fetchWorkers, fetchWorkersMin)
+		}
+		if fetchWorkersMin < 1 || fetchWorkersMax < fetchWorkersMin {
+			log.Fatalf("-fetch-workers-min and -fetch-workers-max need 1 <= min <= max, got %d and %d", fetchWorkersMin, fetchWorkersMax)
+		}
+	}
+	if list := strings.TrimSpace(ignoreIPList); list != "" && !strings.EqualFold(list, "none") {
+		if ignoreIPs, err = validator.NewIPSet(strings.Split(list, ",")); err != nil {
+			log.Fatalf("Invalid -ignore-ips: %v", err)
+		}
+	}
+	resolveWorkers()
+	if dnsRetries < 0 {
+		log.Fatalf("-dns-retries must be 0 or more, got %d", dnsRetries)
+	}
+	if !slices.Contains(logFormats, logFormat) {
+		log.Fatalf("Unknown -log-format %q (use %s)", logFormat, strings.Join(logFormats, ", "))
+	}
+	if debugSample < 1 {
+		log.Fatalf("-debug-sample must be 1 or more, got %d", debugSample)
+	}
+	if (debugLogFile != "" || debugSample > 1) && !debugMode {
+		log.Fatalf("-log-file and -debug-sample need -debug")
+	}
+
+	if appendOutput && groupBySource {
+		log.Fatalf("-append writes one sorted list and can't be combined with -group-by-source")
+	}
+
+	if unboundChunk < 0 {
+		log.Fatalf("-unbound-chunk must be 0 or more, got %d", unboundChunk)
+	}
+	if unboundChunk > 0 {
+		switch {
+		case outputFormat != "unbound":
+			log.Fatalf("-unbound-chunk needs -format unbound")
+		case appendOutput:
+			log.Fatalf("-unbound-chunk can't be combined with -append")
+		case groupBySource:
+			log.Fatalf("-unbound-chunk can't be combined with -group-by-source")
+		}
+	}
+
+	if overlapStages {
+		if conflict := overlapConflict(); conflict != "" {
+			log.Fatalf("-overlap validates domains before the fetch is complete and can't be combined with %s", conflict)
+		}
+	}
+
+	if streamOutput {
+		if conflict := streamConflict(); conflict != "" {
+			log.Fatalf("-stream-output writes domains as they validate and can't be combined with %s", conflict)
+		}
+	}
+	if listHeader {
+		addListHeader()
+	}
+	if wildcardOutput {
+		if err := addWildcards(); err != nil {
+			log.Fatalf("-wildcards: %v", err)
+		}
+	}
+
+	if !slices.Contains(zoneSerialStrategies, zoneSerialStrategy) {
+		log.Fatalf("Unknown -zone-serial %q (use %s)", zoneSerialStrategy, strings.Join(zoneSerialStrategies, ", "))
+	}
+
+	if bucketBy != "" {
+		if _, err := bucketKeys(); err != nil {
+			log.Fatalf("Invalid bucket settings: %v", err)
+		}
+	}
+
+	if allowlistFile != "" {
+		allow, err := loadAllowlist(allowlistFile)
+		if err != nil {
+			log.Fatalf("Invalid -allowlist: %v", err)
+		}
+		allowDomains = allow
+	}
+
+	if masterFile != "" {
+		filter, rebuilt, err := loadMasterFilter()
+		if err != nil {
+			log.Fatalf("Invalid -master: %v", err)
+		}
+		if rebuilt && !quiet && !silent {
+			log.Printf("Built master bloom filter from %s (%d domains)", masterFile, filter.Entries)
+		}
+		masterFilter = filter
+	}
+
+	if domainCacheTTL != "" {
+		if _, err := parseSince(domainCacheTTL); err != nil {
+			log.Fatalf("Invalid -domain-cache-ttl: %v", err)
+		}
+	}
+
+	// One run per data-dir at a time, so an overlapping cron job can't overwrite the
+	// stats of one still writing. Reported even with -silent, as cron mails stderr.
+	if !dryRun {
+		lockDataDir(dataDir)
+	}
+
 	// If silent mode, suppress all output
 	if silent {
 		// Redirect all output to /dev/null
 		log.SetOutput(io.Discard)
 		quiet = true
 	}
+	setupLogging()
 
 	// Check if running in TTY (interactive terminal)
 	isTTY := term.IsTerminal(int(os.Stdout.Fd()))
 
+	if debugMode {
+		// Traces on the terminal would tear up the TUI; 2>file or -log-file keeps them apart
+		if !quiet && !silent && isTTY && debugLogFile == "" && term.IsTerminal(int(os.Stderr.Fd())) {
+			log.Fatalf("-debug writes to stderr, which is the terminal the TUI draws on; add -log-file or redirect stderr (2>debug.log)")
+		}
+		traces, err := openDebugLog(debugLogFile)
+		if err != nil {
+			log.Fatalf("Failed to open -log-file: %v", err)
+		}
+		debugTraces = traces
+	}
+
+	// Ctrl+C or SIGTERM stops the workers; what was gathered so far is kept
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Use TUI for interactive terminals, fall back to logging for non-TTY
 	if !quiet && !silent && isTTY {
-		runWithTUI()
+		runWithTUI(ctx)
 	} else {
-		runWithLogs()
+		runWithLogs(ctx)
 	}
 }
 
-func runWithTUI() {
+func runWithTUI(ctx context.Context) {
 	// Initialize and run the TUI
 	model := ui.NewAppModel()
-	program := tea.NewProgram(model, tea.WithAltScreen())
+	options := []tea.ProgramOption{tea.WithAltScreen()}
+	if sourceFile == "-" {
+		// stdin carries the sources list, so keys come from the terminal itself
+		options = append(options, tea.WithInputTTY())
+	}
+	program := tea.NewProgram(model, options...)
+
+	// Set by the aggregation goroutine before it sends CompletionMsg
+	exitCode := 0
+	var summary *runSummary
+
+	// Quitting the TUI before the run completes interrupts it like Ctrl+C in log mode
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var completed atomic.Bool
+	var interruptNote string
+	finished := make(chan struct{})
+
+	// interrupted saves what the run gathered and stops the TUI
+	interrupted := func(stage string, tracker *stats.Tracker, validDomains []string) {
+		interruptNote = fmt.Sprintf("Interrupted while %s: %s", stage, saveInterrupted(tracker, validDomains))
+		exitCode = exitInterrupted
+		program.Quit()
+	}
 
 	// Run aggregation in background
 	go func() {
-		ctx := context.Background()
+		defer close(finished)
 
 		// Check internet connection
 		time.Sleep(500 * time.Millisecond) // Give UI time to render
-		if err := netutil.CheckConnectionWithRetry(ctx, true); err != nil {
+		connectStart := time.Now()
+		if _, err := netutil.CheckConnectionWithRetry(ctx, true); err != nil {
 			log.Fatalf("No internet connection: %v", err)
 		}
+		connectDuration := time.Since(connectStart)
 		program.Send(ui.ConnectionCheckedMsg{})
 
 		// Load URLs
 		time.Sleep(300 * time.Millisecond)
-		allURLs, err := loadURLs(sourceFile)
+		sources, err := loadURLs(sourceFile)
 		if err != nil {
 			log.Fatalf("Failed to load source file: %v", err)
 		}
+		allURLs := selectSources(sources, parseTags(sourceTags))
+		if len(allURLs) == 0 {
+			log.Fatalf("No source in %s is tagged with any of -tags %s", sourceFile, sourceTags)
+		}
 
 		// Initialize stats tracker
 		var tracker *stats.Tracker
@@ -329,6 +1141,8 @@ func runWithTUI() {
 			if err != nil {
 				log.Fatalf("Failed to initialize stats tracker: %v", err)
 			}
+			tracker.NewSourceGrace = newSourceGrace
+			tracker.FailureDecay = failureDecay
 
 			urls, filteredURLs = tracker.FilterURLs(allURLs)
 		} else {
@@ -347,117 +1161,371 @@ func runWithTUI() {
 			FetchWorkers: fetchWorkers,
 		})
 
-		// Fetch domains
-		time.Sleep(300 * time.Millisecond)
-		allDomains, duplicates, errors := fetchDomainsWithTUI(ctx, program, urls, tracker)
-
-		program.Send(ui.FetchCompleteMsg{
-			TotalDomains:      len(allDomains),
-			DuplicatesRemoved: duplicates,
-			Errors:            errors,
-		})
+		var notes []string
+
+		// The validator and the caches from the last run are set up before the fetch,
+		// which -overlap already validates during
+		var v *validator.Validator
+		if validating() {
+			v = newValidator()
+			if loaded, err := loadDNSCache(v); err != nil {
+				notes = append(notes, fmt.Sprintf("Warning: Failed to load DNS cache: %v", err))
+			} else if loaded > 0 {
+				notes = append(notes, fmt.Sprintf("DNS cache: %s unexpired results loaded from the last run", formatSize(loaded)))
+			}
+			if err := loadDomainVerdicts(); err != nil {
+				notes = append(notes, fmt.Sprintf("Warning: Failed to load domain cache: %v", err))
+			}
+		}
+		cfg := aggregateConfig(urls, tracker, v)
+		cfg.OnSource = func(source magpie.SourceProgress) {
+			program.Send(ui.FetchProgressMsg{
+				URL:          source.URL,
+				WorkerID:     source.WorkerID,
+				DomainsFound: source.Domains,
+				TotalDomains: source.Unique,
+				FetchedCount: source.Fetched,
+			})
+		}
 
-		time.Sleep(500 * time.Millisecond)
+		// With -overlap, validation starts with the fetch and is fed each new domain
+		overlapped := overlapStages && validating()
+		if overlapped {
+			if err := startValidStream(); err != nil {
+				log.Fatalf("Failed to write output: %v", err)
+			}
+			cfg.Skip = overlapSkip
+		}
+		cfg.OnValidationStart = func(total int) {
+			program.Send(ui.ValidationStartMsg{Total: total, Workers: workers})
+		}
+		cfg.OnValidationTotal = func(total int) {
+			program.Send(ui.ValidationTotalMsg{Total: total})
+		}
+		cfg.OnProgress = func(progress magpie.ValidationProgress) {
+			// Update TUI every 50 domains to reduce overhead
+			if progress.Checked%50 == 0 || progress.Checked == progress.Total {
+				program.Send(ui.ValidationProgressMsg{
+					Current: progress.Checked,
+					Valid:   progress.Valid,
+					Invalid: progress.Invalid,
+				})
+			}
+		}
 
-		// Validate domains
-		if enableDNS || enableHTTP {
-			program.Send(ui.ValidationStartMsg{
-				Total:   len(allDomains),
-				Workers: workers,
+		// Set once the fetch is done, to tell an interrupted fetch from an interrupted validation
+		var (
+			fetchDone        bool
+			newlyBlacklisted []string
+			summaryStats     *AggregationStats
+			prevGlobal       *stats.GlobalStats
+		)
+		cfg.OnFetched = func(fetched *magpie.Result) {
+			fetchDone = true
+			fetchErrors := failureMessages(fetched.Failures)
+			program.Send(ui.FetchCompleteMsg{
+				TotalDomains:      fetched.Found,
+				DuplicatesRemoved: fetched.Duplicates,
+				Errors:            fetchErrors,
 			})
 
-			resolvers := strings.Split(dnsResolvers, ",")
-			for i, r := range resolvers {
-				resolvers[i] = strings.TrimSpace(r)
+			if errorLogFile != "" {
+				if err := writeErrorLog(errorLogFile, fetchErrors); err != nil {
+					log.Printf("Warning: Failed to write error log: %v", err)
+				}
+			}
+			failures := sourceFailures(fetched.Failures)
+			if errorReport != "" {
+				if err := writeErrorReport(errorReport, failures, tracker); err != nil {
+					log.Printf("Warning: Failed to write error report: %v", err)
+				}
 			}
 
-			v := validator.NewValidatorWithResolvers(enableCache, resolvers)
-			validDomains, validCount, invalidCount := validateDomainsWithTUI(ctx, program, v, allDomains)
+			if tracker != nil {
+				newlyBlacklisted = tracker.NewlyBlacklisted()
+			}
 
-			program.Send(ui.ValidationDoneMsg{})
-			time.Sleep(300 * time.Millisecond)
+			// Counts for -json-summary, completed as the run goes on
+			summaryStats = &AggregationStats{
+				URLsFetched:      fetched.Fetched,
+				URLsFiltered:     len(filteredURLs),
+				DomainsFound:     fetched.Found,
+				DuplicatesFound:  fetched.Duplicates,
+				NewlyBlacklisted: newlyBlacklisted,
+				Failures:         failures,
+				ConnectDuration:  connectDuration,
+				FetchDuration:    fetched.FetchDuration,
+			}
 
-			// Write output
-			if err := writeOutput(outputFile, validDomains); err != nil {
-				log.Fatalf("Failed to write output: %v", err)
+			if fetched.Unchanged > 0 {
+				notes = append(notes, fmt.Sprintf("Not modified: %d sources served from the fetch cache", fetched.Unchanged))
 			}
+			if fetched.Reused > 0 {
+				notes = append(notes, fmt.Sprintf("Min interval: %d sources reused without a request", fetched.Reused))
+			}
+			if fetched.InMaster > 0 {
+				notes = append(notes, masterNote(fetched.InMaster))
+			}
+		}
 
-			// Save stats with global metrics
-			if tracker != nil {
-				validationMethod := "dns"
-				if enableHTTP {
-					validationMethod = "dns+http"
+		cfg.Filter = func(allDomains map[string]struct{}) {
+			if removed := applyAllowlist(allDomains, allowDomains); removed > 0 {
+				notes = append(notes, fmt.Sprintf("Allowlist: %s domains removed", formatSize(removed)))
+			}
+			if patternsEnabled() {
+				notIncluded, excluded := applyPatterns(allDomains)
+				notes = append(notes, "Patterns: "+formatPatternCounts(notIncluded, excluded))
+			}
+			if maxPerTLD > 0 {
+				if capped := capPerTLD(allDomains, maxPerTLD); len(capped) > 0 {
+					notes = append(notes, fmt.Sprintf("TLDs capped at %d: %s", maxPerTLD, formatCappedTLDs(capped)))
 				}
+			}
+			if domainLimit > 0 {
+				if limited := limitDomains(allDomains, domainLimit); limited > 0 {
+					notes = append(notes, fmt.Sprintf("Limit: first %s domains kept, %s left out", formatSize(domainLimit), formatSize(limited)))
+				}
+			}
+
+			time.Sleep(500 * time.Millisecond)
+
+			// Capture last run's totals before they are overwritten
+			if tracker != nil {
+				prevGlobal = tracker.LastGlobalStats()
+			}
 
-				// Record global stats from this run
-				tracker.RecordGlobalStats(
-					len(urls),              // URLs fetched
-					len(errors),            // URLs failed
-					len(allDomains)+duplicates, // Raw domains (including duplicates)
-					len(allDomains),        // Unique domains
-					duplicates,             // Duplicates removed
-					validCount,             // Valid domains
-					invalidCount,           // Invalid domains
-					validationMethod,
-				)
-
-				if err := tracker.Save(); err != nil {
-					log.Printf("Warning: Failed to save stats: %v", err)
+			if !overlapped {
+				if err := startValidStream(); err != nil {
+					log.Fatalf("Failed to write output: %v", err)
 				}
 			}
+		}
 
+		// Fetch and validate domains
+		time.Sleep(300 * time.Millisecond)
+		fetched, err := magpie.Aggregate(ctx, cfg)
+		saveFetchCache(cfg)
+		if fetched != nil {
+			listSources = fetchedSources(urls, fetched.SourceDomains)
+			wildcardDomains = fetched.Subdomains
+		}
+		switch {
+		case err != nil && ctx.Err() != nil:
+			if !fetchDone {
+				interrupted("fetching", tracker, fetched.Domains)
+				return
+			}
+		case errors.Is(err, magpie.ErrNoDomains) && keepOnEmpty:
+			discardValidStream()
+			recordEmptyRun(tracker)
+			exitCode = exitEmptyResult
+			summaryStats.Notes = []string{"No domains found from any source - kept the existing output file"}
+			summary = newRunSummary(summaryStats, len(allURLs), 0, "none")
+			completed.Store(true)
 			program.Send(ui.CompletionMsg{
-				OutputFile: outputFile,
-				Valid:      validCount,
-				Invalid:    invalidCount,
+				OutputFile:       outputFile,
+				NewlyBlacklisted: newlyBlacklisted,
+				Notes:            []string{"No domains found from any source - kept the existing output file"},
 			})
-		} else {
-			// No validation - write all domains
-			validDomains := make([]string, 0, len(allDomains))
-			for domain := range allDomains {
-				validDomains = append(validDomains, domain)
+			time.Sleep(2 * time.Second)
+			return
+		case errors.Is(err, magpie.ErrNoDomains):
+			// Without -keep-on-empty the empty result replaces the output
+		case err != nil:
+			log.Fatalf("Aggregation failed: %v", err)
+		}
+		allDomains, duplicates, fetchErrors := fetched.Unique, fetched.Duplicates, failureMessages(fetched.Failures)
+		validDomains, validCount, invalidCount := fetched.Domains, fetched.Valid, fetched.Invalid
+
+		// Validation results
+		validationMethod := "none"
+
+		if validating() {
+			summaryStats.ValidationDuration = fetched.ValidationDuration
+			if err := saveDNSCache(v); err != nil {
+				notes = append(notes, fmt.Sprintf("Warning: Failed to save DNS cache: %v", err))
+			}
+			if err := saveDomainVerdicts(); err != nil {
+				notes = append(notes, fmt.Sprintf("Warning: Failed to save domain cache: %v", err))
+			}
+			if domainVerdicts != nil {
+				notes = append(notes, fmt.Sprintf("Domain cache: %s domains reused an earlier DNS verdict", formatSize(domainVerdicts.Hits())))
+			}
+			if enableHTTP && httpTargeted {
+				notes = append(notes, fmt.Sprintf("Targeted HTTP: %s HTTP-checked, %s DNS-trusted",
+					formatSize(fetched.HTTPChecked), formatSize(fetched.DNSTrusted)))
+			}
+			if fetched.DeadTLDSkipped > 0 {
+				notes = append(notes, fmt.Sprintf("Dead TLDs: %s domains marked invalid without a lookup", formatSize(fetched.DeadTLDSkipped)))
+			}
+			if fetched.SecondPassChecked > 0 {
+				notes = append(notes, fmt.Sprintf("Second pass: %s of %s inconclusive domains rescued",
+					formatSize(fetched.SecondPassRescued), formatSize(fetched.SecondPassChecked)))
+			}
+			if len(fetched.WildcardTLDs) > 0 {
+				notes = append(notes, fmt.Sprintf("Wildcard TLDs (%s): %s domains HTTP-checked",
+					formatWildcardTLDs(fetched.WildcardTLDs), formatSize(fetched.WildcardChecked)))
+			}
+			if fetched.WildcardSubdomains > 0 {
+				notes = append(notes, fmt.Sprintf("Wildcard parents: %s subdomains dropped", formatSize(fetched.WildcardSubdomains)))
+			}
+			if fetched.NoMX > 0 {
+				notes = append(notes, fmt.Sprintf("No MX records: %s domains dropped", formatSize(fetched.NoMX)))
+			}
+			if fetched.DNSOnlyAlive > 0 {
+				notes = append(notes, fmt.Sprintf("DNS-alive but HTTP-dead: %s domains dropped", formatSize(fetched.DNSOnlyAlive)))
+			}
+			if err := writeInvalidLog(fetched.InvalidDomains); err != nil {
+				notes = append(notes, fmt.Sprintf("Warning: Failed to write invalid log: %v", err))
+			} else if invalidLog != "" {
+				notes = append(notes, fmt.Sprintf("Invalid log: %s dropped domains written to %s", formatSize(len(fetched.InvalidDomains)), invalidLog))
+			}
+			if fetched.HTTPDeadlineSkipped > 0 {
+				notes = append(notes, fmt.Sprintf("HTTP deadline: %s DNS-valid domains not HTTP-checked (%sed)",
+					formatSize(fetched.HTTPDeadlineSkipped), httpDeadlinePolicy))
 			}
 
-			if err := writeOutput(outputFile, validDomains); err != nil {
-				log.Fatalf("Failed to write output: %v", err)
+			validationMethod = validationMethodName()
+
+			program.Send(ui.ValidationDoneMsg{})
+			time.Sleep(300 * time.Millisecond)
+		}
+
+		if ctx.Err() != nil {
+			interrupted("validating", tracker, validDomains)
+			return
+		}
+
+		if delta := formatRunDelta(prevGlobal, len(allDomains), validCount); delta != "" {
+			notes = append(notes, delta)
+		}
+
+		if collapseSubs || wildcardOutput {
+			var collapsed int
+			validDomains, collapsed = collapseCovered(validDomains)
+			if collapsed > 0 {
+				notes = append(notes, fmt.Sprintf("Collapsed subdomains: %s entries covered by a listed parent", formatSize(collapsed)))
 			}
+		}
 
-			if tracker != nil {
-				// Record global stats from this run (no validation)
-				tracker.RecordGlobalStats(
-					len(urls),              // URLs fetched
-					len(errors),            // URLs failed
-					len(allDomains)+duplicates, // Raw domains (including duplicates)
-					len(allDomains),        // Unique domains
-					duplicates,             // Duplicates removed
-					len(validDomains),      // Valid domains (all)
-					0,                      // Invalid domains (none)
-					"none",
-				)
-
-				if err := tracker.Save(); err != nil {
-					log.Printf("Warning: Failed to save stats: %v", err)
+		magpie.SortDomains(validDomains, sortOrder)
+
+		// Write output
+		written := len(validDomains)
+		writeStart := time.Now()
+		if !dryRun {
+			if diffOutput {
+				if note, err := writeDiff(validDomains); err != nil {
+					notes = append(notes, fmt.Sprintf("Warning: Failed to write diff: %v", err))
+				} else {
+					notes = append(notes, note)
 				}
 			}
+			var err error
+			written, err = writeMainOutput(validDomains, fetched.Attribution)
+			if err != nil {
+				log.Fatalf("Failed to write output: %v", err)
+			}
+			if appendOutput {
+				notes = append(notes, appendNote(len(validDomains), written))
+			}
+			notes = append(notes, processExtraOutputs(validDomains, written)...)
+		}
+		summaryStats.WriteDuration = time.Since(writeStart)
+
+		// Save stats with global metrics from this run
+		global := stats.NewGlobalStats(
+			len(urls),                  // URLs fetched
+			len(fetchErrors),           // URLs failed
+			len(allDomains)+duplicates, // Raw domains (including duplicates)
+			len(allDomains),            // Unique domains
+			duplicates,                 // Duplicates removed
+			validCount,                 // Valid domains
+			invalidCount,               // Invalid domains
+			validationMethod,
+		)
+		global.DurationSeconds = time.Since(runStart).Seconds()
+		summaryStats.recordTimings(global)
+
+		if tracker != nil && !dryRun {
+			tracker.RecordGlobal(global)
+
+			if err := tracker.Save(); err != nil {
+				log.Printf("Warning: Failed to save stats: %v", err)
+			}
+		}
 
-			program.Send(ui.CompletionMsg{
-				OutputFile: outputFile,
-				Valid:      len(validDomains),
-				Invalid:    0,
-			})
+		if promTextfile != "" {
+			if err := stats.WritePromTextfile(promTextfile, global, fetched.SourceDomains); err != nil {
+				log.Printf("Warning: Failed to write Prometheus textfile: %v", err)
+			}
 		}
 
+		summaryStats.DomainsValid = validCount
+		summaryStats.DomainsInvalid = invalidCount
+		summaryStats.Notes = notes
+		summary = newRunSummary(summaryStats, len(allURLs), written, validationMethod)
+
+		if tooManyFailures(len(fetchErrors), len(urls)) {
+			notes = append(notes, failThresholdNote(len(fetchErrors), len(urls)))
+			exitCode = exitSourceFailures
+		}
+
+		completed.Store(true)
+		program.Send(ui.CompletionMsg{
+			OutputFile:       outputFile,
+			DryRun:           dryRun,
+			Valid:            validCount,
+			Invalid:          invalidCount,
+			NewlyBlacklisted: newlyBlacklisted,
+			Notes:            notes,
+		})
+
 		time.Sleep(2 * time.Second)
 	}()
 
 	if _, err := program.Run(); err != nil {
 		log.Fatalf("Error running TUI: %v", err)
 	}
+	if !completed.Load() {
+		cancel()
+		<-finished
+	}
+	if interruptNote != "" {
+		log.Printf("%s", interruptNote)
+	}
+	if summary != nil && jsonSummary != "" {
+		if err := writeRunSummary(summary); err != nil {
+			log.Printf("Warning: Failed to write JSON summary: %v", err)
+		}
+	}
+	if exitCode != 0 {
+		os.Exit(exitCode)
+	}
+}
+
+// tooManyFailures reports whether the failed share of the attempted sources exceeds -fail-threshold
+func tooManyFailures(failed, attempted int) bool {
+	return attempted > 0 && float64(failed)*100 > failThreshold*float64(attempted)
 }
 
-func runWithLogs() {
-	ctx := context.Background()
+// failThresholdNote explains an exitSourceFailures exit
+func failThresholdNote(failed, attempted int) string {
+	return fmt.Sprintf("%d of %d sources failed, more than -fail-threshold %g%%: exit code %d", failed, attempted, failThreshold, exitSourceFailures)
+}
+
+// recordEmptyRun books a run that found no domains in the stats tracker
+func recordEmptyRun(tracker *stats.Tracker) {
+	if tracker == nil || dryRun {
+		return
+	}
+	tracker.RecordEmptyRun()
+	if err := tracker.Save(); err != nil {
+		log.Printf("Warning: Failed to save stats: %v", err)
+	}
+}
 
+func runWithLogs(ctx context.Context) {
 	if !quiet {
 		fmt.Print(logo)
 		log.Printf("Starting aggregation from %s", sourceFile)
@@ -465,20 +1533,34 @@ func runWithLogs() {
 
 	// Check internet connection before starting
 	if !quiet {
-		log.Printf("Checking internet connection...")
+		if connectivityCheck == netutil.CheckNone {
+			log.Printf("Skipping internet connection check (-connectivity-check none)")
+		} else {
+			log.Printf("Checking internet connection...")
+		}
 	}
-	if err := netutil.CheckConnectionWithRetry(ctx, quiet); err != nil {
+	connectStart := time.Now()
+	stack, err := netutil.CheckConnectionWithRetry(ctx, quiet)
+	if err != nil {
 		log.Fatalf("No internet connection: %v", err)
 	}
-	if !quiet {
-		log.Printf("✓ Internet connection verified")
+	if !quiet && connectivityCheck != netutil.CheckNone {
+		log.Printf("✓ Internet connection verified (%s)", stack)
 	}
+	connectDuration := time.Since(connectStart)
 
 	// Load URLs
-	allURLs, err := loadURLs(sourceFile)
+	sources, err := loadURLs(sourceFile)
 	if err != nil {
 		log.Fatalf("Failed to load source file: %v", err)
 	}
+	allURLs := selectSources(sources, parseTags(sourceTags))
+	if len(allURLs) == 0 {
+		log.Fatalf("No source in %s is tagged with any of -tags %s", sourceFile, sourceTags)
+	}
+	if sourceTags != "" && !quiet {
+		log.Printf("-tags %s selected %d of %d sources", sourceTags, len(allURLs), len(sources))
+	}
 
 	// Initialize stats tracker
 	var tracker *stats.Tracker
@@ -496,6 +1578,8 @@ func runWithLogs() {
 		if err != nil {
 			log.Fatalf("Failed to initialize stats tracker: %v", err)
 		}
+		tracker.NewSourceGrace = newSourceGrace
+		tracker.FailureDecay = failureDecay
 
 		// Filter out blacklisted URLs
 		urls, filteredURLs = tracker.FilterURLs(allURLs)
@@ -510,13 +1594,13 @@ func runWithLogs() {
 					}
 				}
 			}
-			log.Printf("Processing %d active URLs with %d parallel fetchers", len(urls), fetchWorkers)
+			log.Printf("Processing %d active URLs with %s", len(urls), describeFetchers())
 		}
 	} else {
 		urls = allURLs
 		if !quiet {
 			log.Printf("Loaded %d source URLs (tracking disabled)", len(urls))
-			log.Printf("Using %d parallel fetchers", fetchWorkers)
+			log.Printf("Using %s", describeFetchers())
 		}
 	}
 
@@ -526,377 +1610,406 @@ func runWithLogs() {
 
 	// Fetch domains with parallel workers and streaming
 	aggregationStats := &AggregationStats{
-		FilteredURLs: filteredURLs,
-		URLsFiltered: len(filteredURLs),
-	}
-	allDomains := make(map[string]bool)
-	domainChan := make(chan string, 10000) // Buffered channel for streaming
-	errorChan := make(chan error, len(urls))
-
-	f := fetcher.NewFetcher(30*time.Second, 3)
-
-	// Start parallel fetchers
-	var fetchWg sync.WaitGroup
-	urlChan := make(chan string, len(urls))
-
-	// Start fetch workers
-	for i := 0; i < fetchWorkers; i++ {
-		fetchWg.Add(1)
-		go func(workerID int) {
-			defer fetchWg.Done()
-			for url := range urlChan {
-				if !quiet {
-					log.Printf("[Worker %d] Fetching %s", workerID, url)
-				}
+		FilteredURLs:    filteredURLs,
+		URLsFiltered:    len(filteredURLs),
+		ConnectDuration: connectDuration,
+	}
 
-				domains, err := f.Fetch(ctx, url)
-				if err != nil {
-					// Check if it's a connection error and wait for internet
-					if strings.Contains(err.Error(), "dial") || strings.Contains(err.Error(), "connection") || strings.Contains(err.Error(), "network") {
-						if !quiet {
-							log.Printf("[Worker %d] Connection error detected, checking internet...", workerID)
-						}
-						if connErr := netutil.CheckConnectionWithRetry(ctx, quiet); connErr != nil {
-							errMsg := fmt.Errorf("failed to fetch %s: %w (connection lost)", url, err)
-							errorChan <- errMsg
-							if tracker != nil {
-								tracker.RecordFailure(url, err.Error())
-							}
-							continue
-						}
-						// Connection restored, retry this URL
-						if !quiet {
-							log.Printf("[Worker %d] Connection restored, retrying %s", workerID, url)
-						}
-						domains, err = f.Fetch(ctx, url)
-						if err != nil {
-							errMsg := fmt.Errorf("failed to fetch %s after reconnection: %w", url, err)
-							errorChan <- errMsg
-							if tracker != nil {
-								tracker.RecordFailure(url, err.Error())
-							}
-							continue
-						}
-					} else {
-						errMsg := fmt.Errorf("failed to fetch %s: %w", url, err)
-						errorChan <- errMsg
-						if tracker != nil {
-							tracker.RecordFailure(url, err.Error())
-						}
-						continue
-					}
-				}
+	// The validator and the caches from the last run are set up before the fetch, which
+	// -overlap already validates during
+	var v *validator.Validator
+	if validating() {
+		v = newValidator()
+		if loaded, err := loadDNSCache(v); err != nil {
+			log.Printf("Warning: Failed to load DNS cache: %v", err)
+		} else if loaded > 0 && !quiet {
+			log.Printf("DNS cache: %d unexpired results loaded from the last run", loaded)
+		}
+		if err := loadDomainVerdicts(); err != nil {
+			log.Printf("Warning: Failed to load domain cache: %v", err)
+		}
+	}
+	cfg := aggregateConfig(urls, tracker, v)
+	if !quiet {
+		cfg.Log = logLine
+	}
 
-				aggregationStats.URLsFetched++
+	// During an outage many sources fail the same way; log each kind of failure once per window
+	errLog := newDedupLog(logDedupWindow)
+	cfg.OnSourceFailed = func(failure *magpie.SourceError) {
+		// Records are aggregated downstream, so each failure gets its own
+		if structured != nil {
+			structured.Error("fetch failed", "url", failure.URL, "error", failure.Error(), "cause", errorKey(failure.Err))
+			return
+		}
+		errLog.Printf(errorKey(failure.Err), "ERROR: %s", failure)
+	}
 
-				// Record success in stats tracker
-				if tracker != nil {
-					tracker.RecordSuccess(url)
-				}
+	// With -overlap, validation starts now and the fetch feeds it each new domain
+	overlapped := overlapStages && validating()
+	if overlapped {
+		if err := startValidStream(); err != nil {
+			log.Fatalf("Failed to write output: %v", err)
+		}
+		cfg.Skip = overlapSkip
+	}
 
-				if !quiet {
-					log.Printf("[Worker %d] Found %d domains from %s", workerID, len(domains), url)
-				}
+	progress := &logProgress{}
+	if !quiet {
+		cfg.OnValidationStart = progress.begin
+		cfg.OnProgress = progress.update
+	}
+	cfg.OnSecondPass = func(domains int) {
+		progress.end()
+		if !quiet {
+			log.Printf("Second pass: rechecking %d domains with inconclusive DNS results...", domains)
+		}
+	}
 
-				// Stream domains to channel
-				for _, domain := range domains {
-					domainChan <- domain
-				}
+	// Set once the fetch is done, to tell an interrupted fetch from an interrupted validation
+	var fetchDone bool
+	var prevGlobal *stats.GlobalStats
+	cfg.OnFetched = func(fetched *magpie.Result) {
+		fetchDone = true
+		errLog.Flush()
+		aggregationStats.URLsFetched = fetched.Fetched
+		aggregationStats.Failures = sourceFailures(fetched.Failures)
+		aggregationStats.FetchDuration = fetched.FetchDuration
+		aggregationStats.DuplicatesFound = fetched.Duplicates
+		aggregationStats.InMaster = fetched.InMaster
+		aggregationStats.Errors = failureMessages(fetched.Failures)
+
+		if errorLogFile != "" {
+			if err := writeErrorLog(errorLogFile, aggregationStats.Errors); err != nil {
+				log.Printf("Warning: Failed to write error log: %v", err)
+			}
+		}
+		if errorReport != "" {
+			if err := writeErrorReport(errorReport, aggregationStats.Failures, tracker); err != nil {
+				log.Printf("Warning: Failed to write error report: %v", err)
+			}
+		}
+
+		aggregationStats.DomainsFound = fetched.Found
+
+		if tracker != nil {
+			aggregationStats.NewlyBlacklisted = tracker.NewlyBlacklisted()
+			if len(aggregationStats.NewlyBlacklisted) > 0 {
+				log.Printf("⚠️  %d sources newly blacklisted this run", len(aggregationStats.NewlyBlacklisted))
+			}
+		}
+
+		if !quiet {
+			if fetched.Unchanged > 0 {
+				log.Printf("%d sources not modified since last run, served from the fetch cache", fetched.Unchanged)
+			}
+			if fetched.Reused > 0 {
+				log.Printf("%d sources fetched within -min-interval %v, reused from the fetch cache without a request", fetched.Reused, minInterval)
+			}
+			logEvent("sources fetched", fmt.Sprintf("Found %d unique domains (removed %d duplicates)", aggregationStats.DomainsFound, aggregationStats.DuplicatesFound),
+				"urls_fetched", aggregationStats.URLsFetched, "urls_failed", len(aggregationStats.Failures),
+				"domains_found", aggregationStats.DomainsFound, "duplicates", aggregationStats.DuplicatesFound,
+				"duration_seconds", aggregationStats.FetchDuration.Seconds())
+			if aggregationStats.InMaster > 0 {
+				log.Printf("%d of the duplicates are already in %s", aggregationStats.InMaster, masterFile)
+			}
+		}
+	}
+
+	cfg.Filter = func(allDomains map[string]struct{}) {
+		// Drop domains that must never be blocked
+		aggregationStats.Allowlisted = applyAllowlist(allDomains, allowDomains)
+		if !quiet && aggregationStats.Allowlisted > 0 {
+			log.Printf("Allowlist removed %d domains", aggregationStats.Allowlisted)
+		}
+
+		// Drop domains by -include / -exclude
+		if patternsEnabled() {
+			aggregationStats.NotIncluded, aggregationStats.Excluded = applyPatterns(allDomains)
+			if !quiet {
+				log.Printf("Patterns: %s", formatPatternCounts(aggregationStats.NotIncluded, aggregationStats.Excluded))
+			}
+		}
+
+		// Cap domains per TLD to stop a single feed flooding the output
+		if maxPerTLD > 0 {
+			aggregationStats.TLDsCapped = capPerTLD(allDomains, maxPerTLD)
+			if !quiet && len(aggregationStats.TLDsCapped) > 0 {
+				log.Printf("Capped %d TLDs at %d domains each: %s", len(aggregationStats.TLDsCapped), maxPerTLD, formatCappedTLDs(aggregationStats.TLDsCapped))
+			}
+		}
+
+		// Sample the set for a quick run
+		if domainLimit > 0 {
+			aggregationStats.Limited = limitDomains(allDomains, domainLimit)
+			if !quiet && aggregationStats.Limited > 0 {
+				log.Printf("Limit: kept the first %d domains, %d left out", domainLimit, aggregationStats.Limited)
+			}
+		}
+
+		// Capture last run's totals before they are overwritten
+		if tracker != nil {
+			prevGlobal = tracker.LastGlobalStats()
+		}
+
+		if !overlapped {
+			if err := startValidStream(); err != nil {
+				log.Fatalf("Failed to write output: %v", err)
+			}
+			if validating() && !quiet {
+				log.Printf("Validating %d domains with %d workers (caching: %v)...", len(allDomains), workers, enableCache)
+			}
+		}
+	}
+
+	fetched, err := magpie.Aggregate(ctx, cfg)
+	progress.end()
+	saveFetchCache(cfg)
+	if fetched != nil {
+		listSources = fetchedSources(urls, fetched.SourceDomains)
+		wildcardDomains = fetched.Subdomains
+	}
+	switch {
+	case err != nil && ctx.Err() != nil:
+		if !fetchDone {
+			errLog.Flush()
+			log.Printf("Interrupted while fetching: %s", saveInterrupted(tracker, fetched.Domains))
+			os.Exit(exitInterrupted)
+		}
+	case errors.Is(err, magpie.ErrNoDomains):
+		// With -master, finding nothing new is a normal outcome, and doesn't get here
+		discardValidStream()
+		if !keepOnEmpty {
+			log.Fatalf("No domains found from any source")
+		}
+		log.Printf("ERROR: No domains found from any source - keeping existing %s", outputFile)
+		recordEmptyRun(tracker)
+		if jsonSummary != "" {
+			aggregationStats.Notes = []string{"No domains found from any source - kept the existing output file"}
+			if err := writeRunSummary(newRunSummary(aggregationStats, len(allURLs), 0, "none")); err != nil {
+				log.Printf("Warning: Failed to write JSON summary: %v", err)
+			}
+		}
+		os.Exit(exitEmptyResult)
+	case err != nil:
+		log.Fatalf("Aggregation failed: %v", err)
+	}
+	allDomains := fetched.Unique
+	validDomains := fetched.Domains
+	aggregationStats.DomainsValid = fetched.Valid
+	aggregationStats.DomainsInvalid = fetched.Invalid
+
+	// Validate domains
+	validationMethod := "none"
+
+	if validating() {
+		aggregationStats.ValidationDuration = fetched.ValidationDuration
+		aggregationStats.HTTPChecked = fetched.HTTPChecked
+		aggregationStats.DNSTrusted = fetched.DNSTrusted
+		aggregationStats.DeadTLDSkipped = fetched.DeadTLDSkipped
+		aggregationStats.WildcardChecked = fetched.WildcardChecked
+		aggregationStats.WildcardTLDs = fetched.WildcardTLDs
+		aggregationStats.WildcardSubdomains = fetched.WildcardSubdomains
+		aggregationStats.NoMX = fetched.NoMX
+		aggregationStats.HTTPDeadlineSkipped = fetched.HTTPDeadlineSkipped
+		aggregationStats.DNSOnlyAlive = fetched.DNSOnlyAlive
+		aggregationStats.SecondPassChecked = fetched.SecondPassChecked
+		aggregationStats.SecondPassRescued = fetched.SecondPassRescued
+
+		if err := writeInvalidLog(fetched.InvalidDomains); err != nil {
+			log.Printf("Warning: Failed to write invalid log: %v", err)
+		} else if invalidLog != "" && !quiet {
+			log.Printf("Invalid log: %d dropped domains written to %s", len(fetched.InvalidDomains), invalidLog)
+		}
+		if err := saveDNSCache(v); err != nil {
+			log.Printf("Warning: Failed to save DNS cache: %v", err)
+		}
+		if err := saveDomainVerdicts(); err != nil {
+			log.Printf("Warning: Failed to save domain cache: %v", err)
+		}
+		if domainVerdicts != nil {
+			aggregationStats.VerdictsReused = domainVerdicts.Hits()
+			if !quiet {
+				log.Printf("Domain cache: %d domains reused an earlier DNS verdict", aggregationStats.VerdictsReused)
 			}
-		}(i)
-	}
-
-	// Feed URLs to workers
-	go func() {
-		for _, url := range urls {
-			urlChan <- url
 		}
-		close(urlChan)
-	}()
 
-	// Collect domains in background
-	collectorDone := make(chan bool)
-	go func() {
-		for domain := range domainChan {
-			if allDomains[domain] {
-				aggregationStats.DuplicatesFound++
-			} else {
-				allDomains[domain] = true
+		if !quiet {
+			logEvent("validation finished", fmt.Sprintf("Validation complete: %d valid, %d invalid", aggregationStats.DomainsValid, aggregationStats.DomainsInvalid),
+				"valid", aggregationStats.DomainsValid, "invalid", aggregationStats.DomainsInvalid,
+				"duration_seconds", aggregationStats.ValidationDuration.Seconds())
+			if enableHTTP && httpTargeted {
+				log.Printf("Targeted HTTP: %d HTTP-checked, %d DNS-trusted", aggregationStats.HTTPChecked, aggregationStats.DNSTrusted)
+			}
+			if aggregationStats.DeadTLDSkipped > 0 {
+				log.Printf("Dead TLDs: %d domains marked invalid without a lookup", aggregationStats.DeadTLDSkipped)
+			}
+			if aggregationStats.SecondPassChecked > 0 {
+				log.Printf("Second pass: %d of %d inconclusive domains rescued", aggregationStats.SecondPassRescued, aggregationStats.SecondPassChecked)
+			}
+			if len(aggregationStats.WildcardTLDs) > 0 {
+				log.Printf("Wildcard TLDs (%s): %d DNS-valid domains HTTP-checked", formatWildcardTLDs(aggregationStats.WildcardTLDs), aggregationStats.WildcardChecked)
+			}
+			if aggregationStats.WildcardSubdomains > 0 {
+				log.Printf("Wildcard parents: %d subdomains dropped", aggregationStats.WildcardSubdomains)
+			}
+			if aggregationStats.NoMX > 0 {
+				log.Printf("No MX records: %d domains dropped", aggregationStats.NoMX)
+			}
+			if aggregationStats.DNSOnlyAlive > 0 {
+				log.Printf("DNS-alive but HTTP-dead: %d domains dropped", aggregationStats.DNSOnlyAlive)
+			}
+			if aggregationStats.HTTPDeadlineSkipped > 0 {
+				log.Printf("HTTP deadline: %d DNS-valid domains not HTTP-checked (%sed)", aggregationStats.HTTPDeadlineSkipped, httpDeadlinePolicy)
 			}
 		}
-		collectorDone <- true
-	}()
 
-	// Wait for all fetchers to complete
-	fetchWg.Wait()
-	close(domainChan)
-
-	// Wait for collector to finish
-	<-collectorDone
-	close(errorChan)
-
-	// Collect errors
-	for err := range errorChan {
-		log.Printf("ERROR: %s", err)
-		aggregationStats.Errors = append(aggregationStats.Errors, err.Error())
+		validationMethod = validationMethodName()
 	}
 
-	aggregationStats.DomainsFound = len(allDomains)
-
-	if !quiet {
-		log.Printf("Found %d unique domains (removed %d duplicates)", aggregationStats.DomainsFound, aggregationStats.DuplicatesFound)
+	if ctx.Err() != nil {
+		log.Printf("Interrupted while validating: %s", saveInterrupted(tracker, validDomains))
+		os.Exit(exitInterrupted)
 	}
+	// Record global stats
+	global := stats.NewGlobalStats(
+		aggregationStats.URLsFetched,
+		len(aggregationStats.Errors),
+		aggregationStats.DomainsFound+aggregationStats.DuplicatesFound,
+		aggregationStats.DomainsFound,
+		aggregationStats.DuplicatesFound,
+		aggregationStats.DomainsValid,
+		aggregationStats.DomainsInvalid,
+		validationMethod,
+	)
 
-	if aggregationStats.DomainsFound == 0 {
-		log.Fatalf("No domains found from any source")
+	aggregationStats.RunDelta = formatRunDelta(prevGlobal, len(allDomains), aggregationStats.DomainsValid)
+	if !quiet && aggregationStats.RunDelta != "" {
+		log.Printf("Compared to last run: %s", aggregationStats.RunDelta)
 	}
 
-	// Validate domains
-	validDomains := []string{}
-
-	if enableDNS || enableHTTP {
-		if !quiet {
-			log.Printf("Validating %d domains with %d workers (caching: %v)...", aggregationStats.DomainsFound, workers, enableCache)
-		}
-
-		// Parse DNS resolvers
-		resolvers := strings.Split(dnsResolvers, ",")
-		for i, r := range resolvers {
-			resolvers[i] = strings.TrimSpace(r)
+	if collapseSubs || wildcardOutput {
+		validDomains, aggregationStats.Collapsed = collapseCovered(validDomains)
+		if !quiet && aggregationStats.Collapsed > 0 {
+			log.Printf("Collapsed %d subdomains covered by a listed parent", aggregationStats.Collapsed)
 		}
+	}
 
-		v := validator.NewValidatorWithResolvers(enableCache, resolvers)
-		validDomains = validateDomains(ctx, v, allDomains, aggregationStats)
+	magpie.SortDomains(validDomains, sortOrder)
 
-		if !quiet {
-			log.Printf("Validation complete: %d valid, %d invalid", aggregationStats.DomainsValid, aggregationStats.DomainsInvalid)
+	// Write output
+	written := len(validDomains)
+	writeStart := time.Now()
+	if !dryRun {
+		var diffNote string
+		if diffOutput {
+			var err error
+			if diffNote, err = writeDiff(validDomains); err != nil {
+				log.Printf("Warning: Failed to write diff: %v", err)
+			}
+		}
+		var err error
+		written, err = writeMainOutput(validDomains, fetched.Attribution)
+		if err != nil {
+			log.Fatalf("Failed to write output: %v", err)
 		}
+		logEvent("output written", "", "path", outputFile, "format", outputFormat, "domains", written,
+			"duration_seconds", time.Since(writeStart).Seconds())
 
-		// Record global stats
-		if tracker != nil {
-			validationMethod := "dns"
-			if enableHTTP {
-				validationMethod = "dns+http"
-			}
-
-			tracker.RecordGlobalStats(
-				aggregationStats.URLsFetched,
-				len(aggregationStats.Errors),
-				aggregationStats.DomainsFound+aggregationStats.DuplicatesFound,
-				aggregationStats.DomainsFound,
-				aggregationStats.DuplicatesFound,
-				aggregationStats.DomainsValid,
-				aggregationStats.DomainsInvalid,
-				validationMethod,
-			)
+		aggregationStats.Notes = processExtraOutputs(validDomains, written)
+		if appendOutput {
+			aggregationStats.Notes = append([]string{appendNote(len(validDomains), written)}, aggregationStats.Notes...)
 		}
-	} else {
-		// No validation - all domains are valid
-		validDomains = make([]string, 0, len(allDomains))
-		for domain := range allDomains {
-			validDomains = append(validDomains, domain)
+		if diffNote != "" {
+			aggregationStats.Notes = append([]string{diffNote}, aggregationStats.Notes...)
 		}
-		aggregationStats.DomainsValid = len(validDomains)
-
-		// Record global stats (no validation)
-		if tracker != nil {
-			tracker.RecordGlobalStats(
-				aggregationStats.URLsFetched,
-				len(aggregationStats.Errors),
-				aggregationStats.DomainsFound+aggregationStats.DuplicatesFound,
-				aggregationStats.DomainsFound,
-				aggregationStats.DuplicatesFound,
-				len(validDomains),
-				0,
-				"none",
-			)
+		if !quiet {
+			for _, note := range aggregationStats.Notes {
+				log.Printf("%s", note)
+			}
 		}
 	}
 
-	// Write output
-	if err := writeOutput(outputFile, validDomains); err != nil {
-		log.Fatalf("Failed to write output: %v", err)
+	aggregationStats.WriteDuration = time.Since(writeStart)
+
+	// Record global stats once the output is written, so the run's timings are complete
+	global.DurationSeconds = time.Since(runStart).Seconds()
+	aggregationStats.recordTimings(global)
+	if tracker != nil {
+		tracker.RecordGlobal(global)
 	}
 
 	// Save stats tracker
-	if tracker != nil {
+	if tracker != nil && !dryRun {
 		if err := tracker.Save(); err != nil {
 			log.Printf("Warning: Failed to save stats: %v", err)
 		} else if !quiet {
-			log.Printf("Stats saved to %s", filepath.Join(dataDir, stats.StatsFile))
+			path := filepath.Join(dataDir, stats.StatsFile)
+			logEvent("stats saved", fmt.Sprintf("Stats saved to %s", path), "path", path)
 		}
 	}
 
-	// Print results
-	printResults(aggregationStats, len(validDomains))
-}
-
-func fetchDomainsWithTUI(ctx context.Context, program *tea.Program, urls []string, tracker *stats.Tracker) (map[string]bool, int, []string) {
-	allDomains := make(map[string]bool)
-	duplicates := 0
-	var errors []string
-	var mu sync.Mutex
-
-	domainChan := make(chan string, 10000)
-	errorChan := make(chan error, len(urls))
-
-	f := fetcher.NewFetcher(30*time.Second, 3)
-
-	var fetchWg sync.WaitGroup
-	urlChan := make(chan string, len(urls))
-	fetchedCount := atomic.Int32{}
-
-	// Start fetch workers
-	for i := 0; i < fetchWorkers; i++ {
-		fetchWg.Add(1)
-		go func(workerID int) {
-			defer fetchWg.Done()
-			for url := range urlChan {
-				domains, err := f.Fetch(ctx, url)
-				if err != nil {
-					errorChan <- fmt.Errorf("failed to fetch %s: %w", url, err)
-					if tracker != nil {
-						tracker.RecordFailure(url, err.Error())
-					}
-					continue
-				}
-
-				if tracker != nil {
-					tracker.RecordSuccess(url)
-				}
-
-				fetched := int(fetchedCount.Add(1))
-
-				// Send update to TUI
-				program.Send(ui.FetchProgressMsg{
-					URL:          url,
-					WorkerID:     workerID,
-					DomainsFound: len(domains),
-					TotalDomains: len(allDomains) + len(domains),
-					FetchedCount: fetched,
-				})
-
-				// Stream domains to channel
-				for _, domain := range domains {
-					domainChan <- domain
-				}
-			}
-		}(i)
+	if promTextfile != "" {
+		if err := stats.WritePromTextfile(promTextfile, global, fetched.SourceDomains); err != nil {
+			log.Printf("Warning: Failed to write Prometheus textfile: %v", err)
+		}
 	}
 
-	// Collect domains in background
-	collectorDone := make(chan bool)
-	go func() {
-		for domain := range domainChan {
-			mu.Lock()
-			if allDomains[domain] {
-				duplicates++
-			} else {
-				allDomains[domain] = true
-			}
-			mu.Unlock()
-		}
-		collectorDone <- true
-	}()
+	// Print results
+	shown := len(validDomains)
+	if validStream != nil {
+		shown = written
+	}
+	printResults(aggregationStats, shown)
 
-	// Feed URLs to workers
-	go func() {
-		for _, url := range urls {
-			urlChan <- url
+	if jsonSummary != "" {
+		if err := writeRunSummary(newRunSummary(aggregationStats, len(allURLs), written, validationMethod)); err != nil {
+			log.Printf("Warning: Failed to write JSON summary: %v", err)
 		}
-		close(urlChan)
-	}()
-
-	// Wait for all fetchers
-	fetchWg.Wait()
-	close(domainChan)
-	<-collectorDone
-	close(errorChan)
-
-	// Collect errors
-	for err := range errorChan {
-		errors = append(errors, err.Error())
 	}
 
-	return allDomains, duplicates, errors
+	// Automation can't see the results box, so a mostly failed fetch shows in the exit code
+	if tooManyFailures(len(aggregationStats.Failures), len(urls)) {
+		log.Print(failThresholdNote(len(aggregationStats.Failures), len(urls)))
+		os.Exit(exitSourceFailures)
+	}
 }
 
-func validateDomainsWithTUI(ctx context.Context, program *tea.Program, v *validator.Validator, domains map[string]bool) ([]string, int, int) {
-	var (
-		wg           sync.WaitGroup
-		validMu      sync.Mutex
-		validDomains []string
-		total        = len(domains)
-		processed    atomic.Int64
-		validCount   atomic.Int64
-		invalidCount atomic.Int64
-	)
-
-	validDomains = make([]string, 0, total*4/5)
-	domainChan := make(chan string, workers*2)
-
-	// Start workers
-	for i := 0; i < workers; i++ {
-		wg.Add(1)
-		go func(workerID int) {
-			defer wg.Done()
-			localValid := make([]string, 0, total/workers)
-
-			for domain := range domainChan {
-				valid := false
-				var err error
-
-				if enableHTTP {
-					valid, err = v.ValidateFull(ctx, domain)
-				} else if enableDNS {
-					valid, err = v.ValidateDNS(ctx, domain)
-				}
-
-				if err == nil && valid {
-					localValid = append(localValid, domain)
-					validCount.Add(1)
-				} else {
-					invalidCount.Add(1)
-				}
-
-				current := processed.Add(1)
-
-				// Update TUI every 50 domains to reduce overhead
-				if current%50 == 0 || current == int64(total) {
-					program.Send(ui.ValidationProgressMsg{
-						Current: int(current),
-						Valid:   int(validCount.Load()),
-						Invalid: int(invalidCount.Load()),
-					})
-				}
-			}
+// dataDirLock is the -data-dir lock held until the process exits. Referenced so the lock
+// file isn't closed, and the lock released, when it is garbage collected.
+var dataDirLock *stats.DirLock
 
-			validMu.Lock()
-			validDomains = append(validDomains, localValid...)
-			validMu.Unlock()
-		}(i)
+// lockDataDir locks dir for the rest of the process (see stats.LockDataDir), or exits
+// with exitDataDirLocked when another run holds it
+func lockDataDir(dir string) {
+	lock, err := stats.LockDataDir(dir)
+	if err != nil {
+		log.Printf("Refusing to start: %v", err)
+		os.Exit(exitDataDirLocked)
 	}
+	dataDirLock = lock
+}
 
-	// Feed domains to workers
-	for domain := range domains {
-		domainChan <- domain
+// loadURLs reads the sources list from path, or from stdin for "-"
+func loadURLs(path string) ([]source, error) {
+	if path == "-" {
+		return parseURLs(os.Stdin, "stdin")
 	}
-	close(domainChan)
-
-	wg.Wait()
-
-	return validDomains, int(validCount.Load()), int(invalidCount.Load())
-}
 
-func loadURLs(path string) ([]string, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
 	defer file.Close()
 
-	var urls []string
-	scanner := bufio.NewScanner(file)
+	return parseURLs(file, "file")
+}
+
+// parseURLs reads one source per line, with optional #tags: and #priority:, skipping blank lines and
+// comments; name is how errors refer to the input
+func parseURLs(r io.Reader, name string) ([]source, error) {
+	var urls []source
+	scanner := bufio.NewScanner(r)
 	lineNum := 0
 
 	for scanner.Scan() {
@@ -908,153 +2021,233 @@ func loadURLs(path string) ([]string, error) {
 			continue
 		}
 
-		// Basic URL validation
-		if !strings.HasPrefix(line, "http://") && !strings.HasPrefix(line, "https://") {
-			return nil, fmt.Errorf("line %d: invalid URL (must start with http:// or https://): %s", lineNum, line)
+		src, err := parseSourceLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+
+		// Basic URL validation; lines without a scheme are local file paths
+		if !strings.HasPrefix(src.URL, "http://") && !strings.HasPrefix(src.URL, "https://") && !fetcher.IsAXFRSource(src.URL) && !fetcher.IsLocalSource(src.URL) {
+			return nil, fmt.Errorf("line %d: invalid URL (must start with http://, https://, axfr:// or file://, or be a file path): %s", lineNum, src.URL)
 		}
 
-		urls = append(urls, line)
+		urls = append(urls, src)
 	}
 
 	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("error reading file: %w", err)
+		return nil, fmt.Errorf("error reading %s: %w", name, err)
 	}
 
 	if len(urls) == 0 {
-		return nil, fmt.Errorf("no valid URLs found in file")
+		if lineNum == 0 {
+			return nil, fmt.Errorf("%s is empty", name)
+		}
+		return nil, fmt.Errorf("no valid URLs found in %s", name)
 	}
 
 	return urls, nil
 }
 
-func validateDomains(ctx context.Context, v *validator.Validator, domains map[string]bool, aggStats *AggregationStats) []string {
-	var (
-		wg           sync.WaitGroup
-		validMu      sync.Mutex
-		validDomains []string
-		total        = len(domains)
-		processed    atomic.Int64
-		validCount   atomic.Int64
-		invalidCount atomic.Int64
-	)
+// newValidator builds a validator from the command-line settings
+func newValidator() *validator.Validator {
+	// Parse DNS resolvers
+	resolvers := strings.Split(dnsResolvers, ",")
+	for i, r := range resolvers {
+		resolvers[i] = strings.TrimSpace(r)
+	}
+
+	v := validator.NewValidatorWithResolvers(enableCache, resolvers)
+	v.RetryServFail = retryServFail
+	v.Retries = dnsRetries
+	v.Records = dnsRecords
+	v.IgnoreIPs = ignoreIPs
+	v.HashResolvers = resolverOrder == "hash"
+	if bulkResolver != "" {
+		v.Backend = validator.NewBulkBackend(bulkResolver, bulkBatch)
+	}
+	if proxyOverride != nil {
+		v.SetProxy(proxyOverride)
+	}
+	v.SetHTTPConcurrency(httpWorkers)
+	v.AcceptStatus = acceptStatus
+	v.RequireApexAndWWW = requireWWW
+	v.TTLAware = cacheTTLAware
+	v.BatchWorkers = workers
+	v.MaxCacheTTL = cacheMaxTTL
+	v.MaxCacheEntries = cacheMax
+	// HTTP validation already covers wildcard TLDs, so only DNS-only runs need to probe
+	v.DetectWildcards = wildcardCheck && !enableHTTP
+	v.DetectParentWildcards = detectWildcard
+
+	switch strings.ToLower(strings.TrimSpace(deadTLDs)) {
+	case "":
+		v.DeadTLDs = validator.NewTLDSet(validator.DefaultDeadTLDs)
+	case "none":
+		// Short-circuit disabled
+	default:
+		v.DeadTLDs = validator.NewTLDSet(strings.Split(deadTLDs, ","))
+	}
+	return v
+}
 
-	// Pre-allocate with estimated capacity (assume ~80% valid)
-	validDomains = make([]string, 0, total*4/5)
+// collapseSubdomains drops every domain that has a parent in the list, since blocking
+// the parent already covers it. Only parents longer than the public suffix count, so
+// listing "co.uk" never swallows "example.co.uk". Returns the kept domains and how many
+// were collapsed.
+func collapseSubdomains(domains []string) ([]string, int) {
+	present := make(map[string]struct{}, len(domains))
+	for _, domain := range domains {
+		present[domain] = struct{}{}
+	}
+	return collapseUnder(domains, present)
+}
 
-	// Create buffered channel for better throughput
-	domainChan := make(chan string, workers*2)
+// collapseCovered applies -collapse-subdomains. With -wildcards alone, only the
+// subdomains of wildcard entries are dropped, since those entries now block them.
+func collapseCovered(domains []string) ([]string, int) {
+	if !collapseSubs {
+		return collapseUnder(domains, wildcardDomains)
+	}
+	return collapseSubdomains(domains)
+}
 
-	// Check if running in TTY (interactive terminal)
-	isTTY := term.IsTerminal(int(os.Stdout.Fd()))
+// collapseUnder drops every domain that has a registrable parent in parents
+func collapseUnder(domains []string, parents map[string]struct{}) ([]string, int) {
+	if len(parents) == 0 {
+		return domains, 0
+	}
+	kept := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		if !hasListedParent(domain, parents) {
+			kept = append(kept, domain)
+		}
+	}
+	return kept, len(domains) - len(kept)
+}
 
-	// Setup progress tracking
-	var program *tea.Program
-	startTime := time.Now()
-
-	if !quiet && isTTY {
-		// Use Bubble Tea for interactive terminals
-		model := ui.NewProgressModel(total)
-		program = tea.NewProgram(model)
-
-		// Run the program in a goroutine
-		go func() {
-			if _, err := program.Run(); err != nil {
-				log.Printf("Error running progress UI: %v", err)
-			}
-		}()
-	} else if !quiet {
-		// Simple logging for non-TTY (pipes, files, cronjobs)
-		log.Printf("Starting validation of %d domains with %d workers...", total, workers)
-	}
-
-	// Start workers first
-	for i := 0; i < workers; i++ {
-		wg.Add(1)
-		go func(workerID int) {
-			defer wg.Done()
-			localValid := make([]string, 0, total/(workers))
-			localValidCount := 0
-			localInvalidCount := 0
-
-			for domain := range domainChan {
-				valid := false
-				var err error
-
-				if enableHTTP {
-					valid, err = v.ValidateFull(ctx, domain)
-				} else if enableDNS {
-					valid, err = v.ValidateDNS(ctx, domain)
-				}
+// hasListedParent reports whether a registrable parent of domain is in present
+func hasListedParent(domain string, present map[string]struct{}) bool {
+	suffix, _ := publicsuffix.PublicSuffix(domain)
+	for parent := domain; ; {
+		dot := strings.IndexByte(parent, '.')
+		if dot < 0 {
+			return false
+		}
+		parent = parent[dot+1:]
+		if len(parent) <= len(suffix) {
+			return false
+		}
+		if _, ok := present[parent]; ok {
+			return true
+		}
+	}
+}
 
-				if err == nil && valid {
-					localValid = append(localValid, domain)
-					localValidCount++
-					validCount.Add(1)
-				} else {
-					localInvalidCount++
-					invalidCount.Add(1)
-				}
+// dnsCacheFile holds the persisted DNS cache, inside the data directory
+const dnsCacheFile = "dns-cache.json"
 
-				// Update progress
-				current := processed.Add(1)
-
-				if !quiet {
-					if program != nil && isTTY {
-						// TTY: Update Bubble Tea UI
-						program.Send(ui.UpdateProgress(
-							int(current),
-							int(validCount.Load()),
-							int(invalidCount.Load()),
-						))
-					} else if !isTTY {
-						// Non-TTY: Log every 10k domains
-						if current%10000 == 0 || current == int64(total) {
-							elapsed := time.Since(startTime)
-							speed := float64(current) / elapsed.Seconds()
-							log.Printf("Progress: %d/%d (%.1f%%) - %d valid, %d invalid - %.0f domains/s",
-								current, total, float64(current)/float64(total)*100,
-								validCount.Load(), invalidCount.Load(), speed)
-						}
-					}
-				}
-			}
+// loadDNSCache seeds the validator's cache from the last run with -persist-cache
+func loadDNSCache(v *validator.Validator) (int, error) {
+	if !persistCache {
+		return 0, nil
+	}
+	return v.LoadCache(filepath.Join(dataDir, dnsCacheFile))
+}
+
+// saveDNSCache writes the validator's cache for the next run with -persist-cache
+func saveDNSCache(v *validator.Validator) error {
+	if !persistCache {
+		return nil
+	}
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return err
+	}
+	return v.SaveCache(filepath.Join(dataDir, dnsCacheFile))
+}
+
+// loadDomainVerdicts opens the -domain-cache-ttl verdict cache; without the flag it stays off
+func loadDomainVerdicts() error {
+	if domainCacheTTL == "" {
+		return nil
+	}
+	ttl, err := parseSince(domainCacheTTL)
+	if err != nil {
+		return err
+	}
+	cache, err := stats.LoadDomainCache(dataDir, ttl, ttl/4)
+	if err != nil {
+		return err
+	}
+	domainVerdicts = cache
+	return nil
+}
+
+// saveDomainVerdicts writes the verdict cache for the next run
+func saveDomainVerdicts() error {
+	if domainVerdicts == nil || dryRun {
+		return nil
+	}
+	return domainVerdicts.Save()
+}
+
+// validating reports whether any validation is enabled
+func validating() bool {
+	return enableDNS || enableHTTP || mxCheck
+}
 
-			// Merge local results
-			validMu.Lock()
-			validDomains = append(validDomains, localValid...)
-			aggStats.DomainsValid += localValidCount
-			aggStats.DomainsInvalid += localInvalidCount
-			validMu.Unlock()
-		}(i)
+// validationMethodName names the enabled checks for the results and -json-summary
+func validationMethodName() string {
+	if !enableDNS && !enableHTTP {
+		return "mx"
+	}
+	method := "dns"
+	if enableHTTP {
+		method = "dns+http"
 	}
+	if mxCheck {
+		method += "+mx"
+	}
+	return method
+}
 
-	// Feed domains to workers
-	for domain := range domains {
-		domainChan <- domain
+// writeInvalidLog writes one JSON line per dropped domain with its outcome to -invalid-log
+func writeInvalidLog(invalid []magpie.InvalidDomain) error {
+	if invalidLog == "" {
+		return nil
 	}
-	close(domainChan)
 
-	wg.Wait()
+	file, err := os.Create(invalidLog)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
 
-	if program != nil {
-		program.Send(ui.SendDone())
-		program.Wait()
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, record := range invalid {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
 	}
+	return writer.Flush()
+}
 
-	return validDomains
+// writeErrorLog writes every error message, one per line, without truncation
+func writeErrorLog(path string, errors []string) error {
+	return writeLines(path, errors)
 }
 
-func writeOutput(path string, domains []string) error {
+// writeLines writes each line to path, replacing any existing file
+func writeLines(path string, lines []string) error {
 	file, err := os.Create(path)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	// Use larger buffer for better write performance with large lists
-	writer := bufio.NewWriterSize(file, 256*1024) // 256KB buffer
-	for _, domain := range domains {
-		fmt.Fprintln(writer, domain)
+	writer := bufio.NewWriter(file)
+	for _, line := range lines {
+		fmt.Fprintln(writer, line)
 	}
 	return writer.Flush()
 }
@@ -1099,11 +2292,30 @@ func printResults(aggStats *AggregationStats, validCount int) {
 	}
 	printColorLine(cyan, cyan, "    Domains found:", formatSize(aggStats.DomainsFound))
 	printColorLine(cyan, yellow, "    Duplicates removed:", formatSize(aggStats.DuplicatesFound))
+	if aggStats.InMaster > 0 {
+		printColorLine(cyan, yellow, "    Already in master:", formatSize(aggStats.InMaster))
+	}
+	if aggStats.Allowlisted > 0 {
+		printColorLine(cyan, yellow, "    Allowlisted:", formatSize(aggStats.Allowlisted))
+	}
+	if patternsEnabled() {
+		printColorLine(cyan, yellow, "    Pattern filter:", formatSize(patternsRemoved(aggStats.NotIncluded, aggStats.Excluded)))
+	}
+	if len(aggStats.TLDsCapped) > 0 {
+		cappedTotal := 0
+		for _, dropped := range aggStats.TLDsCapped {
+			cappedTotal += dropped
+		}
+		printColorLine(cyan, yellow, "    TLD cap removed:", fmt.Sprintf("%s (%d TLDs over %d)", formatSize(cappedTotal), len(aggStats.TLDsCapped), maxPerTLD))
+	}
+	if aggStats.Limited > 0 {
+		printColorLine(cyan, yellow, "    Left out by -limit:", formatSize(aggStats.Limited))
+	}
 
 	cyan.Println(midLine)
 
 	// Validation statistics
-	if enableDNS || enableHTTP {
+	if validating() {
 		cyan.Print("║  ")
 		white.Print("🔍 VALIDATION RESULTS")
 		fmt.Print(strings.Repeat(" ", 55))
@@ -1112,6 +2324,35 @@ func printResults(aggStats *AggregationStats, validCount int) {
 
 		printColorLine(cyan, green, "    Valid domains:", formatSize(aggStats.DomainsValid))
 		printColorLine(cyan, red, "    Invalid domains:", formatSize(aggStats.DomainsInvalid))
+		if enableHTTP && httpTargeted {
+			printColorLine(cyan, cyan, "    HTTP-checked:", formatSize(aggStats.HTTPChecked))
+			printColorLine(cyan, cyan, "    DNS-trusted:", formatSize(aggStats.DNSTrusted))
+		}
+		if aggStats.DeadTLDSkipped > 0 {
+			printColorLine(cyan, yellow, "    Dead TLD (no lookup):", formatSize(aggStats.DeadTLDSkipped))
+		}
+		if aggStats.VerdictsReused > 0 {
+			printColorLine(cyan, cyan, "    Cached verdicts:", formatSize(aggStats.VerdictsReused))
+		}
+		if aggStats.SecondPassChecked > 0 {
+			printColorLine(cyan, green, "    Rescued (second pass):", fmt.Sprintf("%s of %s", formatSize(aggStats.SecondPassRescued), formatSize(aggStats.SecondPassChecked)))
+		}
+		if len(aggStats.WildcardTLDs) > 0 {
+			printColorLine(cyan, yellow, "    Wildcard TLDs:", formatWildcardTLDs(aggStats.WildcardTLDs))
+			printColorLine(cyan, yellow, "    HTTP-checked (wildcard):", formatSize(aggStats.WildcardChecked))
+		}
+		if aggStats.WildcardSubdomains > 0 {
+			printColorLine(cyan, yellow, "    Wildcard parents:", formatSize(aggStats.WildcardSubdomains))
+		}
+		if aggStats.NoMX > 0 {
+			printColorLine(cyan, yellow, "    No MX records:", formatSize(aggStats.NoMX))
+		}
+		if aggStats.DNSOnlyAlive > 0 {
+			printColorLine(cyan, yellow, "    DNS-alive, HTTP-dead:", formatSize(aggStats.DNSOnlyAlive))
+		}
+		if aggStats.HTTPDeadlineSkipped > 0 {
+			printColorLine(cyan, yellow, "    HTTP deadline ("+httpDeadlinePolicy+"ed):", formatSize(aggStats.HTTPDeadlineSkipped))
+		}
 
 		// Calculate cleaning statistics
 		if aggStats.DomainsFound > 0 {
@@ -1142,8 +2383,21 @@ func printResults(aggStats *AggregationStats, validCount int) {
 	cyan.Println("║")
 	cyan.Println("║" + strings.Repeat(" ", 78) + "║")
 
-	printColorLine(cyan, green, "    File:", outputFile)
+	if dryRun {
+		printColorLine(cyan, yellow, "    File:", "DRY RUN — no files written")
+	} else {
+		printColorLine(cyan, green, "    File:", outputFile)
+	}
+	if aggStats.Collapsed > 0 {
+		printColorLine(cyan, yellow, "    Subdomains collapsed:", formatSize(aggStats.Collapsed))
+	}
 	printColorLine(cyan, green, "    Total domains:", formatSize(validCount))
+	if aggStats.RunDelta != "" {
+		printColorLine(cyan, cyan, "    Since last run:", aggStats.RunDelta)
+	}
+	for _, note := range aggStats.Notes {
+		printNoteLine(cyan, cyan, note)
+	}
 
 	// Error summary
 	if len(aggStats.Errors) > 0 {
@@ -1161,7 +2415,7 @@ func printResults(aggStats *AggregationStats, validCount int) {
 		cyan.Println("║")
 
 		for i, errMsg := range aggStats.Errors {
-			if i < 3 {
+			if i < maxErrorsDisplay {
 				// Truncate long error messages
 				if len(errMsg) > 72 {
 					errMsg = errMsg[:69] + "..."
@@ -1173,13 +2427,46 @@ func printResults(aggStats *AggregationStats, validCount int) {
 				cyan.Println("║")
 			}
 		}
-		if len(aggStats.Errors) > 3 {
-			moreMsg := fmt.Sprintf("    ... and %d more errors", len(aggStats.Errors)-3)
+		if len(aggStats.Errors) > maxErrorsDisplay && maxErrorsDisplay >= 0 {
+			moreMsg := fmt.Sprintf("    ... and %d more errors", len(aggStats.Errors)-maxErrorsDisplay)
 			cyan.Print("║  ")
 			red.Print(moreMsg)
 			fmt.Print(strings.Repeat(" ", 78-len(moreMsg)-2))
 			cyan.Println("║")
 		}
+		if errorLogFile != "" {
+			printColorLine(cyan, red, "    Full error log:", errorLogFile)
+		}
+		if errorReport != "" {
+			printColorLine(cyan, red, "    Error report:", errorReport)
+		}
+	}
+
+	// Newly blacklisted sources
+	if len(aggStats.NewlyBlacklisted) > 0 {
+		cyan.Println(midLine)
+		cyan.Print("║  ")
+		yellow.Print("🚫 NEWLY BLACKLISTED SOURCES")
+		fmt.Print(strings.Repeat(" ", 48))
+		cyan.Println("║")
+		cyan.Println("║" + strings.Repeat(" ", 78) + "║")
+
+		countMsg := fmt.Sprintf("    %d sources newly blacklisted this run", len(aggStats.NewlyBlacklisted))
+		cyan.Print("║  ")
+		yellow.Print(countMsg)
+		fmt.Print(strings.Repeat(" ", 78-len(countMsg)-2))
+		cyan.Println("║")
+
+		for _, url := range aggStats.NewlyBlacklisted {
+			if len(url) > 72 {
+				url = url[:69] + "..."
+			}
+			cyan.Print("║    ")
+			yellow.Print("- ")
+			fmt.Print(url)
+			fmt.Print(strings.Repeat(" ", 72-len(url)))
+			cyan.Println("║")
+		}
 	}
 
 	cyan.Println(botLine)
@@ -1189,23 +2476,88 @@ func printResults(aggStats *AggregationStats, validCount int) {
 func printColorLine(borderColor, textColor *color.Color, label, value string) {
 	borderColor.Print("║  ")
 	fmt.Print(label)
-	spaces := 76 - len(label) - len(value)
+	spaces := 76 - len(label) - utf8.RuneCountInString(value)
+	if spaces < 1 {
+		spaces = 1 // long values (file paths) overflow the box rather than panic
+	}
 	fmt.Print(strings.Repeat(" ", spaces))
 	textColor.Print(value)
 	fmt.Print("  ")
 	borderColor.Println("║")
 }
 
-func displayStatsTable(tracker *stats.Tracker) {
+// printNoteLine prints a free-form note inside the results box, truncated to fit
+func printNoteLine(borderColor, textColor *color.Color, note string) {
+	note = "    • " + note
+	if utf8.RuneCountInString(note) > 74 {
+		note = string([]rune(note)[:71]) + "..."
+	}
+	borderColor.Print("║  ")
+	textColor.Print(note)
+	fmt.Print(strings.Repeat(" ", 76-utf8.RuneCountInString(note)))
+	borderColor.Println("║")
+}
+
+// statsSortOrders are the accepted -sort-stats values
+var statsSortOrders = []string{"name", "reliability", "lastchecked", "contribution"}
+
+// sortStatsURLs orders the stats cards per -sort-stats: by URL, by success rate (least
+// reliable first), by last check (most recent first) or by domains contributed (most
+// first). Ties fall back to the URL.
+func sortStatsURLs(urls []string, visible map[string]*stats.URLStats) {
+	sort.Slice(urls, func(i, j int) bool {
+		a, b := visible[urls[i]], visible[urls[j]]
+		switch sortStats {
+		case "reliability":
+			rateA, okA := a.SuccessRate()
+			rateB, okB := b.SuccessRate()
+			if okA != okB {
+				return okA // never fetched sorts last
+			}
+			if rateA != rateB {
+				return rateA < rateB
+			}
+		case "lastchecked":
+			if !a.LastChecked.Equal(b.LastChecked) {
+				return a.LastChecked.After(b.LastChecked)
+			}
+		case "contribution":
+			if a.DomainsContributed != b.DomainsContributed {
+				return a.DomainsContributed > b.DomainsContributed
+			}
+		}
+		return urls[i] < urls[j]
+	})
+}
+
+// displayStatsTable renders the per-source stats. A non-zero since limits the table and
+// summary to sources checked within that window.
+func displayStatsTable(tracker *stats.Tracker, since time.Duration) {
+	noStatsStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color("240")).
+		Italic(true).
+		Padding(1, 2)
+
 	if len(tracker.Stats) == 0 {
-		noStatsStyle := lipgloss.NewStyle().
-			Foreground(lipgloss.Color("240")).
-			Italic(true).
-			Padding(1, 2)
 		fmt.Println(noStatsStyle.Render("No stats available yet. Run an aggregation first."))
 		return
 	}
 
+	visible := tracker.Stats
+	if since > 0 {
+		cutoff := time.Now().Add(-since)
+		visible = make(map[string]*stats.URLStats)
+		for url, stat := range tracker.Stats {
+			if stat.LastChecked.After(cutoff) {
+				visible[url] = stat
+			}
+		}
+		if len(visible) == 0 {
+			fmt.Println(noStatsStyle.Render(fmt.Sprintf("No sources checked in the last %s.", statsSince)))
+			return
+		}
+	}
+
 	// Style definitions
 	titleStyle := lipgloss.NewStyle().
 		Foreground(lipgloss.Color("213")).
@@ -1240,6 +2592,10 @@ func displayStatsTable(tracker *stats.Tracker) {
 		Foreground(lipgloss.Color("9")).
 		Bold(true)
 
+	pendingStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color("214")).
+		Bold(true)
+
 	timeStyle := lipgloss.NewStyle().
 		Foreground(lipgloss.Color("245")).
 		Italic(true)
@@ -1261,31 +2617,40 @@ func displayStatsTable(tracker *stats.Tracker) {
 	b.WriteString("\n\n")
 
 	// Calculate summary first
-	totalURLs := len(tracker.Stats)
+	totalURLs := len(visible)
 	activeURLs := 0
 	filteredURLs := 0
 	totalSuccess := 0
 	totalFailures := 0
 
-	for _, stat := range tracker.Stats {
-		if stat.Blacklisted || stat.FailureCount >= stats.MaxFailures {
+	neverWorked := 0
+	unreliable := 0
+	for _, stat := range visible {
+		if tracker.Filtered(stat) {
 			filteredURLs++
 		} else {
 			activeURLs++
 		}
+		if stat.NeverWorked() && stat.FailureCount > 0 {
+			neverWorked++
+		}
+		if !tracker.Filtered(stat) && stat.Unreliable() {
+			unreliable++
+		}
 		totalSuccess += stat.SuccessCount
 		totalFailures += stat.FailureCount
 	}
 
 	// Sort URLs for consistent output
 	var urls []string
-	for url := range tracker.Stats {
+	for url := range visible {
 		urls = append(urls, url)
 	}
+	sortStatsURLs(urls, visible)
 
 	// Compact card-based layout for each URL
 	for _, url := range urls {
-		stat := tracker.Stats[url]
+		stat := visible[url]
 
 		// Truncate URL if too long (40 chars for smaller screens)
 		displayURL := url
@@ -1294,11 +2659,20 @@ func displayStatsTable(tracker *stats.Tracker) {
 		}
 
 		// Status indicator
-		isFiltered := stat.Blacklisted || stat.FailureCount >= stats.MaxFailures
+		// "Never worked" (new or mistyped source) and "stopped working" are told apart
+		isFiltered := tracker.Filtered(stat)
+		failing := stat.FailureCount > 0
 		var statusText string
-		if isFiltered {
-			statusText = filteredStyle.Render("✗ Filtered")
-		} else {
+		switch {
+		case isFiltered && stat.NeverWorked():
+			statusText = filteredStyle.Render("✗ Filtered (never worked)")
+		case isFiltered:
+			statusText = filteredStyle.Render("✗ Filtered (stopped working)")
+		case failing && stat.NeverWorked():
+			statusText = pendingStyle.Render("⏳ Pending (never worked)")
+		case stat.Unreliable():
+			statusText = pendingStyle.Render("⚠ Unreliable")
+		default:
 			statusText = activeStyle.Render("✓ Active")
 		}
 
@@ -1331,6 +2705,21 @@ func displayStatsTable(tracker *stats.Tracker) {
 		} else {
 			card.WriteString(labelStyle.Render("0"))
 		}
+		if rate, ok := stat.SuccessRate(); ok {
+			rateStyle := successStyle
+			switch {
+			case stat.Unreliable():
+				rateStyle = failureStyle
+			case rate < 90:
+				rateStyle = pendingStyle
+			}
+			card.WriteString(labelStyle.Render("  •  Rate: "))
+			card.WriteString(rateStyle.Render(fmt.Sprintf("%.0f%%", rate)))
+		}
+		if stat.DomainsContributed > 0 {
+			card.WriteString(labelStyle.Render("  •  Domains: "))
+			card.WriteString(numberStyle.Render(formatSize(stat.DomainsContributed)))
+		}
 		card.WriteString(labelStyle.Render("  •  "))
 		card.WriteString(timeStyle.Render(lastChecked))
 		if stat.ValidationMethod != "" {
@@ -1356,6 +2745,9 @@ func displayStatsTable(tracker *stats.Tracker) {
 
 	summary.WriteString(summaryLabelStyle.Render("Total URLs:"))
 	summary.WriteString(summaryValueStyle.Render(fmt.Sprintf("%d", totalURLs)))
+	if since > 0 {
+		summary.WriteString(timeStyle.Render(fmt.Sprintf("  (checked in the last %s, %d total)", statsSince, len(tracker.Stats))))
+	}
 	summary.WriteString("\n")
 
 	summary.WriteString(summaryLabelStyle.Render("Active:"))
@@ -1370,6 +2762,19 @@ func displayStatsTable(tracker *stats.Tracker) {
 	}
 	summary.WriteString("\n")
 
+	if neverWorked > 0 {
+		summary.WriteString(summaryLabelStyle.Render("Never worked:"))
+		summary.WriteString(pendingStyle.Render(fmt.Sprintf("%d", neverWorked)))
+		summary.WriteString("\n")
+	}
+
+	if unreliable > 0 {
+		summary.WriteString(summaryLabelStyle.Render("Unreliable:"))
+		summary.WriteString(pendingStyle.Render(fmt.Sprintf("%d", unreliable)))
+		summary.WriteString(timeStyle.Render(fmt.Sprintf("  (active, under %.0f%% success)", stats.UnreliableRate)))
+		summary.WriteString("\n")
+	}
+
 	summary.WriteString(summaryLabelStyle.Render("Total Successes:"))
 	summary.WriteString(successStyle.Render(fmt.Sprintf("%d", totalSuccess)))
 	summary.WriteString("\n")
@@ -1401,6 +2806,21 @@ func displayStatsTable(tracker *stats.Tracker) {
 		globalSummary.WriteString(timeStyle.Render(formatTimeSince(tracker.GlobalStats.LastRun)))
 		globalSummary.WriteString("\n")
 
+		if g := tracker.GlobalStats; g.DurationSeconds > 0 {
+			globalSummary.WriteString(summaryLabelStyle.Render("Duration:"))
+			globalSummary.WriteString(numberStyle.Render(formatSeconds(g.DurationSeconds)))
+			globalSummary.WriteString("\n")
+
+			// Runs recorded before the stage timings existed only have the total
+			if g.FetchSeconds > 0 || g.ValidationSeconds > 0 {
+				globalSummary.WriteString(summaryLabelStyle.Render("Time Split:"))
+				globalSummary.WriteString(labelStyle.Render(fmt.Sprintf("connect %s · fetch %s · validate %s · write %s",
+					formatSeconds(g.ConnectSeconds), formatSeconds(g.FetchSeconds),
+					formatSeconds(g.ValidationSeconds), formatSeconds(g.WriteSeconds))))
+				globalSummary.WriteString("\n")
+			}
+		}
+
 		globalSummary.WriteString(summaryLabelStyle.Render("URLs Fetched:"))
 		globalSummary.WriteString(successStyle.Render(fmt.Sprintf("%d", tracker.GlobalStats.TotalURLsFetched)))
 		globalSummary.WriteString("\n")
@@ -1444,6 +2864,19 @@ func displayStatsTable(tracker *stats.Tracker) {
 	fmt.Print(b.String())
 }
 
+// formatSeconds renders a stage duration, e.g. "850ms", "12.3s" or "4m05s"
+func formatSeconds(seconds float64) string {
+	d := time.Duration(seconds * float64(time.Second))
+	switch {
+	case d < time.Second:
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	case d < time.Minute:
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	default:
+		return fmt.Sprintf("%dm%02ds", int(d.Minutes()), int(d.Seconds())%60)
+	}
+}
+
 func formatTimeSince(t time.Time) string {
 	if t.IsZero() {
 		return "-"
@@ -1468,6 +2901,73 @@ func formatTimeSince(t time.Time) string {
 	}
 }
 
+// parseSince parses a -since window. On top of time.ParseDuration units it accepts
+// whole days, e.g. "7d". An empty value means no limit.
+func parseSince(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid number of days %q", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("duration must be positive, got %q", value)
+	}
+	return d, nil
+}
+
+// formatRunDelta compares this run's counts with the previous run, e.g.
+// "unique 1,234,567 (+12,340), valid 1.1M (-0.3%)". Returns "" without history.
+func formatRunDelta(prev *stats.GlobalStats, unique, valid int) string {
+	if prev == nil {
+		return ""
+	}
+
+	uniqueDelta := unique - prev.TotalDomainsUnique
+	validChange := "n/a"
+	if prev.ValidDomains > 0 {
+		validChange = fmt.Sprintf("%+.1f%%", float64(valid-prev.ValidDomains)/float64(prev.ValidDomains)*100)
+	}
+
+	return fmt.Sprintf("unique %s (%s), valid %s (%s)",
+		formatThousands(unique), signedThousands(uniqueDelta), formatSize(valid), validChange)
+}
+
+// formatThousands formats a count with comma separators (1234567 -> 1,234,567)
+func formatThousands(n int) string {
+	if n < 0 {
+		return "-" + formatThousands(-n)
+	}
+	digits := fmt.Sprintf("%d", n)
+	var b strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(d)
+	}
+	return b.String()
+}
+
+// signedThousands formats a delta with an explicit sign (+12,340 / -5)
+func signedThousands(n int) string {
+	if n >= 0 {
+		return "+" + formatThousands(n)
+	}
+	return formatThousands(n)
+}
+
 func formatSize(count int) string {
 	if count < 1000 {
 		return fmt.Sprintf("%d", count)
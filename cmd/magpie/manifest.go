@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// manifestFile describes one generated list in the -manifest index
+type manifestFile struct {
+	Kind        string    `json:"kind"`             // "output", "chunk" (-unbound-chunk), "bucket" or "newly-seen"
+	Path        string    `json:"path"`             // relative to the manifest when possible
+	Format      string    `json:"format"`           // line format, see -format
+	Bucket      string    `json:"bucket,omitempty"` // bucket key for -bucket-by files
+	Domains     int       `json:"domains"`
+	Bytes       int64     `json:"bytes"`
+	SHA256      string    `json:"sha256"`
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+// manifest is the JSON document written to -manifest
+type manifest struct {
+	Version     string         `json:"version"`
+	GeneratedAt time.Time      `json:"generated_at"`
+	Files       []manifestFile `json:"files"`
+}
+
+// generatedFiles collects the lists written this run, in order, for the manifest
+var generatedFiles []manifestFile
+
+// recordGenerated notes a list file that was just written
+func recordGenerated(kind, path, format, bucket string, domains int) {
+	if manifestPath == "" {
+		return
+	}
+	generatedFiles = append(generatedFiles, manifestFile{
+		Kind:        kind,
+		Path:        path,
+		Format:      format,
+		Bucket:      bucket,
+		Domains:     domains,
+		GeneratedAt: time.Now(),
+	})
+}
+
+// writeManifest checksums every generated file and writes the JSON index to -manifest
+func writeManifest() (string, error) {
+	doc := manifest{
+		Version:     version,
+		GeneratedAt: time.Now(),
+		Files:       make([]manifestFile, 0, len(generatedFiles)),
+	}
+
+	for _, file := range generatedFiles {
+		sum, size, err := fileChecksum(file.Path)
+		if err != nil {
+			return "", err
+		}
+		file.SHA256 = sum
+		file.Bytes = size
+		file.Path = manifestRelPath(file.Path)
+		doc.Files = append(doc.Files, file)
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(manifestPath, append(data, '\n'), 0644); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Manifest: %d files listed in %s", len(doc.Files), manifestPath), nil
+}
+
+// fileChecksum returns the hex SHA-256 and size of a file
+func fileChecksum(path string) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, file)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// manifestRelPath makes a path relative to the manifest's directory, so the manifest
+// stays valid when the whole output directory is moved
+func manifestRelPath(path string) string {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	absDir, err := filepath.Abs(filepath.Dir(manifestPath))
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
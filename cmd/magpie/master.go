@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pigeonsec/magpie/internal/stats"
+)
+
+// defaultBloomSize is the number of master domains the filter is sized for by default
+const defaultBloomSize = 2000000
+
+// loadMasterFilter returns the bloom filter of the -master list. The filter saved in the
+// data dir is reused while the list and -bloom-size are unchanged; otherwise it is rebuilt
+// from the list, which is read in the -format of the output. Reports whether it was rebuilt.
+func loadMasterFilter() (*stats.BloomFilter, bool, error) {
+	info, err := os.Stat(masterFile)
+	if err != nil {
+		return nil, false, err
+	}
+	source := stats.BloomSource{
+		Size:     info.Size(),
+		ModTime:  info.ModTime().UnixNano(),
+		Capacity: bloomSize,
+	}
+
+	dataPath, err := filepath.Abs(dataDir)
+	if err != nil {
+		return nil, false, err
+	}
+	filterPath := filepath.Join(dataPath, stats.MasterFilterFile)
+
+	// An unreadable filter is just rebuilt
+	if saved, err := stats.LoadBloomFilter(filterPath); err == nil && saved != nil && saved.Source == source {
+		return saved, false, nil
+	}
+
+	filter := stats.NewBloomFilter(bloomSize)
+	filter.Source = source
+
+	file, err := openOutput(masterFile)
+	if err != nil {
+		return nil, false, err
+	}
+	defer file.Close()
+
+	parse := outputFormats[outputFormat].parse
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if domain, ok := parse(scanner.Text()); ok {
+			filter.Add(domain)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, false, fmt.Errorf("reading %s: %w", masterFile, err)
+	}
+
+	if !dryRun {
+		if err := os.MkdirAll(dataPath, 0755); err != nil {
+			return nil, false, err
+		}
+		if err := filter.Save(filterPath); err != nil {
+			return nil, false, err
+		}
+	}
+	return filter, true, nil
+}
+
+// masterNote reports the domains skipped because the master list already has them
+func masterNote(inMaster int) string {
+	return fmt.Sprintf("Master list: %s domains already in %s skipped (bloom filter, ~%.1f%% false positives)",
+		formatSize(inMaster), masterFile, stats.BloomFalsePositiveRate*100)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pigeonsec/magpie/internal/stats"
+)
+
+// runMergeStats merges the -merge-stats data-dirs and either saves the result to
+// -merge-output or displays it as the stats table
+func runMergeStats() {
+	policy, err := stats.ParseBlacklistPolicy(mergePolicy)
+	if err != nil {
+		log.Fatalf("Invalid -merge-policy: %v", err)
+	}
+
+	since, err := parseSince(statsSince)
+	if err != nil {
+		log.Fatalf("Invalid -since value: %v", err)
+	}
+
+	var dirs []string
+	for _, dir := range strings.Split(mergeStats, ",") {
+		if dir = strings.TrimSpace(dir); dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	if len(dirs) == 0 {
+		log.Fatalf("-merge-stats needs at least one data-dir")
+	}
+
+	merged, err := stats.MergeDirs(dirs, policy)
+	if err != nil {
+		log.Fatalf("Failed to merge stats: %v", err)
+	}
+
+	if mergeOutput == "" {
+		displayStatsTable(merged, since)
+		return
+	}
+
+	outPath, err := filepath.Abs(mergeOutput)
+	if err != nil {
+		log.Fatalf("Failed to resolve merge output directory: %v", err)
+	}
+	if err := os.MkdirAll(outPath, 0755); err != nil {
+		log.Fatalf("Failed to create merge output directory: %v", err)
+	}
+	lockDataDir(outPath)
+
+	merged.DataDir = outPath
+	if err := merged.Save(); err != nil {
+		log.Fatalf("Failed to save merged stats: %v", err)
+	}
+	fmt.Printf("Merged %d sources from %d data-dirs (%s policy) into %s\n",
+		len(merged.Stats), len(dirs), policy, filepath.Join(outPath, stats.StatsFile))
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/pigeonsec/magpie/pkg/magpie"
+)
+
+// lineFormat is how one -format renders the output file
+type lineFormat struct {
+	// line renders one domain
+	line func(domain string) string
+	// comment starts a comment line (used by -group-by-source)
+	comment string
+	// header returns lines written before the domains; nil for none
+	header func(domains []string) ([]string, error)
+	// parse reads the domain back from an output line (used by -diff and -master)
+	parse func(line string) (string, bool)
+	// wildcard renders a domain with all its subdomains; nil if the format can't
+	wildcard func(domain string) string
+}
+
+// outputFormats are the supported -format values, the library formats with the zone
+// serial filled in per -zone-serial
+var outputFormats = cliFormats()
+
+// cliFormats wraps each magpie.Format; only zone formats compute a serial, since the date
+// strategy bumps a counter in -data-dir
+func cliFormats() map[string]lineFormat {
+	formats := make(map[string]lineFormat, len(magpie.Formats))
+	for name, f := range magpie.Formats {
+		format := lineFormat{line: f.Line, comment: f.Comment, parse: f.Parse, wildcard: f.Wildcard}
+		if header, zone := f.Header, f.Serial; header != nil {
+			format.header = func(domains []string) ([]string, error) {
+				var serial uint32
+				if zone {
+					var err error
+					if serial, err = zoneSerial(domains); err != nil {
+						return nil, err
+					}
+				}
+				return header(serial), nil
+			}
+		}
+		formats[name] = format
+	}
+	return formats
+}
+
+// listSources are the sources named by -list-header, set once the fetch is done
+var listSources []string
+
+// fetchedSources returns the sources that contributed domains, in source file order
+func fetchedSources(urls []string, sourceDomains map[string]int) []string {
+	var sources []string
+	for _, url := range urls {
+		if sourceDomains[url] > 0 {
+			sources = append(sources, url)
+		}
+	}
+	return sources
+}
+
+// addListHeader puts the -list-header comments in front of the -format's own header,
+// so every writer (including -append and -unbound-chunk) starts its file with them
+func addListHeader() {
+	format := outputFormats[outputFormat]
+	header := format.header
+	format.header = func(domains []string) ([]string, error) {
+		lines := listHeaderLines(format.comment, len(domains), time.Now())
+		if header == nil {
+			return lines, nil
+		}
+		more, err := header(domains)
+		if err != nil {
+			return nil, err
+		}
+		return append(lines, more...), nil
+	}
+	outputFormats[outputFormat] = format
+}
+
+// listHeaderLines describes the list in comment lines: when and by which Magpie version
+// it was generated, how many entries it holds and which sources they came from
+func listHeaderLines(comment string, entries int, now time.Time) []string {
+	lines := []string{
+		fmt.Sprintf("%s Generated by Magpie %s", comment, version),
+		fmt.Sprintf("%s Generated at: %s", comment, now.UTC().Format(time.RFC3339)),
+		fmt.Sprintf("%s Entries: %d", comment, entries),
+		fmt.Sprintf("%s Sources: %d", comment, len(listSources)),
+	}
+	for _, url := range listSources {
+		lines = append(lines, fmt.Sprintf("%s   %s", comment, url))
+	}
+	return append(lines, comment)
+}
+
+// wildcardDomains are the domains listed as leading-dot entries, set once the fetch is done
+var wildcardDomains map[string]struct{}
+
+// addWildcards makes the -format write the domains in wildcardDomains with its wildcard
+// rendering, for -wildcards. Formats that can't express one are an error.
+func addWildcards() error {
+	format := outputFormats[outputFormat]
+	if format.wildcard == nil {
+		return fmt.Errorf("-format %s can't express wildcard entries", outputFormat)
+	}
+	line, wildcard := format.line, format.wildcard
+	format.line = func(domain string) string {
+		if _, ok := wildcardDomains[domain]; ok {
+			return wildcard(domain)
+		}
+		return line(domain)
+	}
+	outputFormats[outputFormat] = format
+	return nil
+}
+
+// writeMainOutput writes -output, merging into the existing file with -append (or
+// finishing the -stream-output file), and returns how many domains the file holds
+func writeMainOutput(domains []string, attribution *magpie.Attribution) (int, error) {
+	if validStream != nil {
+		return validStream.Close()
+	}
+	if appendOutput {
+		return writeAppended(outputFile, domains)
+	}
+	if unboundChunk > 0 {
+		return len(domains), writeChunkedOutput(outputFile, domains)
+	}
+	return len(domains), writeOutput(outputFile, domains, attribution)
+}
+
+// writeOutput writes the domains in the configured -format. With attribution (from
+// -group-by-source) the domains are grouped under a "From: <url>" comment per source,
+// in source file order and sorted within each group (by -sort, alpha for none).
+func writeOutput(path string, domains []string, attribution *magpie.Attribution) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	format := outputFormats[outputFormat]
+
+	// Use larger buffer for better write performance with large lists
+	writer := bufio.NewWriterSize(file, 256*1024) // 256KB buffer
+	if format.header != nil {
+		header, err := format.header(domains)
+		if err != nil {
+			return err
+		}
+		for _, line := range header {
+			fmt.Fprintln(writer, line)
+		}
+	}
+
+	if attribution == nil {
+		for _, domain := range domains {
+			fmt.Fprintln(writer, format.line(domain))
+		}
+		return writer.Flush()
+	}
+
+	// Domains without a known source (shouldn't happen) go in a final group
+	groups := make([][]string, len(attribution.URLs)+1)
+	for _, domain := range domains {
+		idx, ok := attribution.Source[domain]
+		if !ok {
+			idx = len(attribution.URLs)
+		}
+		groups[idx] = append(groups[idx], domain)
+	}
+
+	first := true
+	for idx, group := range groups {
+		if len(group) == 0 {
+			continue
+		}
+		if !first {
+			fmt.Fprintln(writer)
+		}
+		first = false
+
+		if idx < len(attribution.URLs) {
+			fmt.Fprintf(writer, "%s From: %s\n", format.comment, attribution.URLs[idx])
+		} else {
+			fmt.Fprintf(writer, "%s From: unknown source\n", format.comment)
+		}
+		slices.SortFunc(group, magpie.DomainCompare(sortOrder))
+		for _, domain := range group {
+			fmt.Fprintln(writer, format.line(domain))
+		}
+	}
+	return writer.Flush()
+}
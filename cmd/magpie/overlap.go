@@ -0,0 +1,23 @@
+package main
+
+// overlapConflict returns the first flag that needs the complete domain set before
+// validation starts and so can't be combined with -overlap, or "" if there is none
+func overlapConflict() string {
+	switch {
+	case maxPerTLD > 0:
+		return "-max-per-tld"
+	case domainLimit > 0:
+		return "-limit"
+	}
+	return ""
+}
+
+// overlapSkip is the Skip hook of an -overlap run: allowlisted and pattern-filtered
+// domains stay out of validation. applyAllowlist and applyPatterns still remove and
+// count them once the fetch is done.
+func overlapSkip(domain string) bool {
+	if len(allowDomains) > 0 && allowlisted(domain, allowDomains) {
+		return true
+	}
+	return patternsEnabled() && patternVerdict(domain) >= 0
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// patternList collects a repeatable regular expression flag (-include / -exclude).
+// Each pattern is compiled as the flag is parsed, so a bad one stops the run at startup.
+type patternList []*regexp.Regexp
+
+func (p *patternList) String() string {
+	sources := make([]string, len(*p))
+	for i, re := range *p {
+		sources[i] = re.String()
+	}
+	return strings.Join(sources, ", ")
+}
+
+func (p *patternList) Set(value string) error {
+	re, err := regexp.Compile(value)
+	if err != nil {
+		return err
+	}
+	*p = append(*p, re)
+	return nil
+}
+
+// patternVerdict returns which pattern drops a domain: -1 when it passes, len(excludePatterns)
+// when it matches no -include, otherwise the index of the first -exclude it matches
+func patternVerdict(domain string) int {
+	if len(includePatterns) > 0 && !matchesAny(domain, includePatterns) {
+		return len(excludePatterns)
+	}
+	for i, re := range excludePatterns {
+		if re.MatchString(domain) {
+			return i
+		}
+	}
+	return -1
+}
+
+func matchesAny(domain string, patterns patternList) bool {
+	for _, re := range patterns {
+		if re.MatchString(domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// patternsEnabled reports whether -include or -exclude was given
+func patternsEnabled() bool {
+	return len(includePatterns) > 0 || len(excludePatterns) > 0
+}
+
+// applyPatterns removes the domains dropped by -include / -exclude in one pass. It returns
+// how many matched no -include and how many each -exclude removed, in flag order.
+func applyPatterns(domains map[string]struct{}) (notIncluded int, excluded []int) {
+	if !patternsEnabled() {
+		return 0, nil
+	}
+
+	counts := make([]int, len(excludePatterns)+1)
+	for domain := range domains {
+		if verdict := patternVerdict(domain); verdict >= 0 {
+			delete(domains, domain)
+			counts[verdict]++
+		}
+	}
+	return counts[len(excludePatterns)], counts[:len(excludePatterns)]
+}
+
+// formatPatternCounts renders the removals of applyPatterns, e.g.
+// "3 matched no -include, \.local$ removed 12, ^corp- removed 0"
+func formatPatternCounts(notIncluded int, excluded []int) string {
+	var parts []string
+	if len(includePatterns) > 0 {
+		parts = append(parts, fmt.Sprintf("%s matched no -include", formatSize(notIncluded)))
+	}
+	for i, count := range excluded {
+		parts = append(parts, fmt.Sprintf("%s removed %s", excludePatterns[i], formatSize(count)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// patternsRemoved totals the removals of applyPatterns
+func patternsRemoved(notIncluded int, excluded []int) int {
+	total := notIncluded
+	for _, count := range excluded {
+		total += count
+	}
+	return total
+}
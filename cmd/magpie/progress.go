@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/pigeonsec/magpie/internal/ui"
+	"github.com/pigeonsec/magpie/pkg/magpie"
+	"golang.org/x/term"
+)
+
+// logLine is the magpie.Config Log hook of log mode: the key events go through logEvent,
+// the other lines straight to the log
+func logLine(event, text string, fields ...any) {
+	if event == "" {
+		log.Print(text)
+		return
+	}
+	logEvent(event, text, fields...)
+}
+
+// logProgress reports the validation of a log-mode run: a progress bar on a terminal,
+// otherwise a line every 10k domains
+type logProgress struct {
+	mu      sync.Mutex
+	program *tea.Program
+	start   time.Time
+}
+
+// begin is the OnValidationStart hook; total is 0 while an -overlap fetch is running
+func (p *logProgress) begin(total int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.start = time.Now()
+
+	if term.IsTerminal(int(os.Stdout.Fd())) {
+		p.program = tea.NewProgram(ui.NewProgressModel(total))
+		go func() {
+			if _, err := p.program.Run(); err != nil {
+				log.Printf("Error running progress UI: %v", err)
+			}
+		}()
+		return
+	}
+
+	// Simple logging for non-TTY (pipes, files, cronjobs)
+	if total > 0 {
+		logEvent("validation started", fmt.Sprintf("Starting validation of %d domains with %d workers...", total, workers),
+			"domains", total, "workers", workers)
+	} else {
+		logEvent("validation started", fmt.Sprintf("Starting validation with %d workers, fed as sources are fetched...", workers),
+			"workers", workers, "overlap", true)
+	}
+}
+
+// update is the OnProgress hook
+func (p *logProgress) update(progress magpie.ValidationProgress) {
+	if p.program != nil {
+		p.program.Send(ui.UpdateProgress(progress.Checked, progress.Total, progress.Valid, progress.Invalid))
+		return
+	}
+
+	// Non-TTY: Log every 10k domains
+	if progress.Checked%10000 != 0 && progress.Checked != progress.Total {
+		return
+	}
+	speed := float64(progress.Checked) / time.Since(p.start).Seconds()
+	switch {
+	case structured != nil:
+		structured.Info("validation progress", "checked", progress.Checked, "total", progress.Total,
+			"valid", progress.Valid, "invalid", progress.Invalid, "domains_per_second", speed)
+	case progress.Total > 0:
+		log.Printf("Progress: %d/%d (%.1f%%) - %d valid, %d invalid - %.0f domains/s",
+			progress.Checked, progress.Total, float64(progress.Checked)/float64(progress.Total)*100,
+			progress.Valid, progress.Invalid, speed)
+	default:
+		log.Printf("Progress: %d checked, fetch still running - %d valid, %d invalid - %.0f domains/s",
+			progress.Checked, progress.Valid, progress.Invalid, speed)
+	}
+}
+
+// end stops the progress bar, if any, once validation is over or before the second
+// pass logs; it is safe to call more than once
+func (p *logProgress) end() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.program == nil {
+		return
+	}
+	p.program.Send(ui.SendDone())
+	p.program.Wait()
+	p.program = nil
+}
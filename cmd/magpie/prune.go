@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/pigeonsec/magpie/internal/stats"
+)
+
+// runPruneStats drops the tracked sources that are no longer in the -source file, and
+// with -prune-age those not checked within that window, then saves the stats and prints
+// what was pruned
+func runPruneStats() {
+	if sourceFile == "" {
+		log.Fatalf("-prune-stats needs -source to know which sources are still in use")
+	}
+	maxAge, err := parseSince(pruneAge)
+	if err != nil {
+		log.Fatalf("Invalid -prune-age value: %v", err)
+	}
+
+	sources, err := loadURLs(sourceFile)
+	if err != nil {
+		log.Fatalf("Failed to load source file: %v", err)
+	}
+	listed := make(map[string]struct{}, len(sources))
+	for _, src := range sources {
+		listed[src.URL] = struct{}{}
+	}
+
+	dataPath, err := filepath.Abs(dataDir)
+	if err != nil {
+		log.Fatalf("Failed to resolve data directory: %v", err)
+	}
+	if !dryRun {
+		lockDataDir(dataPath)
+	}
+	tracker, err := stats.NewTracker(dataPath)
+	if err != nil {
+		log.Fatalf("Failed to load stats: %v", err)
+	}
+
+	now := time.Now()
+	tracked := len(tracker.Stats)
+	reasons := make(map[string]string)
+	unlisted := 0
+	pruned := tracker.Prune(func(url string, stat *stats.URLStats) bool {
+		_, isListed := listed[url]
+		switch {
+		case !isListed:
+			reasons[url] = "not in " + sourceFile
+			unlisted++
+		case maxAge > 0 && stat.LastChecked.IsZero():
+			reasons[url] = "never checked"
+		case maxAge > 0 && now.Sub(stat.LastChecked) > maxAge:
+			reasons[url] = "last checked " + formatTimeSince(stat.LastChecked)
+		default:
+			return false
+		}
+		return true
+	})
+
+	verb := "Pruned"
+	if dryRun {
+		verb = "Would prune"
+	}
+	for _, url := range pruned {
+		fmt.Printf("%s: %s (%s)\n", verb, url, reasons[url])
+	}
+	summary := fmt.Sprintf("%d of %d sources (%d not in %s", len(pruned), tracked, unlisted, sourceFile)
+	if maxAge > 0 {
+		summary += fmt.Sprintf(", %d not checked within %s", len(pruned)-unlisted, pruneAge)
+	}
+	summary += ")"
+
+	if dryRun {
+		fmt.Printf("Dry run: %s would be pruned, %s not changed\n", summary, stats.StatsFile)
+		return
+	}
+	if len(pruned) > 0 {
+		if err := tracker.Save(); err != nil {
+			log.Fatalf("Failed to save stats: %v", err)
+		}
+	}
+	fmt.Printf("Pruned %s from %s\n", summary, filepath.Join(dataPath, stats.StatsFile))
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/pigeonsec/magpie/internal/stats"
+)
+
+// urlList collects a repeatable URL flag
+type urlList []string
+
+func (u *urlList) String() string {
+	return strings.Join(*u, ", ")
+}
+
+func (u *urlList) Set(value string) error {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return fmt.Errorf("empty URL")
+	}
+	*u = append(*u, value)
+	return nil
+}
+
+// runReset clears the blacklist of the -reset URLs (or every source with -reset-all),
+// saves the stats and prints what was reset
+func runReset() {
+	dataPath, err := filepath.Abs(dataDir)
+	if err != nil {
+		log.Fatalf("Failed to resolve data directory: %v", err)
+	}
+
+	if !dryRun {
+		lockDataDir(dataPath)
+	}
+	tracker, err := stats.NewTracker(dataPath)
+	if err != nil {
+		log.Fatalf("Failed to load stats: %v", err)
+	}
+
+	var reset []string
+	if resetAll {
+		reset = tracker.ResetAll()
+	} else {
+		for _, url := range resetURLs {
+			if tracker.ResetURL(url) {
+				reset = append(reset, url)
+			} else {
+				fmt.Printf("Not tracked: %s\n", url)
+			}
+		}
+	}
+
+	if dryRun {
+		for _, url := range reset {
+			fmt.Printf("Would reset: %s\n", url)
+		}
+		fmt.Printf("Dry run: %d sources would be reset, %s not changed\n", len(reset), stats.StatsFile)
+		return
+	}
+
+	if len(reset) > 0 {
+		if err := tracker.Save(); err != nil {
+			log.Fatalf("Failed to save stats: %v", err)
+		}
+	}
+	for _, url := range reset {
+		fmt.Printf("Reset: %s\n", url)
+	}
+	fmt.Printf("Reset %d sources in %s\n", len(reset), filepath.Join(dataPath, stats.StatsFile))
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/pigeonsec/magpie/internal/stats"
+)
+
+// runStatsJSON writes the whole tracker (every source and the last run's global stats)
+// to -stats-json as JSON, or to stdout for "-", for dashboards that want the raw data
+func runStatsJSON() {
+	dataPath, err := filepath.Abs(dataDir)
+	if err != nil {
+		log.Fatalf("Failed to resolve data directory: %v", err)
+	}
+	tracker, err := stats.NewTracker(dataPath)
+	if err != nil {
+		log.Fatalf("Failed to load stats: %v", err)
+	}
+
+	var out io.Writer = os.Stdout
+	if statsJSON != "-" {
+		file, err := os.Create(statsJSON)
+		if err != nil {
+			log.Fatalf("Failed to create -stats-json file: %v", err)
+		}
+		defer file.Close()
+		out = file
+	}
+	if err := tracker.WriteJSON(out); err != nil {
+		log.Fatalf("Failed to write -stats-json: %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+// validStream receives valid domains during validation with -stream-output; nil otherwise
+var validStream *outputStream
+
+// outputStream writes valid domains to the output as validation finds them, from a
+// single goroutine, so the full list is never held in memory. The domains land in
+// <output>.tmp, which replaces the output once the stream is closed.
+type outputStream struct {
+	path    string
+	domains chan string
+	done    chan error
+	written int
+}
+
+// newOutputStream starts writing the configured -format to path.tmp
+func newOutputStream(path string) (*outputStream, error) {
+	format := outputFormats[outputFormat]
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return nil, err
+	}
+
+	writer := bufio.NewWriterSize(file, 256*1024)
+	if format.header != nil {
+		// Streaming allows only headers that don't depend on the domains (see streamConflict)
+		header, err := format.header(nil)
+		if err != nil {
+			file.Close()
+			os.Remove(tmp)
+			return nil, err
+		}
+		for _, line := range header {
+			fmt.Fprintln(writer, line)
+		}
+	}
+
+	s := &outputStream{
+		path:    path,
+		domains: make(chan string, workers*2),
+		done:    make(chan error, 1),
+	}
+	go func() {
+		for domain := range s.domains {
+			fmt.Fprintln(writer, format.line(domain))
+			s.written++
+		}
+		if err := writer.Flush(); err != nil {
+			file.Close()
+			os.Remove(tmp)
+			s.done <- err
+			return
+		}
+		if err := file.Close(); err != nil {
+			os.Remove(tmp)
+			s.done <- err
+			return
+		}
+		if s.path == "" {
+			s.done <- os.Remove(tmp)
+			return
+		}
+		s.done <- os.Rename(tmp, s.path)
+	}()
+	return s, nil
+}
+
+// Write queues a valid domain; safe for concurrent use until Close
+func (s *outputStream) Write(domain string) {
+	s.domains <- domain
+}
+
+// Close drains the queue, moves the output into place and returns how many domains it holds
+func (s *outputStream) Close() (int, error) {
+	return s.CloseTo(s.path)
+}
+
+// CloseTo is Close, but moves the file to path instead of the output (for an interrupted run)
+func (s *outputStream) CloseTo(path string) (int, error) {
+	s.path = path
+	close(s.domains)
+	err := <-s.done
+	return s.written, err
+}
+
+// Discard drains the queue and deletes what was written, leaving the output untouched
+func (s *outputStream) Discard() error {
+	_, err := s.CloseTo("")
+	return err
+}
+
+// streamConflict returns the first flag that needs the complete domain list and so can't
+// be combined with -stream-output, or "" if there is none
+func streamConflict() string {
+	sortSet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "sort" {
+			sortSet = true
+		}
+	})
+
+	switch {
+	case sortSet && sortOrder != "none":
+		return "-sort " + sortOrder
+	case appendOutput:
+		return "-append"
+	case diffOutput:
+		return "-diff"
+	case groupBySource:
+		return "-group-by-source"
+	case collapseSubs:
+		return "-collapse-subdomains"
+	case wildcardOutput:
+		return "-wildcards"
+	case unboundChunk > 0:
+		return "-unbound-chunk"
+	case trackFirstSeen || newlySeenDays > 0:
+		return "-first-seen"
+	case bucketBy != "":
+		return "-bucket-by"
+	case listHeader:
+		return "-list-header"
+	case outputFormats[outputFormat].header != nil && zoneSerialStrategy == "hash":
+		return "-zone-serial hash"
+	}
+	return ""
+}
+
+// startValidStream opens validStream for the run unless -stream-output is off or this is a dry run
+func startValidStream() error {
+	if !streamOutput || dryRun {
+		return nil
+	}
+	stream, err := newOutputStream(outputFile)
+	if err != nil {
+		return err
+	}
+	validStream = stream
+	return nil
+}
+
+// discardValidStream drops validStream, if open, for a run that ends without output
+func discardValidStream() {
+	if validStream == nil {
+		return
+	}
+	if err := validStream.Discard(); err != nil {
+		log.Printf("Warning: Failed to remove %s.tmp: %v", outputFile, err)
+	}
+	validStream = nil
+}
+
+// keepValid hands a valid domain to validStream, or returns true if the caller should
+// collect it
+func keepValid(domain string) bool {
+	if validStream != nil {
+		validStream.Write(domain)
+		return false
+	}
+	return true
+}
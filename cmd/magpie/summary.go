@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// summaryStdout is where -json-summary - writes; main points os.Stdout at stderr for
+// everything else so the JSON can be piped on its own
+var summaryStdout = os.Stdout
+
+// sourceFailure is one source that failed to fetch
+type sourceFailure struct {
+	URL   string `json:"url"`
+	Error string `json:"error"`
+}
+
+// runSummary is the machine-readable -json-summary of a run
+type runSummary struct {
+	Version           string          `json:"version"`
+	StartedAt         time.Time       `json:"started_at"`
+	FinishedAt        time.Time       `json:"finished_at"`
+	DurationSeconds   float64         `json:"duration_seconds"`
+	ConnectSeconds    float64         `json:"connect_seconds"`
+	FetchSeconds      float64         `json:"fetch_seconds"`
+	ValidationSeconds float64         `json:"validation_seconds"`
+	WriteSeconds      float64         `json:"write_seconds"`
+	DryRun            bool            `json:"dry_run"`
+	OutputFile        string          `json:"output_file"`
+	Format            string          `json:"format"`
+	ValidationMethod  string          `json:"validation_method"`
+	URLs              summaryURLs     `json:"urls"`
+	Domains           summaryDomains  `json:"domains"`
+	Errors            []sourceFailure `json:"errors"`
+	NewlyBlacklisted  []string        `json:"newly_blacklisted"`
+	Notes             []string        `json:"notes"`
+}
+
+type summaryURLs struct {
+	Total    int `json:"total"`
+	Fetched  int `json:"fetched"`
+	Filtered int `json:"filtered"`
+	Failed   int `json:"failed"`
+}
+
+type summaryDomains struct {
+	Found      int `json:"found"`
+	Valid      int `json:"valid"`
+	Invalid    int `json:"invalid"`
+	Duplicates int `json:"duplicates"`
+	// Written is the domain count of the output file (larger than Valid with -append)
+	Written int `json:"written"`
+}
+
+// newRunSummary builds the summary of a finished run; totalURLs includes filtered sources
+func newRunSummary(aggStats *AggregationStats, totalURLs, written int, method string) *runSummary {
+	now := time.Now()
+	summary := &runSummary{
+		Version:           version,
+		StartedAt:         runStart,
+		FinishedAt:        now,
+		DurationSeconds:   now.Sub(runStart).Seconds(),
+		ConnectSeconds:    aggStats.ConnectDuration.Seconds(),
+		FetchSeconds:      aggStats.FetchDuration.Seconds(),
+		ValidationSeconds: aggStats.ValidationDuration.Seconds(),
+		WriteSeconds:      aggStats.WriteDuration.Seconds(),
+		DryRun:            dryRun,
+		OutputFile:        outputFile,
+		Format:            outputFormat,
+		ValidationMethod:  method,
+		URLs: summaryURLs{
+			Total:    totalURLs,
+			Fetched:  aggStats.URLsFetched,
+			Filtered: aggStats.URLsFiltered,
+			Failed:   len(aggStats.Failures),
+		},
+		Domains: summaryDomains{
+			Found:      aggStats.DomainsFound,
+			Valid:      aggStats.DomainsValid,
+			Invalid:    aggStats.DomainsInvalid,
+			Duplicates: aggStats.DuplicatesFound,
+			Written:    written,
+		},
+		Errors:           aggStats.Failures,
+		NewlyBlacklisted: aggStats.NewlyBlacklisted,
+		Notes:            aggStats.Notes,
+	}
+
+	// Empty lists rather than null keep jq filters simple
+	if summary.Errors == nil {
+		summary.Errors = []sourceFailure{}
+	}
+	if summary.NewlyBlacklisted == nil {
+		summary.NewlyBlacklisted = []string{}
+	}
+	if summary.Notes == nil {
+		summary.Notes = []string{}
+	}
+	return summary
+}
+
+// writeRunSummary writes the summary to -json-summary, or to stdout for "-"
+func writeRunSummary(summary *runSummary) error {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if jsonSummary == "-" {
+		_, err := summaryStdout.Write(data)
+		return err
+	}
+	return os.WriteFile(jsonSummary, data, 0644)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// sourceAnnotation matches the start of a "#tags:" or "#priority:" annotation. It has to
+// follow whitespace, so a '#' inside the URL stays part of it.
+var sourceAnnotation = regexp.MustCompile(`\s#(tags|priority):`)
+
+// source is one entry of the sources file
+type source struct {
+	URL string
+	// Tags are the lowercased categories given after #tags:, nil for an untagged source
+	Tags []string
+	// Priority orders the fetch, highest first (#priority:, default 0)
+	Priority int
+}
+
+// sourcePriority holds the #priority: of each source that has one; higher ones are fetched first
+var sourcePriority map[string]int
+
+// parseSourceLine splits a sources file line into the URL and its inline annotations, as
+// in "https://example.com/ads.txt #tags: ads,tracking #priority: 10"
+func parseSourceLine(line string) (source, error) {
+	matches := sourceAnnotation.FindAllStringSubmatchIndex(line, -1)
+	if len(matches) == 0 {
+		return source{URL: line}, nil
+	}
+
+	src := source{URL: strings.TrimSpace(line[:matches[0][0]])}
+	for i, match := range matches {
+		end := len(line)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		value := strings.TrimSpace(line[match[1]:end])
+
+		switch line[match[2]:match[3]] {
+		case "tags":
+			src.Tags = parseTags(value)
+		case "priority":
+			priority, err := strconv.Atoi(value)
+			if err != nil {
+				return src, fmt.Errorf("invalid #priority: %q", value)
+			}
+			src.Priority = priority
+		}
+	}
+	return src, nil
+}
+
+// parseTags reads a comma-separated tag list, lowercased and without empty entries
+func parseTags(list string) []string {
+	var tags []string
+	for _, tag := range strings.Split(list, ",") {
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// selectSources returns the URLs of the sources carrying any of tags, or of all sources
+// when no tag is requested. Untagged sources are only included in the second case.
+// The priorities of the selected sources are recorded in sourcePriority.
+func selectSources(sources []source, tags []string) []string {
+	var urls []string
+	sourcePriority = make(map[string]int)
+	for _, src := range sources {
+		if len(tags) > 0 && !slices.ContainsFunc(src.Tags, func(tag string) bool { return slices.Contains(tags, tag) }) {
+			continue
+		}
+		urls = append(urls, src.URL)
+		if src.Priority != 0 {
+			sourcePriority[src.URL] = src.Priority
+		}
+	}
+	return urls
+}
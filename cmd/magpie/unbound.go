@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pigeonsec/magpie/pkg/magpie"
+)
+
+// chunkPath returns the path of chunk n (from 1) of a chunked output, e.g.
+// blocklist.conf -> blocklist.003.conf
+func chunkPath(path string, n int) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s.%03d%s", strings.TrimSuffix(path, ext), n, ext)
+}
+
+// writeChunkedOutput writes the domains as files of at most -unbound-chunk domains each,
+// every one a complete server: clause, and replaces path with an index of include:
+// statements for them. Include paths are absolute because Unbound resolves them against
+// its working directory (or chroot), not the including file. Chunks left over from an
+// earlier, larger run are removed so a glob include doesn't pick them up.
+func writeChunkedOutput(path string, domains []string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	chunks := (len(domains) + unboundChunk - 1) / unboundChunk
+	var index bytes.Buffer
+	fmt.Fprintf(&index, "# %d domains in %d files of up to %d\n", len(domains), chunks, unboundChunk)
+	for n := 1; n <= chunks; n++ {
+		start := (n - 1) * unboundChunk
+		end := min(start+unboundChunk, len(domains))
+		chunk := chunkPath(absPath, n)
+		if err := writeOutput(chunk, domains[start:end], nil); err != nil {
+			return err
+		}
+		fmt.Fprintf(&index, "include: \"%s\"\n", chunk)
+	}
+
+	for n := chunks + 1; ; n++ {
+		if err := os.Remove(chunkPath(absPath, n)); err != nil {
+			break
+		}
+	}
+
+	return os.WriteFile(path, index.Bytes(), 0644)
+}
+
+// openOutput opens an output file for reading its domains back. For a chunked index
+// (include: "file" lines after the leading comment) it returns the included files in
+// order instead.
+func openOutput(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var chunks []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		chunk, ok := magpie.Between(line, `include: "`, `"`)
+		if !ok {
+			break
+		}
+		chunks = append(chunks, chunk)
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	// A regular output: read it from the start
+	if len(chunks) == 0 {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			file.Close()
+			return nil, err
+		}
+		return file, nil
+	}
+	file.Close()
+
+	var files []*os.File
+	var readers []io.Reader
+	closeAll := func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}
+	for _, chunk := range chunks {
+		file, err := os.Open(chunk)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		files = append(files, file)
+		readers = append(readers, file)
+	}
+	return multiReadCloser{io.MultiReader(readers...), closeAll}, nil
+}
+
+// multiReadCloser reads several files as one and closes them together
+type multiReadCloser struct {
+	io.Reader
+	closeAll func()
+}
+
+func (m multiReadCloser) Close() error {
+	m.closeAll()
+	return nil
+}
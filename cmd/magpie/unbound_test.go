@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var (
+	localZoneLine = regexp.MustCompile(`^  local-zone: "([^"]+)\." redirect$`)
+	localDataLine = regexp.MustCompile(`^  local-data: "([^"]+)\. (A 0\.0\.0\.0|AAAA ::)"$`)
+	includeLine   = regexp.MustCompile(`^include: "([^"]+)"$`)
+)
+
+// setChunkFlags switches the output to -format unbound with -unbound-chunk chunk for a
+// test and restores the flags once it is done
+func setChunkFlags(t *testing.T, chunk int) {
+	t.Helper()
+	prevFormat, prevChunk := outputFormat, unboundChunk
+	outputFormat, unboundChunk = "unbound", chunk
+	t.Cleanup(func() { outputFormat, unboundChunk = prevFormat, prevChunk })
+}
+
+// readUnboundChunk checks one chunk the way unbound reads it: a server: clause holding a
+// redirect local-zone per domain, each followed by its A and AAAA local-data inside the
+// zone. It returns the zones in file order.
+func readUnboundChunk(t *testing.T, path string) []string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var (
+		zones []string
+		zone  string
+		data  []string
+		seen  bool
+	)
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		switch m := localDataLine.FindStringSubmatch(line); {
+		case strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#"):
+		case !seen:
+			if line != "server:" {
+				t.Fatalf("%s:%d: %q before the server: clause", path, n, line)
+			}
+			seen = true
+		case localZoneLine.MatchString(line):
+			if zone != "" && len(data) != 2 {
+				t.Errorf("%s: zone %s has local-data %v, want A and AAAA", path, zone, data)
+			}
+			zone = localZoneLine.FindStringSubmatch(line)[1]
+			zones = append(zones, zone)
+			data = nil
+		case m != nil:
+			if zone == "" || m[1] != zone {
+				t.Errorf("%s:%d: local-data for %s outside its local-zone %q", path, n, m[1], zone)
+			}
+			data = append(data, m[2])
+		default:
+			t.Errorf("%s:%d: unexpected line %q", path, n, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if !seen {
+		t.Fatalf("%s: no server: clause", path)
+	}
+	if zone != "" && len(data) != 2 {
+		t.Errorf("%s: zone %s has local-data %v, want A and AAAA", path, zone, data)
+	}
+	return zones
+}
+
+func TestWriteChunkedOutput(t *testing.T) {
+	setChunkFlags(t, 2)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "blocklist.conf")
+	domains := []string{"a.example.com", "b.example.com", "c.example.net", "d.example.org", "e.example.org"}
+
+	// Chunks of an earlier, larger run
+	for n := 4; n <= 5; n++ {
+		if err := os.WriteFile(chunkPath(path, n), []byte("server:\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := writeChunkedOutput(path, domains); err != nil {
+		t.Fatalf("writeChunkedOutput: %v", err)
+	}
+
+	index, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(index), "\n"), "\n")
+	if want := "# 5 domains in 3 files of up to 2"; lines[0] != want {
+		t.Errorf("index starts with %q, want %q", lines[0], want)
+	}
+
+	var got []string
+	for n, line := range lines[1:] {
+		m := includeLine.FindStringSubmatch(line)
+		if m == nil {
+			t.Fatalf("index line %q isn't an include: statement", line)
+		}
+		if !filepath.IsAbs(m[1]) {
+			t.Errorf("include path %s isn't absolute", m[1])
+		}
+		if want := chunkPath(path, n+1); m[1] != want {
+			t.Errorf("include %d is %s, want %s", n+1, m[1], want)
+		}
+		zones := readUnboundChunk(t, m[1])
+		if len(zones) > unboundChunk {
+			t.Errorf("%s holds %d domains, more than -unbound-chunk %d", m[1], len(zones), unboundChunk)
+		}
+		got = append(got, zones...)
+	}
+	if len(lines)-1 != 3 {
+		t.Errorf("index includes %d files, want 3", len(lines)-1)
+	}
+	if !slices.Equal(got, domains) {
+		t.Errorf("chunks hold %v, want %v", got, domains)
+	}
+
+	for n := 4; n <= 5; n++ {
+		if _, err := os.Stat(chunkPath(path, n)); !os.IsNotExist(err) {
+			t.Errorf("stale chunk %d left behind (%v)", n, err)
+		}
+	}
+
+	// -diff, -append and -master read a chunked output back through its index
+	reader, err := openOutput(path)
+	if err != nil {
+		t.Fatalf("openOutput: %v", err)
+	}
+	defer reader.Close()
+	var read []string
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		if domain, ok := outputFormats["unbound"].parse(scanner.Text()); ok {
+			read = append(read, domain)
+		}
+	}
+	if !slices.Equal(read, domains) {
+		t.Errorf("openOutput read %v, want %v", read, domains)
+	}
+
+	checkUnboundConf(t, dir, path)
+}
+
+// checkUnboundConf runs unbound-checkconf on a config including the index, when it is
+// installed
+func checkUnboundConf(t *testing.T, dir, index string) {
+	t.Helper()
+	checkconf, err := exec.LookPath("unbound-checkconf")
+	if err != nil {
+		t.Log("unbound-checkconf not on PATH, skipping the check with unbound itself")
+		return
+	}
+
+	conf := filepath.Join(dir, "unbound.conf")
+	content := fmt.Sprintf("server:\n  chroot: \"\"\n  username: \"\"\n  directory: %q\ninclude: %q\n", dir, index)
+	if err := os.WriteFile(conf, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command(checkconf, conf).CombinedOutput(); err != nil {
+		t.Errorf("unbound-checkconf: %v\n%s", err, out)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/pigeonsec/magpie/internal/validator"
+)
+
+// defaultWorkers is -workers without the flag
+const defaultWorkers = 100
+
+// workersFlag is -workers: a worker count, or "auto" for validator.AutoWorkers
+type workersFlag struct{}
+
+func (workersFlag) String() string {
+	if autoWorkers {
+		return "auto"
+	}
+	return strconv.Itoa(workers)
+}
+
+func (workersFlag) Set(value string) error {
+	if value == "auto" {
+		autoWorkers = true
+		return nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return errors.New("want a number of workers or auto")
+	}
+	workers, autoWorkers = n, false
+	return nil
+}
+
+// resolveWorkers settles -workers auto from the resolver count. The -bulk-resolver
+// endpoint isn't spread over resolvers, so it keeps the default.
+func resolveWorkers() {
+	if !autoWorkers {
+		return
+	}
+	if bulkResolver != "" {
+		workers = defaultWorkers
+		return
+	}
+	workers = validator.AutoWorkers(len(strings.Split(dnsResolvers, ",")), resolverQPS, dnsRecords)
+}
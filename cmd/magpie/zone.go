@@ -0,0 +1,52 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pigeonsec/magpie/internal/stats"
+)
+
+// zoneSerialStrategies are the accepted -zone-serial values
+var zoneSerialStrategies = []string{"date", "unix", "hash"}
+
+// runSerial is the serial shared by every zone file of this run (date and unix strategies)
+var runSerial uint32
+
+// zoneSerial returns the SOA serial for a zone holding domains. The date and unix
+// strategies give all zone files of a run the same serial; hash derives it from the
+// zone's content, so it only changes when the domains do.
+func zoneSerial(domains []string) (uint32, error) {
+	switch zoneSerialStrategy {
+	case "hash":
+		sorted := append([]string(nil), domains...)
+		sort.Strings(sorted)
+		h := sha256.New()
+		for _, domain := range sorted {
+			h.Write([]byte(domain))
+			h.Write([]byte{'\n'})
+		}
+		return binary.BigEndian.Uint32(h.Sum(nil)), nil
+	case "unix":
+		if runSerial == 0 {
+			runSerial = uint32(time.Now().Unix())
+		}
+		return runSerial, nil
+	default:
+		if runSerial == 0 {
+			dataPath, err := filepath.Abs(dataDir)
+			if err != nil {
+				return 0, err
+			}
+			serial, err := stats.NextDateSerial(dataPath, time.Now())
+			if err != nil {
+				return 0, err
+			}
+			runSerial = serial
+		}
+		return runSerial, nil
+	}
+}
@@ -0,0 +1,92 @@
+package fetcher
+
+import "strings"
+
+// RuleType says what a blocklist line asks for
+type RuleType int
+
+const (
+	RuleBlock       RuleType = iota // a domain to block
+	RuleAllow                       // an @@ exception that unblocks a domain
+	RuleCosmetic                    // element hiding (example.com##.ad) - not DNS-level
+	RuleRegex                       // /regex/ rule - can't be expressed as domains
+	RuleUnsupported                 // Adblock rule scoped to paths, pages or request types
+)
+
+// String returns a short name for the rule type
+func (t RuleType) String() string {
+	switch t {
+	case RuleBlock:
+		return "block"
+	case RuleAllow:
+		return "allow"
+	case RuleCosmetic:
+		return "cosmetic"
+	case RuleRegex:
+		return "regex"
+	default:
+		return "unsupported"
+	}
+}
+
+// Rule is a parsed blocklist line. Domain is only set for block and allow rules.
+type Rule struct {
+	Domain string
+	Type   RuleType
+	// Subdomains marks a leading-dot block entry (".example.com", AdGuard DNS style),
+	// meant to block the domain and all its subdomains
+	Subdomains bool
+}
+
+// cosmeticMarkers separate the domains of an element hiding / scriptlet rule from its selector
+var cosmeticMarkers = []string{"##", "#@#", "#?#", "#@?#", "#$#", "#@$#", "#%#", "#@%#"}
+
+// dnsLevelOptions are the Adblock $options that still apply to the whole domain.
+// Anything else ($domain=, $script, $badfilter, ...) narrows the rule below what a
+// DNS blocker can enforce.
+var dnsLevelOptions = map[string]bool{
+	"third-party": true, "3p": true,
+	"first-party": true, "1p": true,
+	"important": true,
+	"all":       true,
+	"document":  true, "doc": true,
+	"popup": true,
+}
+
+// isCosmeticRule reports element hiding and scriptlet rules, which must be recognised
+// before inline '#' comments are cut
+func isCosmeticRule(line string) bool {
+	for _, marker := range cosmeticMarkers {
+		if strings.Contains(line, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// isRegexRule reports /regex/ rules, optionally followed by $options
+func isRegexRule(line string) bool {
+	return strings.HasPrefix(line, "/") && strings.LastIndex(line, "/") > 0
+}
+
+// adblockHost extracts the domain of a ||domain^ rule. It fails for rules that only
+// block part of a domain (a path, a wildcard) or carry page-level options.
+func adblockHost(rule string) (string, bool) {
+	rest := strings.TrimPrefix(rule, "||")
+
+	if idx := strings.Index(rest, "$"); idx != -1 {
+		for _, option := range strings.Split(rest[idx+1:], ",") {
+			if !dnsLevelOptions[strings.TrimPrefix(strings.TrimSpace(option), "~")] {
+				return "", false
+			}
+		}
+		rest = rest[:idx]
+	}
+
+	rest = strings.TrimSuffix(rest, "|")
+	rest = strings.TrimSuffix(rest, "^")
+	if rest == "" || strings.ContainsAny(rest, "/*^|") {
+		return "", false
+	}
+	return rest, true
+}
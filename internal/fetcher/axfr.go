@@ -0,0 +1,108 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// AXFRScheme marks sources fetched via DNS zone transfer: axfr://ns.example.com/zone.name
+	AXFRScheme = "axfr://"
+
+	// axfrTimeout bounds dialing and reading a zone transfer
+	axfrTimeout = 60 * time.Second
+)
+
+// IsAXFRSource reports whether a source should be fetched via zone transfer
+func IsAXFRSource(source string) bool {
+	return strings.HasPrefix(strings.ToLower(source), AXFRScheme)
+}
+
+// parseAXFRSource splits axfr://ns.example.com[:port]/zone.name into server address and zone
+func parseAXFRSource(source string) (string, string, error) {
+	parsed, err := url.Parse(source)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid AXFR source: %w", err)
+	}
+
+	server := parsed.Host
+	if server == "" {
+		return "", "", fmt.Errorf("invalid AXFR source %q: missing nameserver", source)
+	}
+	if parsed.Port() == "" {
+		server = net.JoinHostPort(parsed.Hostname(), "53")
+	}
+
+	zone := strings.Trim(parsed.Path, "/")
+	if zone == "" {
+		return "", "", fmt.Errorf("invalid AXFR source %q: missing zone name", source)
+	}
+
+	return server, dns.Fqdn(zone), nil
+}
+
+// fetchAXFR performs a zone transfer and returns the zone's owner names as domains.
+// RPZ zones carry blocked names relative to the zone apex, so that suffix is stripped.
+func (f *Fetcher) fetchAXFR(ctx context.Context, source string) ([]string, error) {
+	server, zone, err := parseAXFRSource(source)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := new(dns.Msg)
+	msg.SetAxfr(zone)
+
+	transfer := &dns.Transfer{
+		DialTimeout:  10 * time.Second,
+		ReadTimeout:  axfrTimeout,
+		WriteTimeout: 10 * time.Second,
+	}
+
+	envelopes, err := transfer.In(msg, server)
+	if err != nil {
+		return nil, fmt.Errorf("zone transfer of %s from %s failed: %w", zone, server, err)
+	}
+
+	domainMap := make(map[string]struct{})
+	for envelope := range envelopes {
+		if envelope.Error != nil {
+			return nil, fmt.Errorf("zone transfer of %s from %s failed: %w", zone, server, envelope.Error)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		for _, rr := range envelope.RR {
+			switch rr.Header().Rrtype {
+			case dns.TypeSOA, dns.TypeNS:
+				continue // zone apex records, not blocked names
+			}
+
+			name := strings.ToLower(rr.Header().Name)
+			if name == strings.ToLower(zone) {
+				continue
+			}
+			name = strings.TrimSuffix(name, "."+strings.ToLower(zone))
+
+			if domain, ok := NormalizeDomain(name); ok {
+				domainMap[domain] = struct{}{}
+			}
+		}
+	}
+
+	domains := make([]string, 0, len(domainMap))
+	for domain := range domainMap {
+		domains = append(domains, domain)
+	}
+
+	return domains, nil
+}
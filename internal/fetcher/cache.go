@@ -0,0 +1,181 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// CacheDir is the conditional fetch cache directory, inside the data directory
+const CacheDir = "fetch-cache"
+
+// cacheIndexFile lists the cached validators, inside the cache directory
+const cacheIndexFile = "index.json"
+
+// errNotModified reports a 304 answer to a conditional request
+var errNotModified = errors.New("not modified")
+
+// cacheEntry holds the validators of one cached source
+type cacheEntry struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	File         string `json:"file"`
+}
+
+// FetchCache keeps the last body of each source with its ETag and Last-Modified
+// values, so the next fetch can be conditional. On 304 Not Modified the cached body
+// is used instead of downloading the list again.
+type FetchCache struct {
+	dir     string
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	hits    atomic.Int64
+}
+
+// NewFetchCache opens (or creates) the cache in dir
+func NewFetchCache(dir string) (*FetchCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	c := &FetchCache{dir: dir, entries: make(map[string]*cacheEntry)}
+	data, err := os.ReadFile(filepath.Join(dir, cacheIndexFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &c.entries); err != nil {
+		// A corrupt index only costs one full download per source
+		c.entries = make(map[string]*cacheEntry)
+	}
+	return c, nil
+}
+
+// Save writes the index of validators
+func (c *FetchCache) Save() error {
+	c.mu.Lock()
+	data, err := json.MarshalIndent(c.entries, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(c.dir, cacheIndexFile), data)
+}
+
+// Hits returns how many fetches were answered from the cache after a 304
+func (c *FetchCache) Hits() int {
+	return int(c.hits.Load())
+}
+
+// setConditionalHeaders adds If-None-Match / If-Modified-Since when a cached body exists
+func (c *FetchCache) setConditionalHeaders(req *http.Request, url string) {
+	c.mu.Lock()
+	entry, ok := c.entries[url]
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+	if _, err := os.Stat(filepath.Join(c.dir, entry.File)); err != nil {
+		return
+	}
+
+	if entry.ETag != "" {
+		req.Header.Set("If-None-Match", entry.ETag)
+	}
+	if entry.LastModified != "" {
+		req.Header.Set("If-Modified-Since", entry.LastModified)
+	}
+}
+
+// store caches a body with the response's validators. Responses without either
+// validator can't be revalidated, so they are forgotten instead.
+func (c *FetchCache) store(url string, header http.Header, body []byte) error {
+	etag, lastModified := header.Get("ETag"), header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		c.mu.Lock()
+		delete(c.entries, url)
+		c.mu.Unlock()
+		return nil
+	}
+
+	sum := sha256.Sum256([]byte(url))
+	file := hex.EncodeToString(sum[:8]) + ".txt"
+	if err := writeFileAtomic(filepath.Join(c.dir, file), body); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.entries[url] = &cacheEntry{ETag: etag, LastModified: lastModified, File: file}
+	c.mu.Unlock()
+	return nil
+}
+
+// body returns the cached body of a source after a 304
+func (c *FetchCache) body(url string) ([]byte, error) {
+	body, err := c.read(url)
+	if err != nil {
+		return nil, fmt.Errorf("not modified, but %w", err)
+	}
+	c.hits.Add(1)
+	return body, nil
+}
+
+// read returns the cached body of a source
+func (c *FetchCache) read(url string) ([]byte, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[url]
+	c.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no cached copy")
+	}
+
+	body, err := os.ReadFile(filepath.Join(c.dir, entry.File))
+	if err != nil {
+		return nil, fmt.Errorf("cached copy unreadable: %w", err)
+	}
+	return body, nil
+}
+
+// Reuse parses the cached copy of a source without contacting its server, for sources
+// the caller knows were fetched recently. ok is false when there is no cache or no usable
+// copy.
+func (f *Fetcher) Reuse(ctx context.Context, url string) (domains []string, ok bool) {
+	if f.Cache == nil {
+		return nil, false
+	}
+	body, err := f.Cache.read(url)
+	if err != nil {
+		return nil, false
+	}
+	domains, err = f.ParseBody(ctx, bytes.NewReader(body))
+	return domains, err == nil
+}
+
+// domainsBody renders parsed domains as a plain list for the cache
+func domainsBody(domains []string) []byte {
+	if len(domains) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(domains, "\n") + "\n")
+}
+
+// writeFileAtomic writes data to a temp file and renames it into place
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
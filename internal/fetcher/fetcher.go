@@ -2,14 +2,22 @@ package fetcher
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"math/rand"
 	"net/http"
 	"net/url"
 	"regexp"
 	"strings"
 	"time"
+	"unicode/utf8"
+
+	"github.com/pigeonsec/magpie/internal/netutil"
+	"golang.org/x/net/idna"
 )
 
 const (
@@ -18,8 +26,11 @@ const (
 	maxLabelLength  = 63  // RFC 1035
 	minDomainLength = 3   // e.g., "a.b"
 
-	// Scanner buffer size for large files
+	// Longest line accepted from a blocklist; longer lines are skipped
 	maxScannerBuffer = 1024 * 1024 // 1MB
+
+	// DefaultUserAgent is sent with every request unless UserAgent is changed
+	DefaultUserAgent = "Magpie/1.0"
 )
 
 // Domain validation regex - matches valid domain names
@@ -29,6 +40,21 @@ var domainRegex = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9\-]{0,61}[a-zA-Z0-
 type Fetcher struct {
 	client        *http.Client
 	retryAttempts int
+
+	// Cache, when set, makes fetches conditional on the last ETag / Last-Modified
+	Cache *FetchCache
+
+	// MaxSize caps the body of each download in bytes (0 = unlimited)
+	MaxSize int64
+
+	// UserAgent replaces DefaultUserAgent when set
+	UserAgent string
+
+	// Header is added to every request and overrides the defaults (User-Agent, Accept, ...)
+	Header http.Header
+
+	// Limiter, when set, bounds the concurrent requests and request rate per hostname
+	Limiter *HostLimiter
 }
 
 // NewFetcher creates a new fetcher with optimized connection pooling
@@ -49,6 +75,7 @@ func NewFetcher(timeout time.Duration, retryAttempts int) *Fetcher {
 		TLSHandshakeTimeout:   10 * time.Second,
 		ExpectContinueTimeout: 1 * time.Second,
 		ResponseHeaderTimeout: 15 * time.Second,   // Wait for headers
+		Proxy:                 netutil.ProxyFromEnvironment, // HTTP(S)_PROXY / ALL_PROXY
 		DisableCompression:    false,              // Enable compression for large files
 		DisableKeepAlives:     false,              // Reuse connections
 		ForceAttemptHTTP2:     true,               // HTTP/2 for better performance
@@ -69,25 +96,90 @@ func NewFetcher(timeout time.Duration, retryAttempts int) *Fetcher {
 			},
 		},
 		retryAttempts: retryAttempts,
+		MaxSize:       DefaultMaxSize,
+		UserAgent:     DefaultUserAgent,
 	}
 }
 
-// Fetch downloads and parses domains from a URL with exponential backoff
+// SetProxy replaces the proxy taken from the environment. Call before fetching.
+func (f *Fetcher) SetProxy(proxy netutil.ProxyFunc) {
+	f.client.Transport.(*http.Transport).Proxy = proxy
+}
+
+// Fetch downloads and parses domains from a URL with exponential backoff.
+// Local files (file:// or a plain path) are read directly, without retries.
 func (f *Fetcher) Fetch(ctx context.Context, url string) ([]string, error) {
+	if IsLocalSource(url) {
+		return f.fetchFile(ctx, url)
+	}
+
+	var domains []string
+	err := f.withRetry(ctx, func() error {
+		var attemptErr error
+		domains, attemptErr = f.fetchAttempt(ctx, url)
+		return attemptErr
+	})
+	return domains, err
+}
+
+// Download fetches the raw body of a URL with exponential backoff, leaving parsing to the
+// caller (see ParseBody). This lets network-bound and CPU-bound work run on separate workers.
+func (f *Fetcher) Download(ctx context.Context, url string) ([]byte, error) {
+	if IsLocalSource(url) {
+		return readFile(url)
+	}
+
+	var body []byte
+	err := f.withRetry(ctx, func() error {
+		resp, attemptErr := f.openAttempt(ctx, url)
+		if errors.Is(attemptErr, errNotModified) {
+			body, attemptErr = f.Cache.body(url)
+			return attemptErr
+		}
+		if attemptErr != nil {
+			return attemptErr
+		}
+		defer resp.Body.Close()
+
+		body, attemptErr = io.ReadAll(resp.Body)
+		if attemptErr != nil {
+			return fmt.Errorf("error reading response: %w", attemptErr)
+		}
+		if f.Cache != nil {
+			if err := f.Cache.store(url, resp.Header, body); err != nil {
+				log.Printf("Warning: failed to cache %s: %v", url, err)
+			}
+		}
+		return nil
+	})
+	return body, err
+}
+
+// withRetry runs attempt until it succeeds or retries are exhausted. HTTP statuses that
+// can't improve (404, 403, ...) fail at once; a Retry-After on 429 / 503 extends the backoff.
+func (f *Fetcher) withRetry(ctx context.Context, attempt func() error) error {
 	var lastErr error
 
-	for attempt := 1; attempt <= f.retryAttempts; attempt++ {
-		domains, err := f.fetchAttempt(ctx, url)
+	for n := 1; n <= f.retryAttempts; n++ {
+		err := attempt()
 		if err == nil {
-			return domains, nil
+			return nil
 		}
 
 		lastErr = err
+		var status *StatusError
+		if errors.As(err, &status) && !status.Retryable() {
+			return err
+		}
+		// The next attempt would download the same oversized body
+		if errors.Is(err, ErrTooLarge) {
+			return err
+		}
 
 		// Don't sleep on last attempt
-		if attempt < f.retryAttempts {
+		if n < f.retryAttempts {
 			// Exponential backoff: 1s, 2s, 4s, 8s, etc.
-			backoff := time.Duration(1<<uint(attempt-1)) * time.Second
+			backoff := time.Duration(1<<uint(n-1)) * time.Second
 
 			// Add jitter (0-50% of backoff time)
 			jitter := time.Duration(rand.Int63n(int64(backoff / 2)))
@@ -98,50 +190,167 @@ func (f *Fetcher) Fetch(ctx context.Context, url string) ([]string, error) {
 				sleepTime = 30 * time.Second
 			}
 
+			// The server said when to come back
+			if status != nil && status.RetryAfter > sleepTime {
+				sleepTime = status.RetryAfter
+			}
+
 			select {
 			case <-ctx.Done():
-				return nil, ctx.Err()
+				return ctx.Err()
 			case <-time.After(sleepTime):
 				// Continue to next attempt
 			}
 		}
 	}
 
-	return nil, fmt.Errorf("failed after %d attempts: %w", f.retryAttempts, lastErr)
+	return fmt.Errorf("failed after %d attempts: %w", f.retryAttempts, lastErr)
 }
 
 func (f *Fetcher) fetchAttempt(ctx context.Context, url string) ([]string, error) {
+	if IsAXFRSource(url) {
+		return f.fetchAXFR(ctx, url)
+	}
+
+	resp, err := f.openAttempt(ctx, url)
+	if errors.Is(err, errNotModified) {
+		body, err := f.Cache.body(url)
+		if err != nil {
+			return nil, err
+		}
+		return f.ParseBody(ctx, bytes.NewReader(body))
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	domains, err := f.ParseBody(ctx, resp.Body)
+	if err == nil && f.Cache != nil {
+		if err := f.Cache.store(url, resp.Header, domainsBody(domains)); err != nil {
+			log.Printf("Warning: failed to cache %s: %v", url, err)
+		}
+	}
+	return domains, err
+}
+
+// openAttempt issues the GET request and returns the response once the status is OK
+func (f *Fetcher) openAttempt(ctx context.Context, url string) (*http.Response, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("User-Agent", "Magpie/1.0")
+	userAgent := f.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
 	req.Header.Set("Accept", "text/plain, */*")
 	// Note: Don't manually set Accept-Encoding - let Go's HTTP client handle it automatically
 	// The transport's DisableCompression: false already enables compression
+	// (an Accept-Encoding from Header turns that off and the body is read as sent)
+	for key, values := range f.Header {
+		req.Header[key] = values
+	}
+	if f.Cache != nil {
+		f.Cache.setConditionalHeaders(req, url)
+	}
+
+	release := func() {}
+	if f.Limiter != nil {
+		if release, err = f.Limiter.Acquire(ctx, req.URL.Hostname()); err != nil {
+			return nil, err
+		}
+	}
 
 	resp, err := f.client.Do(req)
 	if err != nil {
+		release()
 		return nil, fmt.Errorf("failed to fetch URL: %w", err)
 	}
-	defer resp.Body.Close()
+	// The slot is held until the caller has read and closed the body
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+
+	if resp.StatusCode == http.StatusNotModified && f.Cache != nil {
+		resp.Body.Close()
+		return nil, errNotModified
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, newStatusError(resp)
+	}
+
+	if f.MaxSize > 0 && resp.ContentLength > f.MaxSize {
+		resp.Body.Close()
+		return nil, tooLarge(f.MaxSize)
+	}
+	resp.Body = limitBody(resp.Body, f.MaxSize)
+
+	return resp, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+// ParsedList is a blocklist body split by rule type
+type ParsedList struct {
+	Domains    []string // blocked domains, with the list's own exceptions already removed; leading-dot entries keep the dot (see SplitSubdomains)
+	Exceptions []string // domains unblocked by @@ rules
+	Ignored    int      // cosmetic, regex and other rules that don't map to a domain
+}
+
+// ParseBody extracts unique, valid domains from a blocklist body. Gzip-compressed bodies
+// are detected and decompressed on the fly. A domain listed as a leading-dot entry is
+// returned as ".example.com", so the intent to block its subdomains survives; use
+// SplitSubdomains to take the dot off.
+// Lines longer than maxScannerBuffer are skipped with a warning instead of failing the source.
+func ParseBody(ctx context.Context, body io.Reader) ([]string, error) {
+	list, err := ParseBodyRules(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+	return list.Domains, nil
+}
+
+// ParseBody is the package's ParseBody for a downloaded body: a gzip body fails with
+// ErrTooLarge once it decompresses to more than MaxSize bytes
+func (f *Fetcher) ParseBody(ctx context.Context, body io.Reader) ([]string, error) {
+	list, err := parseBodyRules(ctx, body, f.MaxSize)
+	if err != nil {
+		return nil, err
 	}
+	return list.Domains, nil
+}
+
+// ParseBodyRules is ParseBody that also returns the list's @@ exceptions and how many
+// rules were ignored. Exceptions are subtracted from the list's own domains.
+func ParseBodyRules(ctx context.Context, body io.Reader) (*ParsedList, error) {
+	return parseBodyRules(ctx, body, 0)
+}
 
+// parseBodyRules is ParseBodyRules with the decompressed size of a gzip body capped at
+// max bytes (max <= 0 means unlimited)
+func parseBodyRules(ctx context.Context, body io.Reader, max int64) (*ParsedList, error) {
 	// Use map for deduplication during parsing
 	// Pre-allocate for typical blocklist sizes (10k-100k domains)
+	// The value is whether the domain was listed as a leading-dot entry
 	domainMap := make(map[string]bool, 50000)
-	scanner := bufio.NewScanner(resp.Body)
-
-	// Increase buffer size for large lines
-	buf := make([]byte, maxScannerBuffer)
-	scanner.Buffer(buf, maxScannerBuffer)
+	exceptionMap := make(map[string]struct{})
+	ignored := 0
+	reader, err := gunzipIfCompressed(bufio.NewReaderSize(body, 64*1024), max)
+	if err != nil {
+		return nil, err
+	}
 
 	lineNum := 0
-	for scanner.Scan() {
+	skipped := 0
+	for {
+		raw, tooLong, err := readLine(reader, maxScannerBuffer)
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("error reading response (line %d): %w", lineNum+1, err)
+		}
+		if err == io.EOF && len(raw) == 0 && !tooLong {
+			break
+		}
 		lineNum++
 
 		// Check context cancellation periodically
@@ -153,35 +362,153 @@ func (f *Fetcher) fetchAttempt(ctx context.Context, url string) ([]string, error
 			}
 		}
 
-		line := strings.TrimSpace(scanner.Text())
+		if tooLong {
+			skipped++
+		} else {
+			line := strings.TrimSpace(string(raw))
+
+			// Skip empty lines and comments
+			if line != "" && !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "!") && !strings.HasPrefix(line, ";") {
+				// Parse domain from line
+				rule, ok := parseRule(line)
+				switch {
+				case !ok:
+					// Not a rule at all, just not a valid domain
+				case rule.Type == RuleBlock:
+					// The domain is usually a substring of the line; the aggregated set keeps it
+					// for the whole run, so copy it rather than hold on to the entire line.
+					// A leading-dot entry widens a plain one for the same domain.
+					if subdomains, seen := domainMap[rule.Domain]; !seen || (rule.Subdomains && !subdomains) {
+						domainMap[strings.Clone(rule.Domain)] = subdomains || rule.Subdomains
+					}
+				case rule.Type == RuleAllow:
+					exceptionMap[rule.Domain] = struct{}{}
+				default:
+					ignored++
+				}
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	if skipped > 0 {
+		log.Printf("Warning: skipped %d lines longer than %d bytes", skipped, maxScannerBuffer)
+	}
 
-		// Skip empty lines and comments
-		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") || strings.HasPrefix(line, ";") {
+	// Convert maps to slices
+	list := &ParsedList{
+		Domains:    make([]string, 0, len(domainMap)),
+		Exceptions: make([]string, 0, len(exceptionMap)),
+		Ignored:    ignored,
+	}
+	for domain, subdomains := range domainMap {
+		if _, ok := exceptionMap[domain]; ok {
 			continue
 		}
+		if subdomains {
+			domain = "." + domain
+		}
+		list.Domains = append(list.Domains, domain)
+	}
+	for domain := range exceptionMap {
+		list.Exceptions = append(list.Exceptions, domain)
+	}
 
-		// Parse domain from line
-		domain := ParseDomain(line)
-		if domain != "" && IsValidDomain(domain) {
-			domainMap[domain] = true
+	return list, nil
+}
+
+// SplitSubdomains takes the leading dot off a domain returned by ParseBody, reporting
+// whether it was there: the entry blocks the domain and all its subdomains
+func SplitSubdomains(domain string) (string, bool) {
+	if rest, ok := strings.CutPrefix(domain, "."); ok {
+		return rest, true
+	}
+	return domain, false
+}
+
+// readLine reads one line of at most max bytes. Longer lines are consumed in full and
+// reported with tooLong, so a single pathological line doesn't abort the whole body.
+// The returned slice is only valid until the next read.
+func readLine(r *bufio.Reader, max int) ([]byte, bool, error) {
+	chunk, err := r.ReadSlice('\n')
+	if err != bufio.ErrBufferFull {
+		// Common case: the whole line fit in the reader's buffer
+		return chunk, false, err
+	}
+
+	line := append([]byte(nil), chunk...)
+	tooLong := false
+	for err == bufio.ErrBufferFull {
+		chunk, err = r.ReadSlice('\n')
+		if tooLong {
+			continue
+		}
+		if len(line)+len(chunk) > max {
+			tooLong = true
+			line = nil
+			continue
 		}
+		line = append(line, chunk...)
 	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("error reading response (line %d): %w", lineNum, err)
+	return line, tooLong, err
+}
+
+// ParseDomain classifies a blocklist line and extracts its domain from various blocklist
+// formats. The domain is cleaned but not validated.
+func ParseDomain(line string) Rule {
+	raw, ruleType := extractDomain(line)
+	return Rule{Domain: cleanDomain(raw), Type: ruleType, Subdomains: leadingDot(raw, ruleType)}
+}
+
+// ParseLine extracts the blocked domain from a blocklist line and normalizes it, reporting
+// whether it is valid. Exceptions, cosmetic and regex rules are never valid.
+func ParseLine(line string) (string, bool) {
+	raw, ruleType := extractDomain(line)
+	if ruleType != RuleBlock {
+		return "", false
 	}
+	return NormalizeDomain(raw)
+}
 
-	// Convert map to slice
-	domains := make([]string, 0, len(domainMap))
-	for domain := range domainMap {
-		domains = append(domains, domain)
+// parseRule is ParseDomain with the domain validated. It reports false for lines that
+// would be a block rule but hold no valid domain; exceptions with an invalid domain
+// become RuleUnsupported.
+func parseRule(line string) (Rule, bool) {
+	raw, ruleType := extractDomain(line)
+	if ruleType != RuleBlock && ruleType != RuleAllow {
+		return Rule{Type: ruleType}, true
+	}
+	domain, ok := NormalizeDomain(raw)
+	if !ok {
+		if ruleType == RuleAllow {
+			return Rule{Type: RuleUnsupported}, true
+		}
+		return Rule{}, false
 	}
+	return Rule{Domain: domain, Type: ruleType, Subdomains: leadingDot(raw, ruleType)}, true
+}
 
-	return domains, nil
+// leadingDot reports a leading-dot block entry (".example.com"). cleanDomain drops the
+// dot like a "*." prefix, so it has to be checked on the raw token.
+func leadingDot(raw string, ruleType RuleType) bool {
+	return ruleType == RuleBlock && strings.HasPrefix(strings.TrimSpace(raw), ".")
 }
 
-// ParseDomain extracts domain from various blocklist formats
-func ParseDomain(line string) string {
+// extractDomain returns the raw domain token of a blocklist line, before cleaning,
+// and what kind of rule the line is
+func extractDomain(line string) (string, RuleType) {
+	// Cosmetic and regex rules may contain '#' or ';', so detect them before comments are cut
+	if isCosmeticRule(line) {
+		return "", RuleCosmetic
+	}
+	if isRegexRule(strings.TrimSpace(line)) {
+		return "", RuleRegex
+	}
+
 	// Remove inline comments
 	if idx := strings.Index(line, "#"); idx != -1 {
 		line = line[:idx]
@@ -192,28 +519,32 @@ func ParseDomain(line string) string {
 
 	line = strings.TrimSpace(line)
 	if line == "" {
-		return ""
+		return "", RuleBlock
 	}
 
 	// Handle AdBlock/uBlock format: ||domain.com^ or ||domain.com^$third-party
 	if strings.HasPrefix(line, "||") {
-		line = strings.TrimPrefix(line, "||")
-		if idx := strings.Index(line, "^"); idx != -1 {
-			line = line[:idx]
+		host, ok := adblockHost(line)
+		if !ok {
+			return "", RuleUnsupported
 		}
-		return cleanDomain(line)
+		return host, RuleBlock
 	}
 
 	// Handle AdBlock exceptions: @@||domain.com^
-	if strings.HasPrefix(line, "@@||") {
-		return "" // Skip exceptions
+	if strings.HasPrefix(line, "@@") {
+		host, ok := adblockHost(strings.TrimPrefix(line, "@@"))
+		if !ok || !strings.HasPrefix(line, "@@||") {
+			return "", RuleUnsupported
+		}
+		return host, RuleAllow
 	}
 
 	// Handle IPv4 hosts file format: "0.0.0.0 domain.com" or "127.0.0.1 domain.com"
 	if strings.HasPrefix(line, "0.0.0.0 ") || strings.HasPrefix(line, "127.0.0.1 ") {
 		parts := strings.Fields(line)
 		if len(parts) >= 2 {
-			return cleanDomain(parts[1])
+			return parts[1], RuleBlock
 		}
 	}
 
@@ -221,7 +552,7 @@ func ParseDomain(line string) string {
 	if strings.HasPrefix(line, "::") || strings.HasPrefix(line, "::1") {
 		parts := strings.Fields(line)
 		if len(parts) >= 2 {
-			return cleanDomain(parts[1])
+			return parts[1], RuleBlock
 		}
 	}
 
@@ -232,11 +563,11 @@ func ParseDomain(line string) string {
 			firstPart := parts[0]
 			// Check if first part looks like an IPv4 address
 			if strings.Count(firstPart, ".") == 3 {
-				return cleanDomain(parts[1])
+				return parts[1], RuleBlock
 			}
 			// Check if first part looks like an IPv6 address
 			if strings.Contains(firstPart, ":") {
-				return cleanDomain(parts[1])
+				return parts[1], RuleBlock
 			}
 		}
 	}
@@ -249,12 +580,23 @@ func ParseDomain(line string) string {
 			if idx := strings.Index(host, ":"); idx != -1 {
 				host = host[:idx]
 			}
-			return cleanDomain(host)
+			return host, RuleBlock
 		}
 	}
 
 	// Plain domain format
-	return cleanDomain(line)
+	return line, RuleBlock
+}
+
+// NormalizeDomain cleans a raw domain (case, scheme, www., port, path, wildcard and
+// trailing dot) and validates the result. It is the canonicalization used for every
+// domain magpie outputs.
+func NormalizeDomain(raw string) (string, bool) {
+	domain := cleanDomain(raw)
+	if domain == "" || !IsValidDomain(domain) {
+		return "", false
+	}
+	return domain, true
 }
 
 // cleanDomain cleans and normalizes a domain string
@@ -294,6 +636,24 @@ func cleanDomain(domain string) string {
 		return ""
 	}
 
+	return toASCII(domain)
+}
+
+// idnaProfile maps Unicode domains the way resolvers look them up (IDNA2008 with UTS #46 mapping)
+var idnaProfile = idna.New(idna.MapForLookup(), idna.BidiRule(), idna.Transitional(false))
+
+// toASCII converts internationalized labels to their xn-- form. ASCII input, including
+// domains that are already punycoded, passes through unchanged; invalid IDNs become "".
+func toASCII(domain string) string {
+	for i := 0; i < len(domain); i++ {
+		if domain[i] >= utf8.RuneSelf {
+			ascii, err := idnaProfile.ToASCII(domain)
+			if err != nil {
+				return ""
+			}
+			return ascii
+		}
+	}
 	return domain
 }
 
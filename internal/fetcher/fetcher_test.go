@@ -0,0 +1,81 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseBodyRulesSkipsOversizedLines(t *testing.T) {
+	long := "0.0.0.0 " + strings.Repeat("a", maxScannerBuffer) + ".example.com"
+
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{
+			name: "between valid lines",
+			body: "0.0.0.0 before.example.com\n" + long + "\n0.0.0.0 after.example.com\n",
+			want: []string{"after.example.com", "before.example.com"},
+		},
+		{
+			name: "first line",
+			body: long + "\n0.0.0.0 after.example.com\n",
+			want: []string{"after.example.com"},
+		},
+		{
+			name: "last line without newline",
+			body: "0.0.0.0 before.example.com\n" + long,
+			want: []string{"before.example.com"},
+		},
+		{
+			name: "several in a row",
+			body: "0.0.0.0 before.example.com\n" + long + "\n" + long + "\n0.0.0.0 after.example.com\n",
+			want: []string{"after.example.com", "before.example.com"},
+		},
+		{
+			name: "just under the limit",
+			body: "0.0.0.0 before.example.com\n# " + strings.Repeat("x", maxScannerBuffer-3) + "\n0.0.0.0 after.example.com\n",
+			want: []string{"after.example.com", "before.example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := ParseBodyRules(context.Background(), strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("ParseBodyRules: %v", err)
+			}
+			got := slices.Sorted(slices.Values(list.Domains))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("domains = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// BenchmarkParseBodyRules parses a 2M-domain hosts file
+func BenchmarkParseBodyRules(b *testing.B) {
+	const domains = 2_000_000
+	var sb strings.Builder
+	sb.WriteString("# benchmark list\n")
+	for i := 0; i < domains; i++ {
+		fmt.Fprintf(&sb, "0.0.0.0 host%d.zone%d.example.com\n", i, i%1000)
+	}
+	body := sb.String()
+
+	b.SetBytes(int64(len(body)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		list, err := ParseBodyRules(context.Background(), strings.NewReader(body))
+		if err != nil {
+			b.Fatalf("ParseBodyRules: %v", err)
+		}
+		if len(list.Domains) != domains {
+			b.Fatalf("got %d domains, want %d", len(list.Domains), domains)
+		}
+	}
+}
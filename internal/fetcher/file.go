@@ -0,0 +1,63 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// FileScheme marks a source read from the local filesystem
+const FileScheme = "file://"
+
+// IsLocalSource reports whether a source is a local file: a file:// URL or a bare
+// absolute or relative path (anything without a scheme)
+func IsLocalSource(source string) bool {
+	return strings.HasPrefix(strings.ToLower(source), FileScheme) || !strings.Contains(source, "://")
+}
+
+// localPath returns the filesystem path of a local source. Relative paths are
+// relative to the working directory.
+func localPath(source string) (string, error) {
+	if !strings.HasPrefix(strings.ToLower(source), FileScheme) {
+		return source, nil
+	}
+	parsed, err := url.Parse(source)
+	if err != nil {
+		return "", fmt.Errorf("invalid file URL: %w", err)
+	}
+	if parsed.Host != "" && parsed.Host != "localhost" {
+		return "", fmt.Errorf("invalid file URL: remote host %q", parsed.Host)
+	}
+	return parsed.Path, nil
+}
+
+// fetchFile parses a local blocklist with the same pipeline as a downloaded one
+func (f *Fetcher) fetchFile(ctx context.Context, source string) ([]string, error) {
+	path, err := localPath(source)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	return ParseBody(ctx, file)
+}
+
+// readFile returns the raw content of a local source
+func readFile(source string) ([]byte, error) {
+	path, err := localPath(source)
+	if err != nil {
+		return nil, err
+	}
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	return body, nil
+}
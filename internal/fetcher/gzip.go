@@ -0,0 +1,34 @@
+package fetcher
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// gzipMagic starts every gzip stream (RFC 1952)
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// gunzipIfCompressed sniffs the first bytes of a body and transparently decompresses it
+// if it's gzip data. Many hosts serve .txt.gz files without a Content-Encoding header, so
+// the HTTP transport hands them over still compressed; a .gz URL whose body the
+// transport already decoded (or that isn't compressed at all) is read as-is.
+// Decompression streams, so the file is never held in memory whole, and stops with
+// ErrTooLarge past max decompressed bytes (max <= 0 means unlimited): a body within
+// MaxSize can still expand a thousandfold.
+func gunzipIfCompressed(reader *bufio.Reader, max int64) (*bufio.Reader, error) {
+	magic, err := reader.Peek(len(gzipMagic))
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("error reading response: %w", err)
+	}
+	if len(magic) < len(gzipMagic) || magic[0] != gzipMagic[0] || magic[1] != gzipMagic[1] {
+		return reader, nil
+	}
+
+	zr, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gzip data: %w", err)
+	}
+	return bufio.NewReaderSize(limitBody(zr, max), 64*1024), nil
+}
@@ -0,0 +1,102 @@
+package fetcher
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testHosts = "# test list\n0.0.0.0 ads.example.com\n0.0.0.0 tracker.example.net\n"
+
+// gzipped compresses s
+func gzipped(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseBodyGzip(t *testing.T) {
+	want := []string{"ads.example.com", "tracker.example.net"}
+
+	tests := []struct {
+		name    string
+		body    []byte
+		want    []string
+		wantErr bool
+	}{
+		{name: "gzipped", body: gzipped(t, testHosts), want: want},
+		{name: "plain", body: []byte(testHosts), want: want},
+		{name: "empty", body: nil, want: nil},
+		{name: "truncated after the magic bytes", body: gzipMagic, wantErr: true},
+		{name: "truncated stream", body: gzipped(t, testHosts)[:20], wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			domains, err := ParseBody(context.Background(), bytes.NewReader(tt.body))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseBody = %v, want an error", domains)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseBody: %v", err)
+			}
+			got := slices.Sorted(slices.Values(domains))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("domains = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetcherParseBodyLimitsDecompressedSize(t *testing.T) {
+	// Highly compressible: a few KB of gzip for MBs of list
+	var list strings.Builder
+	for list.Len() < 4*1024*1024 {
+		list.WriteString("0.0.0.0 ads.example.com\n")
+	}
+	body := gzipped(t, list.String())
+
+	f := NewFetcher(time.Second, 1)
+	f.MaxSize = 1024 * 1024
+	if int64(len(body)) > f.MaxSize {
+		t.Fatalf("compressed body of %d bytes is over the limit already", len(body))
+	}
+	if _, err := f.ParseBody(context.Background(), bytes.NewReader(body)); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("ParseBody error = %v, want ErrTooLarge", err)
+	}
+
+	// Served without Content-Encoding, so the transport hands it over compressed
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer server.Close()
+	if _, err := f.Fetch(context.Background(), server.URL+"/list.txt.gz"); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("Fetch error = %v, want ErrTooLarge", err)
+	}
+
+	f.MaxSize = 0
+	domains, err := f.ParseBody(context.Background(), bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("ParseBody without a limit: %v", err)
+	}
+	if len(domains) != 1 {
+		t.Errorf("domains = %v, want [ads.example.com]", domains)
+	}
+}
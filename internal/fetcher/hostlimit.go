@@ -0,0 +1,98 @@
+package fetcher
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HostLimiter bounds the requests sent to each hostname: at most maxInFlight at once,
+// and with a rate, request starts spaced 1/rate seconds apart (a token bucket holding
+// a single token). Retries wait for a slot like any other request.
+type HostLimiter struct {
+	maxInFlight int
+	interval    time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*hostSlot
+}
+
+// hostSlot is the limiter state of one hostname
+type hostSlot struct {
+	inFlight chan struct{} // nil without a concurrency limit
+	next     time.Time     // earliest start of the next request
+}
+
+// NewHostLimiter creates a limiter; maxInFlight <= 0 or perSecond <= 0 disables that part
+func NewHostLimiter(maxInFlight int, perSecond float64) *HostLimiter {
+	l := &HostLimiter{maxInFlight: maxInFlight, hosts: make(map[string]*hostSlot)}
+	if perSecond > 0 {
+		l.interval = time.Duration(float64(time.Second) / perSecond)
+	}
+	return l
+}
+
+// Acquire waits until a request to host may start and returns the function that frees
+// its slot once the response body is done with
+func (l *HostLimiter) Acquire(ctx context.Context, host string) (func(), error) {
+	host = strings.ToLower(host)
+
+	l.mu.Lock()
+	slot, ok := l.hosts[host]
+	if !ok {
+		slot = &hostSlot{}
+		if l.maxInFlight > 0 {
+			slot.inFlight = make(chan struct{}, l.maxInFlight)
+		}
+		l.hosts[host] = slot
+	}
+	l.mu.Unlock()
+
+	release := func() {}
+	if slot.inFlight != nil {
+		select {
+		case slot.inFlight <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		var once sync.Once
+		release = func() { once.Do(func() { <-slot.inFlight }) }
+	}
+
+	if l.interval > 0 {
+		// Reserve the next start time, then wait for it outside the lock
+		l.mu.Lock()
+		start := time.Now()
+		if slot.next.After(start) {
+			start = slot.next
+		}
+		slot.next = start.Add(l.interval)
+		l.mu.Unlock()
+
+		if wait := time.Until(start); wait > 0 {
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				release()
+				return nil, ctx.Err()
+			}
+		}
+	}
+	return release, nil
+}
+
+// releasingBody frees a limiter slot when the response body is closed
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
@@ -0,0 +1,48 @@
+package fetcher
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultMaxSize is the largest body accepted from one source unless MaxSize is changed
+const DefaultMaxSize = 100 * 1024 * 1024
+
+// ErrTooLarge reports a source whose body exceeds the fetcher's MaxSize
+var ErrTooLarge = errors.New("source exceeded max size")
+
+// tooLarge wraps ErrTooLarge with the limit that was hit
+func tooLarge(max int64) error {
+	return fmt.Errorf("%w of %d bytes", ErrTooLarge, max)
+}
+
+// limitedBody fails reads with ErrTooLarge once more than max bytes came through,
+// without ever reading more than one byte past the limit
+type limitedBody struct {
+	r    io.Reader
+	body io.Closer
+	read int64
+	max  int64
+}
+
+// limitBody caps body at max bytes; max <= 0 means unlimited
+func limitBody(body io.ReadCloser, max int64) io.ReadCloser {
+	if max <= 0 {
+		return body
+	}
+	return &limitedBody{r: io.LimitReader(body, max+1), body: body, max: max}
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.max {
+		return n, tooLarge(l.max)
+	}
+	return n, err
+}
+
+func (l *limitedBody) Close() error {
+	return l.body.Close()
+}
@@ -0,0 +1,79 @@
+package fetcher
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRetryAfter caps how long a Retry-After header can make a fetch wait
+const maxRetryAfter = 2 * time.Minute
+
+// StatusError is a non-2xx HTTP response. Callers can tell a source that is gone for
+// good (Permanent) from one that is temporarily down (Retryable).
+type StatusError struct {
+	Code       int
+	RetryAfter time.Duration // from Retry-After on 429 / 503, zero if absent
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.Code, http.StatusText(e.Code))
+}
+
+// Retryable reports whether another attempt may succeed: timeouts, rate limiting and
+// server errors are transient
+func (e *StatusError) Retryable() bool {
+	return e.Code == http.StatusRequestTimeout || e.Code == http.StatusTooManyRequests || e.Code >= 500
+}
+
+// Permanent reports whether the source is dead for good: not found, gone, or access denied
+func (e *StatusError) Permanent() bool {
+	switch e.Code {
+	case http.StatusNotFound, http.StatusGone, http.StatusUnauthorized, http.StatusForbidden:
+		return true
+	}
+	return false
+}
+
+// IsPermanent reports whether err comes from a permanently failing HTTP status
+func IsPermanent(err error) bool {
+	var status *StatusError
+	return errors.As(err, &status) && status.Permanent()
+}
+
+// newStatusError builds the error for a non-2xx response, honouring Retry-After where
+// servers use it to pace clients
+func newStatusError(resp *http.Response) *StatusError {
+	err := &StatusError{Code: resp.StatusCode}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		err.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+	return err
+}
+
+// parseRetryAfter reads a Retry-After value in either delay-seconds or HTTP-date form,
+// capped at maxRetryAfter. Invalid or past values give zero.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	var wait time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(value); err == nil {
+		wait = at.Sub(now)
+	}
+
+	if wait < 0 {
+		return 0
+	}
+	if wait > maxRetryAfter {
+		return maxRetryAfter
+	}
+	return wait
+}
@@ -0,0 +1,87 @@
+package netutil
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Connectivity check methods
+const (
+	// CheckDNS dials the public DNS servers over UDP/53
+	CheckDNS = "dns"
+	// CheckHTTP GETs ProbeURL and expects 200 or 204
+	CheckHTTP = "http"
+	// CheckNone skips the check
+	CheckNone = "none"
+)
+
+// DefaultProbeURL answers 204 No Content, the same page phones use to detect captive portals
+const DefaultProbeURL = "http://connectivitycheck.gstatic.com/generate_204"
+
+// probeTimeout bounds one HTTP probe
+const probeTimeout = 5 * time.Second
+
+// CheckMethods lists the accepted connectivity check methods
+var CheckMethods = []string{CheckDNS, CheckHTTP, CheckNone}
+
+// The configured check; the DNS probe unless SetConnectivityCheck says otherwise
+var (
+	checkMethod = CheckDNS
+	probeURL    = DefaultProbeURL
+	probeClient = newProbeClient(ProxyFromEnvironment)
+)
+
+// SetConnectivityCheck selects how CheckInternetConnection probes: method is one of
+// CheckMethods, url the page for CheckHTTP ("" for DefaultProbeURL) and proxy the proxy
+// for it (nil for the environment). Call it before the first check.
+func SetConnectivityCheck(method, url string, proxy ProxyFunc) error {
+	switch method {
+	case CheckDNS, CheckHTTP, CheckNone:
+	default:
+		return fmt.Errorf("unknown connectivity check %q (use dns, http or none)", method)
+	}
+	if url == "" {
+		url = DefaultProbeURL
+	}
+	if proxy == nil {
+		proxy = ProxyFromEnvironment
+	}
+	checkMethod = method
+	probeURL = url
+	probeClient = newProbeClient(proxy)
+	return nil
+}
+
+// newProbeClient returns the short-timeout client for HTTP probes
+func newProbeClient(proxy ProxyFunc) *http.Client {
+	return &http.Client{
+		Timeout: probeTimeout,
+		Transport: &http.Transport{
+			Proxy:             proxy,
+			DisableKeepAlives: true,
+		},
+	}
+}
+
+// probeHTTP reports whether ProbeURL answers 200 or 204
+func probeHTTP(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probeURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := probeClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("no internet connection detected (HTTP probe failed: %w)", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		// A captive portal typically answers with a redirect or its login page
+		return fmt.Errorf("no internet connection detected (HTTP probe %s answered %s)", probeURL, resp.Status)
+	}
+	return nil
+}
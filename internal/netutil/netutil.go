@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"strings"
 	"time"
 )
 
@@ -15,28 +16,104 @@ const (
 	RetryDelay = 5 * time.Second
 )
 
-// CheckInternetConnection verifies internet connectivity by checking DNS resolution
-func CheckInternetConnection(ctx context.Context) error {
-	// Test multiple DNS servers to ensure we're not blocked by one
-	testHosts := []string{
+// IPv4 and IPv6 DNS servers used to probe connectivity
+var (
+	ipv4TestHosts = []string{
 		"1.1.1.1:53",     // Cloudflare
 		"8.8.8.8:53",     // Google
 		"9.9.9.9:53",     // Quad9
 	}
+	ipv6TestHosts = []string{
+		"[2606:4700:4700::1111]:53", // Cloudflare
+		"[2001:4860:4860::8888]:53", // Google
+		"[2620:fe::fe]:53",          // Quad9
+	}
+
+	// customTestHosts replaces both lists when set by SetProbeHosts
+	customTestHosts []string
+)
+
+// SetProbeHosts replaces the public DNS servers probed by the dns check with hosts
+// (host or host:port, port 53 by default); the check passes if any one can be dialed.
+// An empty list restores the defaults.
+func SetProbeHosts(hosts []string) error {
+	var probes []string
+	for _, host := range hosts {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		probe := host
+		if _, _, err := net.SplitHostPort(probe); err != nil {
+			// No port: a bare IPv6 address may still carry brackets
+			probe = net.JoinHostPort(strings.Trim(probe, "[]"), "53")
+		}
+		if _, port, err := net.SplitHostPort(probe); err != nil || port == "" {
+			return fmt.Errorf("invalid probe host %q", host)
+		}
+		probes = append(probes, probe)
+	}
+	customTestHosts = probes
+	return nil
+}
 
-	for _, host := range testHosts {
-		conn, err := net.DialTimeout("udp", host, 3*time.Second)
+// CheckInternetConnection verifies internet connectivity over either IPv4 or IPv6
+func CheckInternetConnection(ctx context.Context) error {
+	_, err := CheckInternetConnectionStack(ctx)
+	return err
+}
+
+// CheckInternetConnectionStack verifies connectivity with the configured check and
+// reports how it succeeded: the stack for DNS ("IPv4" or "IPv6", or the probe host that
+// answered when SetProbeHosts is in use), "HTTP", or "skipped"
+func CheckInternetConnectionStack(ctx context.Context) (string, error) {
+	switch checkMethod {
+	case CheckNone:
+		return "skipped", nil
+	case CheckHTTP:
+		if err := probeHTTP(ctx); err != nil {
+			return "", err
+		}
+		return "HTTP", nil
+	}
+
+	if len(customTestHosts) > 0 {
+		for _, host := range customTestHosts {
+			if probeHosts("udp", []string{host}) {
+				return host, nil
+			}
+		}
+		return "", fmt.Errorf("no internet connection detected (probes to %s failed)", strings.Join(customTestHosts, ", "))
+	}
+
+	// Test multiple DNS servers to ensure we're not blocked by one
+	if probeHosts("udp4", ipv4TestHosts) {
+		return "IPv4", nil
+	}
+
+	// IPv6-only hosts can still fetch fine over HTTP
+	if probeHosts("udp6", ipv6TestHosts) {
+		return "IPv6", nil
+	}
+
+	return "", fmt.Errorf("no internet connection detected (IPv4 and IPv6 probes failed)")
+}
+
+// probeHosts returns true if any host can be dialed on the given network
+func probeHosts(network string, hosts []string) bool {
+	for _, host := range hosts {
+		conn, err := net.DialTimeout(network, host, 3*time.Second)
 		if err == nil {
 			conn.Close()
-			return nil
+			return true
 		}
 	}
-
-	return fmt.Errorf("no internet connection detected")
+	return false
 }
 
-// WaitForConnection waits for internet connection to be restored
-func WaitForConnection(ctx context.Context, quiet bool) error {
+// WaitForConnection waits for internet connection to be restored and returns how the
+// check that passed succeeded, as CheckInternetConnectionStack does
+func WaitForConnection(ctx context.Context, quiet bool) (string, error) {
 	if !quiet {
 		log.Printf("⚠️  Internet connection lost. Waiting for connection to be restored...")
 	}
@@ -46,11 +123,11 @@ func WaitForConnection(ctx context.Context, quiet bool) error {
 			log.Printf("Checking connection... (attempt %d/%d)", attempt, MaxRetries)
 		}
 
-		if err := CheckInternetConnection(ctx); err == nil {
+		if stack, err := CheckInternetConnectionStack(ctx); err == nil {
 			if !quiet {
 				log.Printf("✓ Internet connection restored!")
 			}
-			return nil
+			return stack, nil
 		}
 
 		if attempt < MaxRetries {
@@ -59,20 +136,22 @@ func WaitForConnection(ctx context.Context, quiet bool) error {
 			}
 			select {
 			case <-ctx.Done():
-				return ctx.Err()
+				return "", ctx.Err()
 			case <-time.After(RetryDelay):
 				// Continue to next attempt
 			}
 		}
 	}
 
-	return fmt.Errorf("failed to restore internet connection after %d attempts", MaxRetries)
+	return "", fmt.Errorf("failed to restore internet connection after %d attempts", MaxRetries)
 }
 
-// CheckConnectionWithRetry checks connection and waits if it fails
-func CheckConnectionWithRetry(ctx context.Context, quiet bool) error {
-	if err := CheckInternetConnection(ctx); err != nil {
+// CheckConnectionWithRetry checks connection and waits if it fails. It returns how the
+// check that passed succeeded, as CheckInternetConnectionStack does.
+func CheckConnectionWithRetry(ctx context.Context, quiet bool) (string, error) {
+	stack, err := CheckInternetConnectionStack(ctx)
+	if err != nil {
 		return WaitForConnection(ctx, quiet)
 	}
-	return nil
+	return stack, nil
 }
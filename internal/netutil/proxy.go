@@ -0,0 +1,52 @@
+package netutil
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// ProxyFunc picks the proxy for a request, as used by http.Transport.Proxy
+type ProxyFunc func(*http.Request) (*url.URL, error)
+
+// ProxyFromEnvironment is http.ProxyFromEnvironment with ALL_PROXY as the fallback
+// for schemes that have no HTTP_PROXY / HTTPS_PROXY of their own. NO_PROXY still applies.
+func ProxyFromEnvironment(req *http.Request) (*url.URL, error) {
+	return envProxy(req.URL)
+}
+
+var envProxy = func() func(*url.URL) (*url.URL, error) {
+	cfg := httpproxy.FromEnvironment()
+	all := os.Getenv("ALL_PROXY")
+	if all == "" {
+		all = os.Getenv("all_proxy")
+	}
+	if cfg.HTTPProxy == "" {
+		cfg.HTTPProxy = all
+	}
+	if cfg.HTTPSProxy == "" {
+		cfg.HTTPSProxy = all
+	}
+	return cfg.ProxyFunc()
+}()
+
+// ParseProxy returns a ProxyFunc that sends every request through proxy,
+// ignoring the environment. Accepts http, https, socks5 and socks5h URLs.
+func ParseProxy(proxy string) (ProxyFunc, error) {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q (use http, https, socks5 or socks5h)", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy %q has no host", proxy)
+	}
+	return http.ProxyURL(u), nil
+}
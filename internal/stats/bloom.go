@@ -0,0 +1,175 @@
+package stats
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"os"
+)
+
+// MasterFilterFile stores the bloom filter built from the -master list
+const MasterFilterFile = "master.bloom"
+
+// BloomFalsePositiveRate is the false-positive rate a filter reaches once it holds its capacity
+const BloomFalsePositiveRate = 0.001
+
+// bloomMagic starts every filter file, including the format version
+const bloomMagic = "MAGPIEBF1"
+
+// BloomSource identifies the file a filter was built from, so a stale filter can be detected
+type BloomSource struct {
+	Size     int64 // bytes
+	ModTime  int64 // unix nanoseconds
+	Capacity int   // domains the filter was sized for
+}
+
+// BloomFilter is a fixed-size set of domains. Test never misses a domain that was added,
+// but may report one that wasn't: around BloomFalsePositiveRate at full capacity, more
+// beyond it.
+type BloomFilter struct {
+	bits    []uint64
+	k       uint32
+	Entries int
+	Source  BloomSource
+}
+
+// NewBloomFilter creates an empty filter sized for capacity domains
+func NewBloomFilter(capacity int) *BloomFilter {
+	if capacity < 1 {
+		capacity = 1
+	}
+	// Optimal size and hash count for the target rate: m = -n ln p / ln²2, k = m/n ln 2
+	m := math.Ceil(-float64(capacity) * math.Log(BloomFalsePositiveRate) / (math.Ln2 * math.Ln2))
+	k := uint32(math.Round(m / float64(capacity) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &BloomFilter{
+		bits:   make([]uint64, (uint64(m)+63)/64),
+		k:      k,
+		Source: BloomSource{Capacity: capacity},
+	}
+}
+
+// bloomHashes returns the two base hashes combined into the k probe positions (double hashing)
+func bloomHashes(domain string) (uint64, uint64) {
+	a := fnv.New64a()
+	a.Write([]byte(domain))
+	b := fnv.New64()
+	b.Write([]byte(domain))
+	// An odd step visits distinct bits for every probe
+	return a.Sum64(), b.Sum64() | 1
+}
+
+// Add inserts a domain
+func (b *BloomFilter) Add(domain string) {
+	h1, h2 := bloomHashes(domain)
+	m := uint64(len(b.bits)) * 64
+	for i := uint64(0); i < uint64(b.k); i++ {
+		pos := (h1 + i*h2) % m
+		b.bits[pos/64] |= 1 << (pos % 64)
+	}
+	b.Entries++
+}
+
+// Test reports whether the domain may have been added
+func (b *BloomFilter) Test(domain string) bool {
+	h1, h2 := bloomHashes(domain)
+	m := uint64(len(b.bits)) * 64
+	for i := uint64(0); i < uint64(b.k); i++ {
+		pos := (h1 + i*h2) % m
+		if b.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bloomHeader is the fixed-size part of the filter file that follows bloomMagic
+type bloomHeader struct {
+	K        uint32
+	Capacity int64
+	Entries  int64
+	Size     int64
+	ModTime  int64
+	Words    uint64
+}
+
+// LoadBloomFilter reads a filter written by Save. A missing file returns nil and no error.
+func LoadBloomFilter(path string) (*BloomFilter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+	reader := bufio.NewReaderSize(file, 256*1024)
+
+	magic := make([]byte, len(bloomMagic))
+	if _, err := io.ReadFull(reader, magic); err != nil || string(magic) != bloomMagic {
+		return nil, fmt.Errorf("%s: not a magpie bloom filter", path)
+	}
+	var header bloomHeader
+	if err := binary.Read(reader, binary.LittleEndian, &header); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if header.K == 0 || header.Words == 0 || header.Words > math.MaxInt32 {
+		return nil, fmt.Errorf("%s: corrupt header", path)
+	}
+
+	b := &BloomFilter{
+		bits:    make([]uint64, header.Words),
+		k:       header.K,
+		Entries: int(header.Entries),
+		Source: BloomSource{
+			Size:     header.Size,
+			ModTime:  header.ModTime,
+			Capacity: int(header.Capacity),
+		},
+	}
+	if err := binary.Read(reader, binary.LittleEndian, b.bits); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("%s: truncated", path)
+		}
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return b, nil
+}
+
+// Save writes the filter to path, replacing it atomically
+func (b *BloomFilter) Save(path string) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriterSize(file, 256*1024)
+	header := bloomHeader{
+		K:        b.k,
+		Capacity: int64(b.Source.Capacity),
+		Entries:  int64(b.Entries),
+		Size:     b.Source.Size,
+		ModTime:  b.Source.ModTime,
+		Words:    uint64(len(b.bits)),
+	}
+	writer.WriteString(bloomMagic)
+	binary.Write(writer, binary.LittleEndian, header)
+	binary.Write(writer, binary.LittleEndian, b.bits)
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
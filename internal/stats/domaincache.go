@@ -0,0 +1,149 @@
+package stats
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DomainCacheFile stores the DNS verdict of each validated domain between runs
+const DomainCacheFile = "domain_cache.tsv"
+
+// domainVerdict is one domain's last DNS verdict
+type domainVerdict struct {
+	valid   bool
+	checked int64 // unix seconds
+}
+
+// DomainCache remembers whether each domain passed DNS validation and when, so later
+// runs can skip the lookup. Invalid verdicts are kept for InvalidTTL and valid ones for
+// the shorter ValidTTL, so a recovered domain is found again sooner than a dead one
+// is rechecked. Like FirstSeenStore it is kept apart from stats.json because of its size.
+type DomainCache struct {
+	path       string
+	InvalidTTL time.Duration
+	ValidTTL   time.Duration
+
+	mu       sync.RWMutex
+	verdicts map[string]domainVerdict
+	hits     atomic.Int64
+}
+
+// LoadDomainCache opens the domain cache in dataDir, dropping verdicts that expired
+func LoadDomainCache(dataDir string, invalidTTL, validTTL time.Duration) (*DomainCache, error) {
+	c := &DomainCache{
+		path:       filepath.Join(dataDir, DomainCacheFile),
+		InvalidTTL: invalidTTL,
+		ValidTTL:   validTTL,
+		verdicts:   make(map[string]domainVerdict),
+	}
+
+	file, err := os.Open(c.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	now := time.Now()
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 3 {
+			continue
+		}
+		unix, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: invalid timestamp: %w", DomainCacheFile, lineNum, err)
+		}
+		verdict := domainVerdict{valid: fields[1] == "1", checked: unix}
+		if c.fresh(verdict, now) {
+			c.verdicts[fields[0]] = verdict
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// fresh reports whether a verdict is still within its TTL
+func (c *DomainCache) fresh(verdict domainVerdict, now time.Time) bool {
+	ttl := c.InvalidTTL
+	if verdict.valid {
+		ttl = c.ValidTTL
+	}
+	return now.Sub(time.Unix(verdict.checked, 0)) < ttl
+}
+
+// Lookup returns the cached verdict for a domain; ok is false when there is none or it expired
+func (c *DomainCache) Lookup(domain string, now time.Time) (valid, ok bool) {
+	c.mu.RLock()
+	verdict, found := c.verdicts[domain]
+	c.mu.RUnlock()
+
+	if !found || !c.fresh(verdict, now) {
+		return false, false
+	}
+	c.hits.Add(1)
+	return verdict.valid, true
+}
+
+// Record stores a domain's verdict, checked at now
+func (c *DomainCache) Record(domain string, valid bool, now time.Time) {
+	c.mu.Lock()
+	c.verdicts[domain] = domainVerdict{valid: valid, checked: now.Unix()}
+	c.mu.Unlock()
+}
+
+// Hits returns how many lookups were answered from the cache
+func (c *DomainCache) Hits() int {
+	return int(c.hits.Load())
+}
+
+// Save writes the cache to disk as domain<TAB>1|0<TAB>unix-seconds lines
+func (c *DomainCache) Save() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+
+	tmp := c.path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriterSize(file, 256*1024)
+	for domain, verdict := range c.verdicts {
+		valid := 0
+		if verdict.valid {
+			valid = 1
+		}
+		fmt.Fprintf(writer, "%s\t%d\t%d\n", domain, valid, verdict.checked)
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
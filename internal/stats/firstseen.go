@@ -0,0 +1,112 @@
+package stats
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FirstSeenFile stores when each domain first appeared in the aggregated output
+const FirstSeenFile = "first_seen.tsv"
+
+// FirstSeenStore tracks the first time each domain was seen. It is kept apart from
+// stats.json because it holds one line per domain and can grow to millions of entries.
+type FirstSeenStore struct {
+	path string
+	seen map[string]int64 // domain -> unix seconds
+	mu   sync.RWMutex
+}
+
+// LoadFirstSeen opens the first-seen store in dataDir, starting empty if it doesn't exist
+func LoadFirstSeen(dataDir string) (*FirstSeenStore, error) {
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return nil, err
+	}
+
+	s := &FirstSeenStore{
+		path: filepath.Join(dataDir, FirstSeenFile),
+		seen: make(map[string]int64),
+	}
+
+	file, err := os.Open(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		domain, ts, ok := strings.Cut(scanner.Text(), "\t")
+		if !ok {
+			continue
+		}
+		unix, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: invalid timestamp: %w", FirstSeenFile, lineNum, err)
+		}
+		s.seen[domain] = unix
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Record stores now as the first-seen time for any domain not seen before and returns how many were new
+func (s *FirstSeenStore) Record(domains []string, now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	added := 0
+	for _, domain := range domains {
+		if _, ok := s.seen[domain]; !ok {
+			s.seen[domain] = now.Unix()
+			added++
+		}
+	}
+	return added
+}
+
+// SeenSince returns the domains from the given list first seen at or after cutoff
+func (s *FirstSeenStore) SeenSince(domains []string, cutoff time.Time) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var recent []string
+	for _, domain := range domains {
+		if unix, ok := s.seen[domain]; ok && unix >= cutoff.Unix() {
+			recent = append(recent, domain)
+		}
+	}
+	return recent
+}
+
+// Save writes the store to disk as domain<TAB>unix-seconds lines
+func (s *FirstSeenStore) Save() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	file, err := os.Create(s.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriterSize(file, 256*1024)
+	for domain, unix := range s.seen {
+		fmt.Fprintf(writer, "%s\t%d\n", domain, unix)
+	}
+	return writer.Flush()
+}
@@ -0,0 +1,65 @@
+package stats
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// LockFile is the name of the lock file LockDataDir holds in the data directory
+const LockFile = "magpie.lock"
+
+// ErrLocked is returned by LockDataDir when another process holds the lock
+var ErrLocked = errors.New("data directory is locked by another magpie run")
+
+// DirLock is a held data directory lock
+type DirLock struct {
+	file *os.File
+}
+
+// LockDataDir takes an exclusive advisory lock on dataDir, creating it if needed, so
+// overlapping runs (a slow cron job still writing when the next one starts) can't
+// overwrite each other's stats. It fails at once with ErrLocked instead of waiting. The
+// lock is released by Unlock or when the process exits; the lock file is left in place.
+// Platforms without flock get no locking.
+func LockDataDir(dataDir string) (*DirLock, error) {
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dataDir, LockFile)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(file); err != nil {
+		defer file.Close()
+		if errors.Is(err, ErrLocked) {
+			return nil, fmt.Errorf("%w (%s)", ErrLocked, describeHolder(file, path))
+		}
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+
+	// The holder's PID, for the error the next run reports
+	file.Truncate(0)
+	file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	return &DirLock{file: file}, nil
+}
+
+// Unlock releases the lock
+func (l *DirLock) Unlock() error {
+	return l.file.Close()
+}
+
+// describeHolder names the process holding the lock, as far as the lock file tells
+func describeHolder(file *os.File, path string) string {
+	data := make([]byte, 32)
+	n, _ := file.ReadAt(data, 0)
+	if pid := strings.TrimSpace(string(data[:n])); pid != "" {
+		return "pid " + pid + ", " + path
+	}
+	return path
+}
@@ -0,0 +1,121 @@
+package stats
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// BlacklistPolicy decides a source's blacklist state when merged data-dirs disagree
+type BlacklistPolicy string
+
+const (
+	// PolicyRecent takes the state from the host that checked the source most recently
+	PolicyRecent BlacklistPolicy = "recent"
+	// PolicyMajority blacklists a source when more than half of the hosts tracking it do
+	PolicyMajority BlacklistPolicy = "majority"
+	// PolicyAny blacklists a source when any host does
+	PolicyAny BlacklistPolicy = "any"
+)
+
+// ParseBlacklistPolicy validates a policy name
+func ParseBlacklistPolicy(name string) (BlacklistPolicy, error) {
+	switch policy := BlacklistPolicy(strings.ToLower(strings.TrimSpace(name))); policy {
+	case PolicyRecent, PolicyMajority, PolicyAny:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown blacklist policy %q (use recent, majority or any)", name)
+	}
+}
+
+// MergeDirs loads stats.json from each data-dir and merges them into one tracker.
+// Per source, success and failure counts are summed and the latest timestamps kept;
+// the blacklist state is resolved by policy. A source the policy keeps active has its
+// summed failure count capped below MaxFailures, so the merged stats behave the same
+// when used as a data-dir. The merged tracker has no DataDir and no global stats.
+func MergeDirs(dirs []string, policy BlacklistPolicy) (*Tracker, error) {
+	merged := &Tracker{Stats: make(map[string]*URLStats)}
+
+	// Per source: hosts tracking it, and how many of them blacklisted it
+	hosts := make(map[string]int)
+	blacklistedBy := make(map[string]int)
+
+	for _, dir := range dirs {
+		if _, err := os.Stat(filepath.Join(dir, StatsFile)); err != nil {
+			return nil, fmt.Errorf("%s: %w", dir, err)
+		}
+
+		tracker, err := NewTracker(dir)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", dir, err)
+		}
+
+		for url, stat := range tracker.Stats {
+			hosts[url]++
+			if stat.Blacklisted {
+				blacklistedBy[url]++
+			}
+
+			m, ok := merged.Stats[url]
+			if !ok {
+				statCopy := *stat
+				merged.Stats[url] = &statCopy
+				continue
+			}
+			mergeURLStats(m, stat, policy)
+		}
+	}
+
+	for url, m := range merged.Stats {
+		switch policy {
+		case PolicyAny:
+			m.Blacklisted = blacklistedBy[url] > 0
+		case PolicyMajority:
+			m.Blacklisted = blacklistedBy[url]*2 > hosts[url]
+		}
+
+		if !m.Blacklisted {
+			m.BlacklistedAt = time.Time{}
+			if m.FailureCount >= MaxFailures {
+				m.FailureCount = MaxFailures - 1
+			}
+		}
+	}
+
+	return merged, nil
+}
+
+// mergeURLStats folds one host's stats for a source into the merged entry
+func mergeURLStats(m, stat *URLStats, policy BlacklistPolicy) {
+	// Most recently checked host wins for state that can't be summed
+	if stat.LastChecked.After(m.LastChecked) {
+		m.LastChecked = stat.LastChecked
+		m.ValidationMethod = stat.ValidationMethod
+		if policy == PolicyRecent {
+			m.Blacklisted = stat.Blacklisted
+			m.BlacklistedAt = stat.BlacklistedAt
+		}
+	}
+
+	m.SuccessCount += stat.SuccessCount
+	m.FailureCount += stat.FailureCount
+	m.TotalFailures += stat.TotalFailures
+
+	if stat.LastSuccess.After(m.LastSuccess) {
+		m.LastSuccess = stat.LastSuccess
+		m.DomainsContributed = stat.DomainsContributed
+	}
+	if stat.LastFailure.After(m.LastFailure) {
+		m.LastFailure = stat.LastFailure
+		m.LastError = stat.LastError
+	}
+
+	// For the counting policies, keep the earliest blacklisting time across hosts
+	if policy != PolicyRecent && stat.Blacklisted {
+		if m.BlacklistedAt.IsZero() || stat.BlacklistedAt.Before(m.BlacklistedAt) {
+			m.BlacklistedAt = stat.BlacklistedAt
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package stats
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// WritePromTextfile writes run metrics in Prometheus exposition format for
+// node_exporter's textfile collector. sourceDomains holds the domains each source
+// contributed this run (may be nil). The file is replaced atomically, so the collector
+// never scrapes a half-written file; the temporary file ends in .tmp, which it ignores.
+func WritePromTextfile(path string, global *GlobalStats, sourceDomains map[string]int) error {
+	var b strings.Builder
+
+	writeMetric := func(name, help string, value any) {
+		fmt.Fprintf(&b, "# HELP %s %s\n", name, help)
+		fmt.Fprintf(&b, "# TYPE %s gauge\n", name)
+		fmt.Fprintf(&b, "%s %v\n", name, value)
+	}
+
+	writeMetric("magpie_domains_total", "Unique domains aggregated in the last run.", global.TotalDomainsUnique)
+	writeMetric("magpie_domains_valid", "Domains that passed validation in the last run.", global.ValidDomains)
+	writeMetric("magpie_valid_total", "Domains that passed validation in the last run (same as magpie_domains_valid).", global.ValidDomains)
+	writeMetric("magpie_invalid_total", "Domains that failed validation in the last run.", global.InvalidDomains)
+	writeMetric("magpie_duplicates_removed", "Duplicate domains removed in the last run.", global.DuplicatesRemoved)
+	writeMetric("magpie_sources_fetched", "Sources fetched successfully in the last run.", global.TotalURLsFetched)
+	writeMetric("magpie_urls_failed", "Sources that failed to fetch in the last run.", global.TotalURLsFailed)
+	writeMetric("magpie_sources_failed", "Sources that failed to fetch in the last run (same as magpie_urls_failed).", global.TotalURLsFailed)
+	writeMetric("magpie_run_duration_seconds", "Wall-clock duration of the last run in seconds.", fmt.Sprintf("%.3f", global.DurationSeconds))
+	writeMetric("magpie_duration_seconds", "Wall-clock duration of the last run in seconds (same as magpie_run_duration_seconds).", fmt.Sprintf("%.3f", global.DurationSeconds))
+	writeMetric("magpie_last_run_timestamp_seconds", "Unix time the last run finished.", global.LastRun.Unix())
+
+	if len(sourceDomains) > 0 {
+		urls := make([]string, 0, len(sourceDomains))
+		for url := range sourceDomains {
+			urls = append(urls, url)
+		}
+		sort.Strings(urls)
+
+		b.WriteString("# HELP magpie_source_domains Domains parsed from each source in the last run, duplicates included.\n")
+		b.WriteString("# TYPE magpie_source_domains gauge\n")
+		for _, url := range urls {
+			fmt.Fprintf(&b, "magpie_source_domains{url=\"%s\"} %d\n", escapeLabel(url), sourceDomains[url])
+		}
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// escapeLabel escapes a Prometheus label value
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
@@ -0,0 +1,60 @@
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// SerialFile stores the last zone serial handed out by the date+counter strategy
+const SerialFile = "zone-serial.json"
+
+// serialState is the content of SerialFile
+type serialState struct {
+	Serial uint32 `json:"serial"`
+}
+
+// NextDateSerial returns a YYYYMMDDNN zone serial for now and persists it in dataDir.
+// Each call on the same day increments the counter, and the serial never goes below
+// the last one handed out, so secondaries always see it increase.
+func NextDateSerial(dataDir string, now time.Time) (uint32, error) {
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return 0, err
+	}
+	path := filepath.Join(dataDir, SerialFile)
+
+	var state serialState
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &state); err != nil {
+			return 0, fmt.Errorf("%s: %w", SerialFile, err)
+		}
+	}
+
+	day, err := strconv.ParseUint(now.UTC().Format("20060102"), 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	serial := uint32(day) * 100
+	if state.Serial >= serial {
+		if state.Serial-serial >= 99 {
+			return 0, fmt.Errorf("zone serial counter for %s exhausted (100 runs in one day)", now.UTC().Format("2006-01-02"))
+		}
+		serial = state.Serial + 1
+	}
+
+	data, err = json.MarshalIndent(serialState{Serial: serial}, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return 0, err
+	}
+	return serial, nil
+}
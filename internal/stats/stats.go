@@ -2,8 +2,10 @@ package stats
 
 import (
 	"encoding/json"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 )
@@ -11,6 +13,12 @@ import (
 const (
 	// MaxFailures before a URL is filtered out
 	MaxFailures = 3
+	// PermanentMaxFailures before a URL that answers 404 / 410 / 401 / 403 is filtered out
+	PermanentMaxFailures = 2
+	// UnreliableRate is the success rate (percent) below which a source counts as unreliable
+	UnreliableRate = 50.0
+	// minReliabilitySamples is how many fetches a source needs before it can be called unreliable
+	minReliabilitySamples = 4
 	// StatsFile name
 	StatsFile = "stats.json"
 )
@@ -20,6 +28,7 @@ type URLStats struct {
 	URL              string    `json:"url"`
 	SuccessCount     int       `json:"success_count"`
 	FailureCount     int       `json:"failure_count"`
+	TotalFailures    int       `json:"total_failures,omitempty"` // Lifetime failures; FailureCount resets on recovery
 	LastSuccess      time.Time `json:"last_success,omitempty"`
 	LastFailure      time.Time `json:"last_failure,omitempty"`
 	LastError        string    `json:"last_error,omitempty"`
@@ -27,6 +36,8 @@ type URLStats struct {
 	BlacklistedAt    time.Time `json:"blacklisted_at,omitempty"`
 	ValidationMethod string    `json:"validation_method,omitempty"` // "none", "dns", "http", "dns+http"
 	LastChecked      time.Time `json:"last_checked"`
+
+	DomainsContributed int `json:"domains_contributed,omitempty"` // Domains parsed on the last successful fetch
 }
 
 // GlobalStats tracks aggregate statistics from the last run
@@ -40,6 +51,12 @@ type GlobalStats struct {
 	ValidDomains       int       `json:"valid_domains"`         // Domains that passed validation
 	InvalidDomains     int       `json:"invalid_domains"`       // Domains that failed validation
 	ValidationMethod   string    `json:"validation_method"`     // "none", "dns", "http", "dns+http"
+	DurationSeconds    float64   `json:"duration_seconds,omitempty"` // Wall-clock time of the run
+	ConnectSeconds     float64   `json:"connect_seconds,omitempty"`    // Internet connection check
+	FetchSeconds       float64   `json:"fetch_seconds,omitempty"`      // Fetching and parsing the sources
+	ValidationSeconds  float64   `json:"validation_seconds,omitempty"` // DNS / HTTP validation
+	WriteSeconds       float64   `json:"write_seconds,omitempty"`      // Writing the output and extra files
+	LastEmptyRun       time.Time `json:"last_empty_run,omitempty"`   // Last run that found no domains at all
 }
 
 // StatsData represents the complete stats file structure
@@ -54,6 +71,20 @@ type Tracker struct {
 	Stats        map[string]*URLStats
 	GlobalStats  *GlobalStats
 	mu           sync.RWMutex
+	saveMu       sync.Mutex // one Save at a time owns the temp file
+
+	// NewSourceGrace is how many failures beyond MaxFailures a source that has never
+	// fetched successfully gets, so a new source that fails at first isn't treated like
+	// an established one that broke
+	NewSourceGrace int
+
+	// FailureDecay forgives one failure per period since a source last failed, so a
+	// blacklisted source is tried again once a period passes without a failure. Zero keeps
+	// a blacklist until the source is reset or recovers.
+	FailureDecay time.Duration
+
+	// newlyBlacklisted collects URLs that crossed the failure threshold during this run
+	newlyBlacklisted []string
 }
 
 // NewTracker creates a new stats tracker
@@ -110,25 +141,54 @@ func (t *Tracker) Load() error {
 	return nil
 }
 
-// Save writes stats to disk
+// Save writes stats to disk. The file is replaced by renaming a complete temp file over
+// it, so a reader or a crash mid-write never sees a truncated stats.json; LockDataDir
+// keeps other processes from saving at the same time.
 func (t *Tracker) Save() error {
+	t.saveMu.Lock()
+	defer t.saveMu.Unlock()
+
 	t.mu.RLock()
-	defer t.mu.RUnlock()
+	data, err := t.marshalLocked()
+	t.mu.RUnlock()
+	if err != nil {
+		return err
+	}
 
 	statsPath := filepath.Join(t.DataDir, StatsFile)
-
-	// Use new format with sources and global stats
-	statsData := StatsData{
-		Sources: t.Stats,
-		Global:  t.GlobalStats,
+	tmp := statsPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		os.Remove(tmp)
+		return err
 	}
+	if err := os.Rename(tmp, statsPath); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// WriteJSON writes the full StatsData to w, in the same form as the stats file
+func (t *Tracker) WriteJSON(w io.Writer) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 
-	data, err := json.MarshalIndent(statsData, "", "  ")
+	data, err := t.marshalLocked()
 	if err != nil {
 		return err
 	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
 
-	return os.WriteFile(statsPath, data, 0644)
+// marshalLocked encodes the stats file. The caller must hold mu.
+func (t *Tracker) marshalLocked() ([]byte, error) {
+	// Use new format with sources and global stats
+	statsData := StatsData{
+		Sources: t.Stats,
+		Global:  t.GlobalStats,
+	}
+	return json.MarshalIndent(statsData, "", "  ")
 }
 
 // IsBlacklisted checks if a URL should be filtered out
@@ -137,11 +197,74 @@ func (t *Tracker) IsBlacklisted(url string) bool {
 	defer t.mu.RUnlock()
 
 	if stat, ok := t.Stats[url]; ok {
-		return stat.Blacklisted || stat.FailureCount >= MaxFailures
+		return t.Filtered(stat)
 	}
 	return false
 }
 
+// Filtered reports whether a source is blacklisted or has reached its failure limit.
+// With FailureDecay a blacklisted source is let through once a failure has decayed; if
+// it fails again it is back at its limit and filtered for another period.
+func (t *Tracker) Filtered(stat *URLStats) bool {
+	if t.FailureDecay <= 0 {
+		return stat.Blacklisted || stat.FailureCount >= t.failureLimit(stat)
+	}
+	if stat.Blacklisted && time.Since(stat.LastFailure) < t.FailureDecay {
+		return true
+	}
+	return t.decayedFailures(stat, time.Now()) >= t.failureLimit(stat)
+}
+
+// decayedFailures returns the failure count less one failure per FailureDecay since the last failure
+func (t *Tracker) decayedFailures(stat *URLStats, now time.Time) int {
+	if t.FailureDecay <= 0 || stat.LastFailure.IsZero() {
+		return stat.FailureCount
+	}
+	decayed := stat.FailureCount - int(now.Sub(stat.LastFailure)/t.FailureDecay)
+	if decayed < 0 {
+		return 0
+	}
+	return decayed
+}
+
+// failureLimit returns how many failures blacklist a source
+func (t *Tracker) failureLimit(stat *URLStats) int {
+	if stat.NeverWorked() {
+		return MaxFailures + t.NewSourceGrace
+	}
+	return MaxFailures
+}
+
+// NeverWorked reports whether a source has never been fetched successfully
+func (s *URLStats) NeverWorked() bool {
+	return s.SuccessCount == 0
+}
+
+// lifetimeFailures returns all failures ever recorded. Stats files written before
+// TotalFailures existed only have the current FailureCount.
+func (s *URLStats) lifetimeFailures() int {
+	if s.TotalFailures < s.FailureCount {
+		return s.FailureCount
+	}
+	return s.TotalFailures
+}
+
+// SuccessRate returns the percentage of all fetches that succeeded; ok is false before the first fetch
+func (s *URLStats) SuccessRate() (rate float64, ok bool) {
+	total := s.SuccessCount + s.lifetimeFailures()
+	if total == 0 {
+		return 0, false
+	}
+	return float64(s.SuccessCount) / float64(total) * 100, true
+}
+
+// Unreliable reports whether a source fails more often than it succeeds, once it has
+// been fetched often enough to tell
+func (s *URLStats) Unreliable() bool {
+	rate, ok := s.SuccessRate()
+	return ok && s.SuccessCount+s.lifetimeFailures() >= minReliabilitySamples && rate < UnreliableRate
+}
+
 // RecordSuccess updates stats for a successful fetch
 func (t *Tracker) RecordSuccess(url string) {
 	t.mu.Lock()
@@ -166,8 +289,43 @@ func (t *Tracker) RecordSuccess(url string) {
 	}
 }
 
+// FetchedWithin reports whether a source was last fetched successfully less than window
+// before now. A 304 revalidation counts as a fetch, a -min-interval reuse doesn't.
+func (t *Tracker) FetchedWithin(url string, window time.Duration, now time.Time) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	stat, ok := t.Stats[url]
+	return ok && !stat.LastSuccess.IsZero() && now.Sub(stat.LastSuccess) < window
+}
+
+// RecordDomains stores how many domains a source yielded on its latest successful fetch
+func (t *Tracker) RecordDomains(url string, count int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stat, ok := t.Stats[url]
+	if !ok {
+		stat = &URLStats{URL: url}
+		t.Stats[url] = stat
+	}
+	stat.DomainsContributed = count
+}
+
 // RecordFailure updates stats for a failed fetch
 func (t *Tracker) RecordFailure(url string, errorMsg string) {
+	t.recordFailure(url, errorMsg, false)
+}
+
+// RecordPermanentFailure is RecordFailure for a source that reported itself gone (404,
+// 410, 401, 403). It is blacklisted after PermanentMaxFailures consecutive failures,
+// without the new-source grace.
+func (t *Tracker) RecordPermanentFailure(url string, errorMsg string) {
+	t.recordFailure(url, errorMsg, true)
+}
+
+// recordFailure books a failed fetch and blacklists the source once it reaches its limit
+func (t *Tracker) recordFailure(url string, errorMsg string, permanent bool) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
@@ -177,18 +335,35 @@ func (t *Tracker) RecordFailure(url string, errorMsg string) {
 		t.Stats[url] = stat
 	}
 
-	stat.FailureCount++
-	stat.LastFailure = time.Now()
+	now := time.Now()
+	stat.FailureCount = t.decayedFailures(stat, now) + 1
+	stat.TotalFailures = stat.lifetimeFailures() + 1
+	stat.LastFailure = now
 	stat.LastChecked = time.Now()
 	stat.LastError = errorMsg
 
 	// Blacklist if failure count reaches threshold
-	if stat.FailureCount >= MaxFailures && !stat.Blacklisted {
+	limit := t.failureLimit(stat)
+	if permanent && limit > PermanentMaxFailures {
+		limit = PermanentMaxFailures
+	}
+	if stat.FailureCount >= limit && !stat.Blacklisted {
 		stat.Blacklisted = true
 		stat.BlacklistedAt = time.Now()
+		t.newlyBlacklisted = append(t.newlyBlacklisted, url)
 	}
 }
 
+// NewlyBlacklisted returns URLs that became blacklisted since the tracker was loaded
+func (t *Tracker) NewlyBlacklisted() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	newly := make([]string, len(t.newlyBlacklisted))
+	copy(newly, t.newlyBlacklisted)
+	return newly
+}
+
 // RecordValidation updates validation method for a URL
 func (t *Tracker) RecordValidation(url string, method string) {
 	t.mu.Lock()
@@ -203,12 +378,9 @@ func (t *Tracker) RecordValidation(url string, method string) {
 	stat.ValidationMethod = method
 }
 
-// RecordGlobalStats updates the global statistics from the last run
-func (t *Tracker) RecordGlobalStats(urlsFetched, urlsFailed, domainsRaw, domainsUnique, duplicates, valid, invalid int, method string) {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-
-	t.GlobalStats = &GlobalStats{
+// NewGlobalStats builds global statistics for a run that finished now
+func NewGlobalStats(urlsFetched, urlsFailed, domainsRaw, domainsUnique, duplicates, valid, invalid int, method string) *GlobalStats {
+	return &GlobalStats{
 		LastRun:            time.Now(),
 		TotalURLsFetched:   urlsFetched,
 		TotalURLsFailed:    urlsFailed,
@@ -219,15 +391,52 @@ func (t *Tracker) RecordGlobalStats(urlsFetched, urlsFailed, domainsRaw, domains
 		InvalidDomains:     invalid,
 		ValidationMethod:   method,
 	}
+}
+
+// RecordGlobalStats updates the global statistics from the last run
+func (t *Tracker) RecordGlobalStats(urlsFetched, urlsFailed, domainsRaw, domainsUnique, duplicates, valid, invalid int, method string) {
+	t.RecordGlobal(NewGlobalStats(urlsFetched, urlsFailed, domainsRaw, domainsUnique, duplicates, valid, invalid, method))
+}
+
+// RecordGlobal stores the global statistics from the last run
+func (t *Tracker) RecordGlobal(global *GlobalStats) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	globalCopy := *global
+	t.GlobalStats = &globalCopy
 
 	// Update validation method for all successfully fetched URLs
 	for _, stat := range t.Stats {
 		if stat.SuccessCount > 0 && stat.LastSuccess.After(time.Now().Add(-24*time.Hour)) {
-			stat.ValidationMethod = method
+			stat.ValidationMethod = global.ValidationMethod
 		}
 	}
 }
 
+// RecordEmptyRun notes a run that found no domains. The last good run's totals are kept.
+func (t *Tracker) RecordEmptyRun() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.GlobalStats == nil {
+		t.GlobalStats = &GlobalStats{}
+	}
+	t.GlobalStats.LastEmptyRun = time.Now()
+}
+
+// LastGlobalStats returns a copy of the current global stats (the previous run until RecordGlobalStats is called)
+func (t *Tracker) LastGlobalStats() *GlobalStats {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.GlobalStats == nil {
+		return nil
+	}
+	globalCopy := *t.GlobalStats
+	return &globalCopy
+}
+
 // GetBlacklistedURLs returns all blacklisted URLs
 func (t *Tracker) GetBlacklistedURLs() []string {
 	t.mu.RLock()
@@ -235,7 +444,7 @@ func (t *Tracker) GetBlacklistedURLs() []string {
 
 	var blacklisted []string
 	for url, stat := range t.Stats {
-		if stat.Blacklisted || stat.FailureCount >= MaxFailures {
+		if t.Filtered(stat) {
 			blacklisted = append(blacklisted, url)
 		}
 	}
@@ -271,14 +480,54 @@ func (t *Tracker) FilterURLs(urls []string) ([]string, []string) {
 	return active, filtered
 }
 
-// ResetURL removes blacklist status for a URL (manual intervention)
-func (t *Tracker) ResetURL(url string) {
+// ResetURL removes blacklist status for a URL (manual intervention). Returns false if the URL isn't tracked.
+func (t *Tracker) ResetURL(url string) bool {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	if stat, ok := t.Stats[url]; ok {
-		stat.Blacklisted = false
-		stat.BlacklistedAt = time.Time{}
-		stat.FailureCount = 0
+	stat, ok := t.Stats[url]
+	if ok {
+		stat.reset()
 	}
+	return ok
+}
+
+// ResetAll removes blacklist status and failure counts for every URL and returns the
+// sorted URLs that had any
+func (t *Tracker) ResetAll() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var reset []string
+	for url, stat := range t.Stats {
+		if stat.Blacklisted || stat.FailureCount > 0 {
+			stat.reset()
+			reset = append(reset, url)
+		}
+	}
+	sort.Strings(reset)
+	return reset
+}
+
+// Prune removes every source drop reports true for and returns their URLs, sorted
+func (t *Tracker) Prune(drop func(url string, stat *URLStats) bool) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var pruned []string
+	for url, stat := range t.Stats {
+		if drop(url, stat) {
+			delete(t.Stats, url)
+			pruned = append(pruned, url)
+		}
+	}
+	sort.Strings(pruned)
+	return pruned
+}
+
+// reset clears the blacklist and the current failure streak; lifetime counts are kept
+func (s *URLStats) reset() {
+	s.Blacklisted = false
+	s.BlacklistedAt = time.Time{}
+	s.FailureCount = 0
 }
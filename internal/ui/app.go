@@ -58,8 +58,11 @@ type AppModel struct {
 	validationDone    bool
 
 	// Results
-	outputFile string
-	done       bool
+	outputFile       string
+	dryRun           bool
+	newlyBlacklisted []string
+	notes            []string
+	done             bool
 }
 
 // Messages
@@ -95,11 +98,19 @@ type ValidationProgressMsg struct {
 	Valid   int
 	Invalid int
 }
+// ValidationTotalMsg reports how many domains validation covers once an overlapping
+// fetch has finished; until then ValidationStartMsg.Total is 0
+type ValidationTotalMsg struct {
+	Total int
+}
 type ValidationDoneMsg struct{}
 type CompletionMsg struct {
-	OutputFile string
-	Valid      int
-	Invalid    int
+	OutputFile       string
+	DryRun           bool
+	Valid            int
+	Invalid          int
+	NewlyBlacklisted []string
+	Notes            []string
 }
 
 func NewAppModel() AppModel {
@@ -177,6 +188,10 @@ func (m AppModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.validationStart = time.Now()
 		return m, m.spinner.Tick
 
+	case ValidationTotalMsg:
+		m.validationTotal = msg.Total
+		return m, nil
+
 	case ValidationProgressMsg:
 		m.validationCurrent = msg.Current
 		m.validationValid = msg.Valid
@@ -190,6 +205,11 @@ func (m AppModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case CompletionMsg:
 		m.stage = StageDone
 		m.outputFile = msg.OutputFile
+		m.dryRun = msg.DryRun
+		m.validationValid = msg.Valid
+		m.validationInvalid = msg.Invalid
+		m.newlyBlacklisted = msg.NewlyBlacklisted
+		m.notes = msg.Notes
 		m.done = true
 		return m, tea.Quit
 	}
@@ -322,8 +342,13 @@ func (m AppModel) renderValidation() string {
 	s.WriteString(titleStyle.Render("🔍 Validating Domains"))
 	s.WriteString("\n\n")
 
-	// Progress bar
-	percentage := float64(m.validationCurrent) / float64(m.validationTotal)
+	// Progress bar; an overlapping fetch may still be adding domains, so until the total
+	// is known the bar tracks the domains found so far
+	total := m.validationTotal
+	if total == 0 {
+		total = max(m.domainsFound, 1)
+	}
+	percentage := float64(m.validationCurrent) / float64(total)
 	if percentage > 1 {
 		percentage = 1
 	}
@@ -344,11 +369,18 @@ func (m AppModel) renderValidation() string {
 	labelStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("240")).Width(18)
 
 	// Progress
-	progressValue := lipgloss.NewStyle().Foreground(lipgloss.Color("86")).Bold(true).
-		Render(fmt.Sprintf("%s / %s (%.1f%%)",
+	progressText := fmt.Sprintf("%s / %s (%.1f%%)",
+		formatNumber(m.validationCurrent),
+		formatNumber(m.validationTotal),
+		percentage*100)
+	if m.validationTotal == 0 {
+		progressText = fmt.Sprintf("%s / %s so far (fetching %d/%d sources)",
 			formatNumber(m.validationCurrent),
-			formatNumber(m.validationTotal),
-			percentage*100))
+			formatNumber(m.domainsFound),
+			m.fetchedURLs, m.totalFetchURLs)
+	}
+	progressValue := lipgloss.NewStyle().Foreground(lipgloss.Color("86")).Bold(true).
+		Render(progressText)
 	statsContent.WriteString(fmt.Sprintf("%s %s\n", labelStyle.Render("Progress:"), progressValue))
 
 	// Valid
@@ -370,7 +402,7 @@ func (m AppModel) renderValidation() string {
 		statsContent.WriteString(fmt.Sprintf("%s %s\n", labelStyle.Render("Speed:"), speedValue))
 
 		// ETA
-		if speed > 0 {
+		if speed > 0 && m.validationTotal > 0 {
 			remaining := m.validationTotal - m.validationCurrent
 			eta := time.Duration(float64(remaining)/speed) * time.Second
 			etaValue := lipgloss.NewStyle().Foreground(lipgloss.Color("117")).
@@ -419,6 +451,10 @@ func (m AppModel) renderCompletion() string {
 	// Output file
 	fileValue := lipgloss.NewStyle().Foreground(lipgloss.Color("86")).Bold(true).
 		Render(m.outputFile)
+	if m.dryRun {
+		fileValue = lipgloss.NewStyle().Foreground(lipgloss.Color("214")).Bold(true).
+			Render("DRY RUN — no files written")
+	}
 	summary.WriteString(fmt.Sprintf("%s %s\n", labelStyle.Render("Output file:"), fileValue))
 
 	// Total valid domains
@@ -439,6 +475,30 @@ func (m AppModel) renderCompletion() string {
 		summary.WriteString(fmt.Sprintf("%s %s", labelStyle.Render("Cleaning rate:"), rateValue))
 	}
 
+	// Sources that crossed the failure threshold this run
+	if len(m.newlyBlacklisted) > 0 {
+		warnStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("214")).Bold(true)
+		summary.WriteString("\n\n")
+		summary.WriteString(warnStyle.Render(fmt.Sprintf("🚫 %d sources newly blacklisted this run", len(m.newlyBlacklisted))))
+		for _, url := range m.newlyBlacklisted {
+			if len(url) > 50 {
+				url = url[:47] + "..."
+			}
+			summary.WriteString("\n")
+			summary.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color("245")).Render("  - " + url))
+		}
+	}
+
+	// Extra notes from optional processing steps
+	if len(m.notes) > 0 {
+		summary.WriteString("\n")
+		noteStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("117"))
+		for _, note := range m.notes {
+			summary.WriteString("\n")
+			summary.WriteString(noteStyle.Render("• " + note))
+		}
+	}
+
 	s.WriteString(lipgloss.NewStyle().Padding(0, 2).Render(summaryStyle.Render(summary.String())))
 
 	return s.String()
@@ -21,6 +21,7 @@ type ProgressModel struct {
 
 type progressMsg struct {
 	current int
+	total   int // 0 keeps the current total
 	valid   int
 	invalid int
 }
@@ -54,7 +55,10 @@ func (m ProgressModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.current = msg.current
 		m.valid = msg.valid
 		m.invalid = msg.invalid
-		if m.current >= m.total {
+		if msg.total > 0 {
+			m.total = msg.total
+		}
+		if m.total > 0 && m.current >= m.total {
 			m.done = true
 			return m, tea.Quit
 		}
@@ -75,10 +79,14 @@ func (m ProgressModel) View() string {
 	}
 
 	elapsed := time.Since(m.startTime)
+	speed := float64(m.current) / elapsed.Seconds()
+
+	if m.total == 0 {
+		return m.viewUnknownTotal(elapsed, speed)
+	}
 	percentage := float64(m.current) / float64(m.total)
 
-	// Calculate speed and ETA
-	speed := float64(m.current) / elapsed.Seconds()
+	// Calculate ETA
 	remaining := m.total - m.current
 	eta := time.Duration(float64(remaining)/speed) * time.Second
 
@@ -121,8 +129,26 @@ func (m ProgressModel) View() string {
 	return fmt.Sprintf("\n%s\n%s\n%s\n%s\n", title, progressBar, stats, timing)
 }
 
-func UpdateProgress(current, valid, invalid int) tea.Msg {
-	return progressMsg{current: current, valid: valid, invalid: invalid}
+// viewUnknownTotal renders progress while domains are still arriving (total 0), without
+// a bar or ETA
+func (m ProgressModel) viewUnknownTotal(elapsed time.Duration, speed float64) string {
+	title := lipgloss.NewStyle().Foreground(lipgloss.Color("99")).Bold(true).
+		Render("🔍 Validating Domains (still fetching)")
+	stats := fmt.Sprintf("%s checked | %s valid | %s invalid | %.0f domains/s",
+		formatNumber(m.current),
+		lipgloss.NewStyle().Foreground(lipgloss.Color("10")).Bold(true).Render(formatNumber(m.valid)),
+		lipgloss.NewStyle().Foreground(lipgloss.Color("9")).Bold(true).Render(formatNumber(m.invalid)),
+		speed,
+	)
+	timing := lipgloss.NewStyle().Foreground(lipgloss.Color("240")).
+		Render(fmt.Sprintf("[%s elapsed]", formatDuration(elapsed)))
+	return fmt.Sprintf("\n%s\n%s\n%s\n", title, stats, timing)
+}
+
+// UpdateProgress reports validation progress; total is the number of domains to
+// validate, or 0 while it isn't known yet
+func UpdateProgress(current, total, valid, invalid int) tea.Msg {
+	return progressMsg{current: current, total: total, valid: valid, invalid: invalid}
 }
 
 func SendDone() tea.Msg {
@@ -0,0 +1,243 @@
+package validator
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DefaultBatchWorkers is the ValidateBatch concurrency when BatchWorkers is unset
+const DefaultBatchWorkers = 100
+
+// batchConnsKey carries a ValidateBatch worker's batchConns in its context
+type batchConnsKey struct{}
+
+// batchConns are one ValidateBatch worker's open UDP connections, one per resolver,
+// with the message and buffers every query reuses. The system resolver's lookups open a
+// socket per record type per domain; these stay open for the whole batch. Used by one
+// goroutine at a time.
+type batchConns struct {
+	conns map[string]*dns.Conn
+	query dns.Msg
+	resp  dns.Msg
+	out   []byte
+	in    []byte
+}
+
+func newBatchConns() *batchConns {
+	return &batchConns{
+		conns: make(map[string]*dns.Conn),
+		out:   make([]byte, 0, 512),
+		in:    make([]byte, dns.DefaultMsgSize),
+	}
+}
+
+// conn returns the open connection to server, dialing it on first use
+func (b *batchConns) conn(server string, timeout time.Duration) (*dns.Conn, error) {
+	if conn, ok := b.conns[server]; ok {
+		return conn, nil
+	}
+	conn, err := dns.DialTimeout("udp", server, timeout)
+	if err != nil {
+		return nil, err
+	}
+	b.conns[server] = conn
+	return conn, nil
+}
+
+// drop closes a connection that failed, so the next query dials a fresh one
+func (b *batchConns) drop(server string) {
+	if conn, ok := b.conns[server]; ok {
+		conn.Close()
+		delete(b.conns, server)
+	}
+}
+
+func (b *batchConns) close() {
+	for _, conn := range b.conns {
+		conn.Close()
+	}
+}
+
+// lookupBatched is lookupDomain over the worker's connection to resolver idx: the queries
+// (A and AAAA by default) go out back to back and the answers are read as they come, all
+// from the calling goroutine. A CNAME shows up in the answer to either query, so it needs
+// no query of its own. Answers to earlier queries that timed out are recognized by ID and
+// skipped.
+func (v *Validator) lookupBatched(ctx context.Context, b *batchConns, idx int, domain string, timeout time.Duration) (bool, DNSErrorClass) {
+	server := v.servers[idx]
+	deadline := time.Now().Add(timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+
+	conn, err := b.conn(server, timeout)
+	if err != nil {
+		v.tracef(ctx, "dns %s @%s: %v", domain, server, err)
+		return false, exchangeErrorClass(err)
+	}
+	conn.SetDeadline(deadline)
+
+	// ids holds the query ID of each record type until it is answered
+	fqdn := dns.Fqdn(domain)
+	records := v.records()
+	var qbuf, ids [2]uint16
+	qtypes := records.queryTypes(qbuf[:0])
+	for i, qtype := range qtypes {
+		b.query.SetQuestion(fqdn, qtype)
+		b.query.RecursionDesired = true
+		ids[i] = b.query.Id
+		out, err := b.query.PackBuffer(b.out)
+		if err == nil {
+			b.out = out[:0]
+			_, err = conn.Write(out)
+		}
+		if err != nil {
+			b.drop(server)
+			v.tracef(ctx, "dns %s %s @%s: %v", domain, dns.TypeToString[qtype], server, err)
+			return false, exchangeErrorClass(err)
+		}
+	}
+
+	var failures lookupFailures
+	for answered := 0; answered < len(qtypes); {
+		n, err := conn.Read(b.in)
+		if err != nil {
+			// Whatever is still pending gets the same verdict as the read
+			c := exchangeErrorClass(err)
+			if c != DNSTimeout {
+				b.drop(server)
+			}
+			v.tracef(ctx, "dns %s @%s: %s (%v)", domain, server, c, err)
+			failures.add(c, false)
+			break
+		}
+		if b.resp.Unpack(b.in[:n]) != nil || len(b.resp.Question) != 1 {
+			continue
+		}
+		qi := -1
+		for i, qtype := range qtypes {
+			if b.resp.Id == ids[i] && b.resp.Question[0].Qtype == qtype && strings.EqualFold(b.resp.Question[0].Name, fqdn) {
+				qi = i
+			}
+		}
+		if qi < 0 {
+			continue // a late answer to an earlier domain
+		}
+		ids[qi] = 0
+		answered++
+
+		valid, c, _ := answerClass(&b.resp, records, v.IgnoreIPs)
+		v.tracef(ctx, "dns %s %s @%s: %s", domain, dns.TypeToString[qtypes[qi]], server, c)
+		if valid {
+			return true, DNSNoError
+		}
+		failures.add(c, b.resp.Rcode == dns.RcodeNameError)
+	}
+	return false, failures.result()
+}
+
+// ValidateBatch is ValidateDNS for many domains, checked by BatchWorkers workers
+// (DefaultBatchWorkers when unset). Each worker keeps one context and one open connection
+// per resolver for all its domains instead of setting them up per lookup, which cuts the
+// allocations of large runs severalfold. The system resolver and TTL-aware lookups take
+// the per-domain path. Result i is the verdict for domains[i]; domains not reached
+// before ctx is cancelled are reported invalid.
+func (v *Validator) ValidateBatch(ctx context.Context, domains []string) []bool {
+	valid, _ := v.ValidateBatchResult(ctx, domains)
+	return valid
+}
+
+// ValidateBatchResult is ValidateBatch that also reports why each invalid domain failed,
+// as ValidateDNSResult does. Domains not reached before ctx is cancelled get DNSTimeout.
+func (v *Validator) ValidateBatchResult(ctx context.Context, domains []string) ([]bool, []DNSErrorClass) {
+	valid := make([]bool, len(domains))
+	class := make([]DNSErrorClass, len(domains))
+
+	var next atomic.Int64
+	v.runBatchWorkers(ctx, len(domains), func(ctx, workerCtx context.Context) bool {
+		if ctx.Err() != nil {
+			return false
+		}
+		idx := int(next.Add(1) - 1)
+		if idx >= len(domains) {
+			return false
+		}
+		valid[idx], class[idx] = v.ValidateDNSResult(workerCtx, domains[idx])
+		return true
+	})
+
+	// Whatever the interrupt left unchecked has no verdict either way
+	if ctx.Err() != nil {
+		for idx := int(next.Load()); idx < len(domains); idx++ {
+			class[idx] = DNSTimeout
+		}
+	}
+	return valid, class
+}
+
+// BatchResult is the DNS verdict of one domain of ValidateStream
+type BatchResult struct {
+	Domain string
+	Valid  bool
+	Class  DNSErrorClass
+}
+
+// ValidateStream is ValidateBatch fed from a channel, for domains that arrive over a
+// run: its BatchWorkers workers and their connections stay up until domains is closed,
+// each taking the next domain as soon as it is done with one, so a slow lookup holds up
+// only its own worker. Results come out in completion order, and the returned channel
+// is closed once domains is drained. After ctx is cancelled the remaining domains are
+// passed through unchecked, as DNSTimeout.
+func (v *Validator) ValidateStream(ctx context.Context, domains <-chan string) <-chan BatchResult {
+	workers := v.BatchWorkers
+	if workers <= 0 {
+		workers = DefaultBatchWorkers
+	}
+	results := make(chan BatchResult, workers*2)
+	go func() {
+		defer close(results)
+		v.runBatchWorkers(ctx, workers, func(ctx, workerCtx context.Context) bool {
+			domain, ok := <-domains
+			if !ok {
+				return false
+			}
+			result := BatchResult{Domain: domain, Class: DNSTimeout}
+			if ctx.Err() == nil {
+				result.Valid, result.Class = v.ValidateDNSResult(workerCtx, domain)
+			}
+			results <- result
+			return true
+		})
+	}()
+	return results
+}
+
+// runBatchWorkers runs up to BatchWorkers (DefaultBatchWorkers when unset) workers, but
+// no more than limit, each with its own batchConns, calling check until it returns false.
+// check gets ctx and the worker's context for lookups.
+func (v *Validator) runBatchWorkers(ctx context.Context, limit int, check func(ctx, workerCtx context.Context) bool) {
+	workers := v.BatchWorkers
+	if workers <= 0 {
+		workers = DefaultBatchWorkers
+	}
+	workers = min(workers, limit)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conns := newBatchConns()
+			defer conns.close()
+			workerCtx := context.WithValue(ctx, batchConnsKey{}, conns)
+			for check(ctx, workerCtx) {
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,174 @@
+package validator
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// startResolver runs a local DNS server on a free UDP port that answers A queries under
+// example.com and NXDOMAIN for everything else, and returns its address. Under
+// example.net the A query gets an empty answer (NODATA), and the other types a
+// behaviour picked by the first label: "timeout" never answers, "servfail" gets SERVFAIL
+// and anything else NODATA too.
+func startResolver(tb testing.TB) string {
+	tb.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatalf("listen: %v", err)
+	}
+
+	started := make(chan struct{})
+	server := &dns.Server{
+		PacketConn:        conn,
+		NotifyStartedFunc: func() { close(started) },
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			m := new(dns.Msg)
+			m.SetReply(r)
+			m.RecursionAvailable = true // without it Go's resolver takes NODATA for a lame referral
+			q := r.Question[0]
+			switch {
+			case strings.HasSuffix(q.Name, ".example.net.") && q.Qtype != dns.TypeA:
+				switch strings.SplitN(q.Name, ".", 2)[0] {
+				case "timeout":
+					return
+				case "servfail":
+					m.Rcode = dns.RcodeServerFailure
+				}
+			case strings.HasSuffix(q.Name, ".example.net."):
+			case !strings.HasSuffix(q.Name, "example.com."):
+				m.Rcode = dns.RcodeNameError
+			case q.Qtype == dns.TypeA:
+				m.Answer = append(m.Answer, &dns.A{
+					Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+					A:   net.IPv4(192, 0, 2, 1),
+				})
+			}
+			w.WriteMsg(m)
+		}),
+	}
+	go server.ActivateAndServe()
+	<-started
+	tb.Cleanup(func() { server.Shutdown() })
+	return conn.LocalAddr().String()
+}
+
+// batchDomains returns n names, every other one resolving on startResolver
+func batchDomains(n int) []string {
+	domains := make([]string, n)
+	for i := range domains {
+		if i%2 == 0 {
+			domains[i] = fmt.Sprintf("host%d.example.com", i)
+		} else {
+			domains[i] = fmt.Sprintf("host%d.example.org", i)
+		}
+	}
+	return domains
+}
+
+func TestValidateBatchMatchesValidateDNS(t *testing.T) {
+	v := NewValidatorWithResolvers(false, []string{startResolver(t)})
+	v.BatchWorkers = 8
+	domains := batchDomains(200)
+
+	valid, class := v.ValidateBatchResult(context.Background(), domains)
+	for i, domain := range domains {
+		want, wantClass := v.ValidateDNSResult(context.Background(), domain)
+		if valid[i] != want || class[i] != wantClass {
+			t.Errorf("%s: batch = %v (%s), per-domain = %v (%s)", domain, valid[i], class[i], want, wantClass)
+		}
+	}
+}
+
+func TestNoDataDoesNotHideInconclusiveLookups(t *testing.T) {
+	addr := startResolver(t)
+	tests := []struct {
+		domain string
+		want   DNSErrorClass
+	}{
+		{"timeout.example.net", DNSTimeout},
+		{"servfail.example.net", DNSServFail},
+		{"empty.example.net", DNSNotFound},
+		{"gone.example.org", DNSNotFound},
+	}
+
+	paths := []struct {
+		name  string
+		check func(v *Validator, domain string) (bool, DNSErrorClass)
+	}{
+		{"per-domain", func(v *Validator, domain string) (bool, DNSErrorClass) {
+			return v.ValidateDNSResult(context.Background(), domain)
+		}},
+		{"ttl-aware", func(v *Validator, domain string) (bool, DNSErrorClass) {
+			v.TTLAware = true
+			return v.ValidateDNSResult(context.Background(), domain)
+		}},
+		{"batch", func(v *Validator, domain string) (bool, DNSErrorClass) {
+			valid, class := v.ValidateBatchResult(context.Background(), []string{domain})
+			return valid[0], class[0]
+		}},
+	}
+
+	for _, path := range paths {
+		for _, tt := range tests {
+			t.Run(path.name+"/"+tt.domain, func(t *testing.T) {
+				v := NewValidatorWithResolvers(true, []string{addr})
+				valid, class := path.check(v, tt.domain)
+				if valid || class != tt.want {
+					t.Errorf("got %v (%s), want false (%s)", valid, class, tt.want)
+				}
+				if _, cached := v.cache[tt.domain]; cached != (tt.want == DNSNotFound) {
+					t.Errorf("cached = %v, want %v", cached, tt.want == DNSNotFound)
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkValidateBatch compares ValidateBatch with the per-domain ValidateDNS path at
+// the same concurrency, against a local resolver
+func BenchmarkValidateBatch(b *testing.B) {
+	const workers = 50
+	addr := startResolver(b)
+	domains := batchDomains(1000)
+
+	b.Run("ValidateDNS", func(b *testing.B) {
+		v := NewValidatorWithResolvers(false, []string{addr})
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var (
+				next atomic.Int64
+				wg   sync.WaitGroup
+			)
+			for range workers {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for {
+						idx := int(next.Add(1) - 1)
+						if idx >= len(domains) {
+							return
+						}
+						v.ValidateDNS(context.Background(), domains[idx])
+					}
+				}()
+			}
+			wg.Wait()
+		}
+	})
+
+	b.Run("ValidateBatch", func(b *testing.B) {
+		v := NewValidatorWithResolvers(false, []string{addr})
+		v.BatchWorkers = workers
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			v.ValidateBatch(context.Background(), domains)
+		}
+	})
+}
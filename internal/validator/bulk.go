@@ -0,0 +1,248 @@
+package validator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pigeonsec/magpie/internal/netutil"
+)
+
+// DNSBackend answers whether a domain resolves. The default, used when Validator.Backend
+// is nil, queries the configured resolvers one domain at a time.
+type DNSBackend interface {
+	Lookup(ctx context.Context, domain string) (bool, DNSErrorClass)
+}
+
+const (
+	// DefaultBulkBatchSize is how many domains go into one bulk request by default
+	DefaultBulkBatchSize = 500
+	// bulkLinger is how long a partial batch waits for more domains before it's sent
+	bulkLinger = 50 * time.Millisecond
+	// bulkRequestTimeout bounds one bulk HTTP request
+	bulkRequestTimeout = 30 * time.Second
+	// bulkMaxInFlight bounds concurrent bulk requests
+	bulkMaxInFlight = 4
+)
+
+// BulkBackend resolves domains through an HTTP bulk-resolution endpoint. Concurrent
+// Lookup calls are collected into batches of up to BatchSize domains (or whatever
+// arrives within a short linger), sent as one POST, and each caller gets its own answer.
+//
+// The endpoint receives {"domains": ["a.com", ...]} and must answer with
+// {"results": [{"domain": "a.com", "rcode": "NOERROR", "answers": 1}, ...]}.
+// A domain resolves when its rcode is NOERROR with at least one answer.
+//
+// Failures never mark domains dead: if a batch can't be resolved (network error, bad
+// status, malformed response) or a domain is missing from the response, those domains
+// are reported as SERVFAIL, which callers treat as inconclusive.
+type BulkBackend struct {
+	Endpoint  string
+	BatchSize int
+
+	client   *http.Client
+	inFlight chan struct{}
+
+	mu      sync.Mutex
+	pending []*bulkLookup
+	timer   *time.Timer
+}
+
+// bulkLookup is one caller waiting for its domain's answer
+type bulkLookup struct {
+	domain string
+	done   chan bulkAnswer
+}
+
+type bulkAnswer struct {
+	valid bool
+	class DNSErrorClass
+}
+
+// bulkResult is one domain's entry in the endpoint's response
+type bulkResult struct {
+	Domain  string `json:"domain"`
+	Rcode   string `json:"rcode"`
+	Answers int    `json:"answers"`
+}
+
+// NewBulkBackend creates a bulk backend for endpoint. batchSize <= 0 uses DefaultBulkBatchSize.
+func NewBulkBackend(endpoint string, batchSize int) *BulkBackend {
+	if batchSize <= 0 {
+		batchSize = DefaultBulkBatchSize
+	}
+	return &BulkBackend{
+		Endpoint:  endpoint,
+		BatchSize: batchSize,
+		client: &http.Client{
+			Timeout:   bulkRequestTimeout,
+			Transport: &http.Transport{Proxy: netutil.ProxyFromEnvironment, ForceAttemptHTTP2: true},
+		},
+		inFlight: make(chan struct{}, bulkMaxInFlight),
+	}
+}
+
+// Lookup queues the domain for the next batch and waits for its answer
+func (b *BulkBackend) Lookup(ctx context.Context, domain string) (bool, DNSErrorClass) {
+	lookup := &bulkLookup{domain: domain, done: make(chan bulkAnswer, 1)}
+
+	b.mu.Lock()
+	b.pending = append(b.pending, lookup)
+	if len(b.pending) >= b.BatchSize {
+		go b.send(b.takeLocked())
+	} else if len(b.pending) == 1 {
+		b.timer = time.AfterFunc(bulkLinger, b.flush)
+	}
+	b.mu.Unlock()
+
+	select {
+	case answer := <-lookup.done:
+		return answer.valid, answer.class
+	case <-ctx.Done():
+		return false, DNSTimeout
+	}
+}
+
+// flush sends whatever is pending; called when the linger timer fires
+func (b *BulkBackend) flush() {
+	b.mu.Lock()
+	batch := b.takeLocked()
+	b.mu.Unlock()
+
+	if len(batch) > 0 {
+		b.send(batch)
+	}
+}
+
+// takeLocked removes and returns the pending batch. b.mu must be held.
+func (b *BulkBackend) takeLocked() []*bulkLookup {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	batch := b.pending
+	b.pending = nil
+	return batch
+}
+
+// send resolves a batch and answers every lookup in it
+func (b *BulkBackend) send(batch []*bulkLookup) {
+	b.inFlight <- struct{}{}
+	defer func() { <-b.inFlight }()
+
+	domains := make([]string, len(batch))
+	for i, lookup := range batch {
+		domains[i] = lookup.domain
+	}
+
+	results, err := b.resolveBatch(domains)
+	for _, lookup := range batch {
+		answer := bulkAnswer{class: DNSServFail}
+		if err == nil {
+			if result, ok := results[strings.ToLower(lookup.domain)]; ok {
+				answer = bulkAnswerFor(result)
+			}
+		}
+		lookup.done <- answer
+	}
+}
+
+// resolveBatch posts domains to the endpoint, retrying a failed request once. A batch the
+// endpoint rejects as too large is split in half and each half is resolved separately.
+func (b *BulkBackend) resolveBatch(domains []string) (map[string]bulkResult, error) {
+	results, status, err := b.post(domains)
+	if err == nil {
+		return results, nil
+	}
+
+	if status == http.StatusRequestEntityTooLarge && len(domains) > 1 {
+		mid := len(domains) / 2
+		first, err := b.resolveBatch(domains[:mid])
+		if err != nil {
+			return nil, err
+		}
+		second, err := b.resolveBatch(domains[mid:])
+		if err != nil {
+			return nil, err
+		}
+		for domain, result := range second {
+			first[domain] = result
+		}
+		return first, nil
+	}
+
+	// Client errors other than 413 won't get better on retry
+	if status >= 400 && status < 500 {
+		return nil, err
+	}
+	results, _, err = b.post(domains)
+	return results, err
+}
+
+// post sends one bulk request and returns the results keyed by lower-case domain, plus
+// the HTTP status (0 if the request didn't get that far)
+func (b *BulkBackend) post(domains []string) (map[string]bulkResult, int, error) {
+	body, err := json.Marshal(struct {
+		Domains []string `json:"domains"`
+	}{Domains: domains})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, b.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Magpie/1.0")
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil, resp.StatusCode, fmt.Errorf("bulk resolver: HTTP %d", resp.StatusCode)
+	}
+
+	var decoded struct {
+		Results []bulkResult `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return nil, resp.StatusCode, fmt.Errorf("bulk resolver: invalid response: %w", err)
+	}
+
+	results := make(map[string]bulkResult, len(decoded.Results))
+	for _, result := range decoded.Results {
+		results[strings.ToLower(strings.TrimSuffix(result.Domain, "."))] = result
+	}
+	return results, resp.StatusCode, nil
+}
+
+// bulkAnswerFor maps an endpoint result onto the validator's view of it
+func bulkAnswerFor(result bulkResult) bulkAnswer {
+	switch strings.ToUpper(result.Rcode) {
+	case "NOERROR":
+		if result.Answers > 0 {
+			return bulkAnswer{valid: true, class: DNSNoError}
+		}
+		// NODATA: the name exists without address records
+		return bulkAnswer{class: DNSNotFound}
+	case "NXDOMAIN":
+		return bulkAnswer{class: DNSNotFound}
+	case "SERVFAIL", "REFUSED":
+		return bulkAnswer{class: DNSServFail}
+	case "TIMEOUT":
+		return bulkAnswer{class: DNSTimeout}
+	default:
+		return bulkAnswer{class: DNSOtherError}
+	}
+}
@@ -0,0 +1,90 @@
+package validator
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+)
+
+// LoadCache reads DNS results saved by SaveCache into the cache, dropping entries
+// whose TTL has run out. A missing file is not an error. Returns the number of
+// entries loaded.
+func (v *Validator) LoadCache(path string) (int, error) {
+	if !v.useCache {
+		return 0, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	var entries map[string]cacheFileEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return 0, err
+	}
+
+	// Insert oldest first so a cap keeps the freshest entries
+	now := time.Now()
+	domains := make([]string, 0, len(entries))
+	for domain, e := range entries {
+		if now.Sub(e.Timestamp) < e.TTL {
+			domains = append(domains, domain)
+		}
+	}
+	sort.Slice(domains, func(i, j int) bool {
+		return entries[domains[i]].Timestamp.Before(entries[domains[j]].Timestamp)
+	})
+
+	v.cacheMu.Lock()
+	defer v.cacheMu.Unlock()
+	for _, domain := range domains {
+		e := entries[domain]
+		v.storeLocked(domain, &dnsResult{
+			valid:     e.Valid,
+			class:     e.Class,
+			timestamp: e.Timestamp,
+			ttl:       e.TTL,
+		})
+	}
+	return len(v.cache), nil
+}
+
+// SaveCache writes the unexpired DNS results to path as JSON, for LoadCache on the
+// next run. It is safe to call while lookups are still running.
+func (v *Validator) SaveCache(path string) error {
+	if !v.useCache {
+		return nil
+	}
+
+	now := time.Now()
+	v.cacheMu.RLock()
+	entries := make(map[string]cacheFileEntry, len(v.cache))
+	for domain, r := range v.cache {
+		if now.Sub(r.timestamp) >= r.ttl {
+			continue
+		}
+		entries[domain] = cacheFileEntry{
+			Valid:     r.valid,
+			Class:     r.class,
+			Timestamp: r.timestamp,
+			TTL:       r.ttl,
+		}
+	}
+	v.cacheMu.RUnlock()
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,93 @@
+package validator
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// ValidateMX checks if domain has at least one MX record, with caching parallel to the
+// A/AAAA/CNAME cache
+func (v *Validator) ValidateMX(ctx context.Context, domain string) (bool, error) {
+	valid, _ := v.ValidateMXResult(ctx, domain)
+	return valid, nil
+}
+
+// ValidateMXResult is ValidateMX that also reports why a domain without MX failed. A
+// null MX (RFC 7505, a single "." host) declares that the domain takes no mail and
+// counts as none. MX lookups always use the resolvers, even when Backend is set.
+func (v *Validator) ValidateMXResult(ctx context.Context, domain string) (bool, DNSErrorClass) {
+	if v.useCache {
+		v.cacheMu.RLock()
+		if cached, ok := v.mxCache[domain]; ok && time.Since(cached.timestamp) < cached.ttl {
+			v.cacheMu.RUnlock()
+			v.tracef(ctx, "mx %s: cached result (%s)", domain, cached.class)
+			return cached.valid, cached.class
+		}
+		v.cacheMu.RUnlock()
+	}
+
+	idx := v.resolverIndex(domain)
+	valid, class := v.lookupMX(ctx, idx, domain)
+	for attempt, retries := 1, v.retriesFor(class); !valid && attempt <= retries && ctx.Err() == nil; attempt++ {
+		idx = (idx + 1) % len(v.resolvers)
+		v.tracef(ctx, "mx %s: %s, retrying on %s (%d/%d)", domain, class, v.serverName(idx), attempt, retries)
+		valid, class = v.lookupMX(ctx, idx, domain)
+		if !class.Inconclusive() {
+			break
+		}
+	}
+
+	if v.useCache && cacheable(valid, class) {
+		v.cacheMu.Lock()
+		// Evicting in insertion order is left to the address cache; a full MX cache
+		// just stops growing
+		if v.MaxCacheEntries <= 0 || len(v.mxCache) < v.MaxCacheEntries {
+			v.mxCache[domain] = &dnsResult{
+				valid:     valid,
+				class:     class,
+				timestamp: time.Now(),
+				ttl:       v.cacheTTL,
+			}
+		}
+		v.cacheMu.Unlock()
+	}
+
+	return valid, class
+}
+
+// lookupMX asks resolver idx for the MX records of a domain
+func (v *Validator) lookupMX(ctx context.Context, idx int, domain string) (bool, DNSErrorClass) {
+	lookupCtx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
+	records, err := v.resolvers[idx].LookupMX(lookupCtx, domain)
+	if err != nil {
+		class := ClassifyDNSError(err)
+		v.tracef(ctx, "mx %s @%s: %s (%v)", domain, v.serverName(idx), class, err)
+		return false, class
+	}
+
+	for _, mx := range records {
+		if mx.Host != "." && mx.Host != "" {
+			v.tracef(ctx, "mx %s @%s: %s", domain, v.serverName(idx), mxHosts(records))
+			return true, DNSNoError
+		}
+	}
+	v.tracef(ctx, "mx %s @%s: no mail exchangers (%s)", domain, v.serverName(idx), mxHosts(records))
+	return false, DNSNotFound
+}
+
+// mxHosts formats MX records for traces
+func mxHosts(records []*net.MX) string {
+	if len(records) == 0 {
+		return "none"
+	}
+	hosts := make([]string, len(records))
+	for i, mx := range records {
+		hosts[i] = fmt.Sprintf("%d:%s", mx.Pref, mx.Host)
+	}
+	return strings.Join(hosts, " ")
+}
@@ -0,0 +1,95 @@
+package validator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// RecordSet is the set of DNS record types that prove a domain resolves (see
+// Validator.Records)
+type RecordSet uint8
+
+const (
+	RecordA RecordSet = 1 << iota
+	RecordAAAA
+	RecordCNAME
+
+	// AllRecords accepts a domain with any A, AAAA or CNAME record, the default
+	AllRecords = RecordA | RecordAAAA | RecordCNAME
+)
+
+// RecordNames are the record types ParseRecordSet accepts, in the order String lists them
+var RecordNames = []string{"a", "aaaa", "cname"}
+
+// ParseRecordSet parses a comma-separated list of record types ("a,aaaa", "a")
+func ParseRecordSet(list string) (RecordSet, error) {
+	var set RecordSet
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		found := false
+		for i, known := range RecordNames {
+			if name == known {
+				set |= 1 << i
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown record type %q (use %s)", name, strings.Join(RecordNames, ", "))
+		}
+	}
+	if set == 0 {
+		return 0, fmt.Errorf("no record types given")
+	}
+	return set, nil
+}
+
+func (s RecordSet) String() string {
+	var names []string
+	for i, name := range RecordNames {
+		if s&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// records returns the record types the validator accepts
+func (v *Validator) records() RecordSet {
+	if v.Records == 0 {
+		return AllRecords
+	}
+	return v.Records
+}
+
+// queryTypes appends the types to query a name for over dst. A CNAME comes back in the
+// answer to an A or AAAA query, so it only gets a query of its own when neither is asked.
+func (s RecordSet) queryTypes(dst []uint16) []uint16 {
+	if s&RecordA != 0 {
+		dst = append(dst, dns.TypeA)
+	}
+	if s&RecordAAAA != 0 {
+		dst = append(dst, dns.TypeAAAA)
+	}
+	if len(dst) == 0 && s&RecordCNAME != 0 {
+		dst = append(dst, dns.TypeCNAME)
+	}
+	return dst
+}
+
+// accepts reports whether an answer record of type rrtype is in the set
+func (s RecordSet) accepts(rrtype uint16) bool {
+	switch rrtype {
+	case dns.TypeA:
+		return s&RecordA != 0
+	case dns.TypeAAAA:
+		return s&RecordAAAA != 0
+	case dns.TypeCNAME:
+		return s&RecordCNAME != 0
+	}
+	return false
+}
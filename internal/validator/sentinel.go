@@ -0,0 +1,69 @@
+package validator
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// DefaultIgnoreIPs are the addresses blocking and misconfigured resolvers answer with
+// for names they won't resolve: the unspecified and loopback addresses
+var DefaultIgnoreIPs = []string{"0.0.0.0", "127.0.0.1", "::", "::1"}
+
+// NewIPSet builds an IgnoreIPs set from a list of addresses, ignoring blanks
+func NewIPSet(ips []string) (map[netip.Addr]struct{}, error) {
+	set := make(map[netip.Addr]struct{}, len(ips))
+	for _, ip := range ips {
+		ip = strings.TrimSpace(ip)
+		if ip == "" {
+			continue
+		}
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP address %q", ip)
+		}
+		set[addr.Unmap()] = struct{}{}
+	}
+	return set, nil
+}
+
+// ignored reports whether ip is one of the IgnoreIPs addresses
+func ignored(set map[netip.Addr]struct{}, ip net.IP) bool {
+	if len(set) == 0 {
+		return false
+	}
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+	_, ok = set[addr.Unmap()]
+	return ok
+}
+
+// onlyIgnored reports whether ips holds addresses and all of them are IgnoreIPs ones, so
+// the answer is a resolver's block page rather than proof the name exists
+func (v *Validator) onlyIgnored(ips []net.IP) bool {
+	if len(v.IgnoreIPs) == 0 || len(ips) == 0 {
+		return false
+	}
+	for _, ip := range ips {
+		if !ignored(v.IgnoreIPs, ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// ignoredRR reports whether rr is an A or AAAA record for one of the IgnoreIPs addresses
+func ignoredRR(set map[netip.Addr]struct{}, rr dns.RR) bool {
+	switch rr := rr.(type) {
+	case *dns.A:
+		return ignored(set, rr.A)
+	case *dns.AAAA:
+		return ignored(set, rr.AAAA)
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package validator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultAcceptStatus is the HTTP check's acceptance rule when none is set: any response
+// below 500 means something is serving the domain
+func DefaultAcceptStatus(status int) bool {
+	return status < 500
+}
+
+// statusRange is an inclusive range of HTTP status codes
+type statusRange struct{ lo, hi int }
+
+// ParseStatusRule parses a comma-separated list of status codes ("204"), classes ("2xx")
+// and ranges ("200-399") into an acceptance rule for Validator.AcceptStatus. A status is
+// accepted when any entry matches it.
+func ParseStatusRule(spec string) (func(status int) bool, error) {
+	var ranges []statusRange
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part == "" {
+			continue
+		}
+		r, err := parseStatusRange(part)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, r)
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("no status codes in %q", spec)
+	}
+
+	return func(status int) bool {
+		for _, r := range ranges {
+			if status >= r.lo && status <= r.hi {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// parseStatusRange parses one entry of a status rule
+func parseStatusRange(part string) (statusRange, error) {
+	if len(part) == 3 && strings.HasSuffix(part, "xx") && part[0] >= '1' && part[0] <= '5' {
+		lo := int(part[0]-'0') * 100
+		return statusRange{lo, lo + 99}, nil
+	}
+
+	loText, hiText, isRange := strings.Cut(part, "-")
+	if !isRange {
+		hiText = loText
+	}
+	lo, errLo := strconv.Atoi(loText)
+	hi, errHi := strconv.Atoi(hiText)
+	if errLo != nil || errHi != nil || lo < 100 || hi > 599 || lo > hi {
+		return statusRange{}, fmt.Errorf("invalid status %q (use codes like 204, classes like 2xx or ranges like 200-399)", part)
+	}
+	return statusRange{lo, hi}, nil
+}
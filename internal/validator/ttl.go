@@ -0,0 +1,136 @@
+package validator
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ttlUnknown marks a lookup that didn't report a TTL; the fixed cache TTL applies
+const ttlUnknown time.Duration = -1
+
+// lookupDomainTTL queries the Records types directly on a DNS server and reports
+// the lowest TTL in the answer (a CNAME chain counts as valid unless Records leaves
+// CNAME out). Negative answers carry the SOA negative-caching TTL (RFC 2308).
+func (v *Validator) lookupDomainTTL(ctx context.Context, server, domain string, timeout time.Duration) (bool, DNSErrorClass, time.Duration) {
+	lookupCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type lookupResult struct {
+		qtype    uint16
+		valid    bool
+		class    DNSErrorClass
+		ttl      time.Duration
+		nxdomain bool
+	}
+
+	records := v.records()
+	qtypes := records.queryTypes(make([]uint16, 0, 2))
+	results := make(chan lookupResult, len(qtypes))
+	for _, qtype := range qtypes {
+		go func(qtype uint16) {
+			valid, class, ttl, nxdomain := exchangeTTL(lookupCtx, server, domain, qtype, records, v.IgnoreIPs)
+			results <- lookupResult{qtype: qtype, valid: valid, class: class, ttl: ttl, nxdomain: nxdomain}
+		}(qtype)
+	}
+
+	// Early exit on the first positive answer, like lookupDomain
+	var failures lookupFailures
+	ttl := ttlUnknown
+	for range qtypes {
+		result := <-results
+		if result.ttl != ttlUnknown {
+			v.tracef(ctx, "dns %s %s @%s: %s (ttl %v)", domain, dns.TypeToString[result.qtype], server, result.class, result.ttl)
+		} else {
+			v.tracef(ctx, "dns %s %s @%s: %s", domain, dns.TypeToString[result.qtype], server, result.class)
+		}
+		if result.valid {
+			return true, DNSNoError, result.ttl
+		}
+		failures.add(result.class, result.nxdomain)
+		if result.ttl != ttlUnknown && (ttl == ttlUnknown || result.ttl < ttl) {
+			ttl = result.ttl
+		}
+	}
+
+	return false, failures.result(), ttl
+}
+
+// exchangeTTL sends one query and returns whether it matched, the answer's TTL and
+// whether the name doesn't exist at all (NXDOMAIN)
+func exchangeTTL(ctx context.Context, server, domain string, qtype uint16, records RecordSet, ignore map[netip.Addr]struct{}) (bool, DNSErrorClass, time.Duration, bool) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(domain), qtype)
+	msg.RecursionDesired = true
+
+	client := &dns.Client{Net: "udp"}
+	resp, _, err := client.ExchangeContext(ctx, msg, server)
+	if err != nil {
+		return false, exchangeErrorClass(err), ttlUnknown, false
+	}
+	valid, class, ttl := answerClass(resp, records, ignore)
+	return valid, class, ttl, resp.Rcode == dns.RcodeNameError
+}
+
+// exchangeErrorClass classifies a failed query: a timeout, or another error
+func exchangeErrorClass(err error) DNSErrorClass {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return DNSTimeout
+	}
+	return DNSOtherError
+}
+
+// answerClass reads a response: whether it holds a record of an accepted type (and for
+// A and AAAA, an address not in ignore), the failure class otherwise, and the TTL to
+// cache it for
+func answerClass(resp *dns.Msg, records RecordSet, ignore map[netip.Addr]struct{}) (bool, DNSErrorClass, time.Duration) {
+	switch resp.Rcode {
+	case dns.RcodeSuccess:
+	case dns.RcodeNameError:
+		return false, DNSNotFound, negativeTTL(resp)
+	case dns.RcodeServerFailure:
+		return false, DNSServFail, ttlUnknown
+	default:
+		return false, DNSOtherError, ttlUnknown
+	}
+
+	ttl := ttlUnknown
+	valid := false
+	for _, rr := range resp.Answer {
+		switch rrtype := rr.Header().Rrtype; rrtype {
+		case dns.TypeA, dns.TypeAAAA, dns.TypeCNAME:
+			// The whole chain bounds the TTL, accepted type or not
+			valid = valid || (records.accepts(rrtype) && !ignoredRR(ignore, rr))
+			if rrTTL := time.Duration(rr.Header().Ttl) * time.Second; ttl == ttlUnknown || rrTTL < ttl {
+				ttl = rrTTL
+			}
+		}
+	}
+
+	if !valid {
+		// NODATA: the name exists without an accepted record type, or only points at
+		// ignored addresses
+		return false, DNSNotFound, negativeTTL(resp)
+	}
+	return true, DNSNoError, ttl
+}
+
+// negativeTTL returns how long a negative answer may be cached: the lower of the
+// SOA record's TTL and its MINIMUM field
+func negativeTTL(resp *dns.Msg) time.Duration {
+	for _, rr := range resp.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			ttl := soa.Hdr.Ttl
+			if soa.Minttl < ttl {
+				ttl = soa.Minttl
+			}
+			return time.Duration(ttl) * time.Second
+		}
+	}
+	return ttlUnknown
+}
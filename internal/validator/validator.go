@@ -3,30 +3,114 @@ package validator
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
+	"math"
+	"math/bits"
 	"net"
 	"net/http"
+	"net/netip"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/pigeonsec/magpie/internal/netutil"
+)
+
+const (
+	// lookupTimeout bounds the parallel lookups for one domain
+	lookupTimeout = 500 * time.Millisecond
+	// recheckTimeout is the more patient timeout used by RecheckDNS
+	recheckTimeout = 2 * time.Second
+
+	// DefaultMaxCacheEntries bounds the DNS cache unless MaxCacheEntries is changed
+	DefaultMaxCacheEntries = 500000
 )
 
 // dnsResult caches DNS lookup results
 type dnsResult struct {
 	valid     bool
+	class     DNSErrorClass // why an invalid lookup failed
 	timestamp time.Time
+	ttl       time.Duration // how long the entry stays valid
 }
 
 // Validator validates domains via DNS and HTTP
 type Validator struct {
 	resolvers  []*net.Resolver
+	servers    []string // resolver addresses, parallel to resolvers (empty for the system resolver)
 	httpClient *http.Client
 	cache      map[string]*dnsResult
+	mxCache    map[string]*dnsResult // ValidateMX results, sharing cacheMu and cacheTTL
 	cacheMu    sync.RWMutex
 	cacheTTL   time.Duration
 	useCache   bool
 	nextResolver uint32  // atomic counter for round-robin
+
+	// MaxCacheEntries caps the DNS cache; the oldest entries are evicted first (0 = unlimited)
+	MaxCacheEntries int
+	cacheOrder      []cacheKey // insertion order of cache entries, oldest first
+
+	// RetryServFail re-asks a different resolver when a lookup fails with SERVFAIL
+	RetryServFail bool
+
+	// Retries re-asks the following resolvers up to this many times when a lookup times
+	// out or fails with SERVFAIL, before the domain is given a verdict
+	Retries int
+
+	// HashResolvers picks the resolver for a name by hashing it instead of round-robin,
+	// so a given domain is always asked on the same server (see ResolverStrategies)
+	HashResolvers bool
+
+	// Backend replaces the per-domain resolver lookups when set (see BulkBackend).
+	// Caching and the www. strict mode still apply.
+	Backend DNSBackend
+
+	// TTLAware caches each result for the record's real DNS TTL, capped at MaxCacheTTL,
+	// instead of the fixed cache TTL. Needs custom resolvers.
+	TTLAware    bool
+	MaxCacheTTL time.Duration
+
+	// Records are the record types that make a domain valid in ValidateDNS; only their
+	// lookups are made (0 = AllRecords). The Backend isn't affected.
+	Records RecordSet
+
+	// IgnoreIPs are addresses that don't count as an answer (see DefaultIgnoreIPs): a
+	// domain that resolves to nothing else is invalid. A CNAME still counts, and so does
+	// whatever the Backend reports.
+	IgnoreIPs map[netip.Addr]struct{}
+
+	// RequireApexAndWWW only accepts a domain when both it and its www. variant resolve
+	RequireApexAndWWW bool
+
+	// DeadTLDs holds TLDs that can never resolve; domains under them fail without a lookup
+	DeadTLDs map[string]struct{}
+
+	// AcceptStatus decides which HTTP status codes count as reachable in ValidateHTTP;
+	// nil uses DefaultAcceptStatus. See ParseStatusRule.
+	AcceptStatus func(status int) bool
+
+	// httpSem bounds concurrent HTTP checks when set (see SetHTTPConcurrency)
+	httpSem chan struct{}
+
+	// DetectWildcards probes uncommon TLDs for wildcard DNS (see IsWildcardTLD)
+	DetectWildcards bool
+	wildcardMu      sync.Mutex
+	wildcardTLDs    map[string]*wildcardProbe
+
+	// DetectParentWildcards probes the parents of subdomains for wildcard DNS (see IsWildcardSubdomain)
+	DetectParentWildcards bool
+	parentProbes          map[string]*parentProbe
+
+	// BatchWorkers is the number of domains ValidateBatch checks at once (0 = DefaultBatchWorkers)
+	BatchWorkers int
+
+	// Trace, when set, receives a line for every lookup and check the validator makes.
+	// It may be called from several goroutines. Meant for debugging single domains.
+	Trace func(format string, args ...interface{})
 }
 
 // NewValidator creates a new validator with system DNS resolver and optional caching
@@ -44,6 +128,7 @@ func NewValidatorWithResolvers(enableCache bool, dnsServers []string) *Validator
 		MaxConnsPerHost:     100,               // Limit connections per host
 		IdleConnTimeout:     90 * time.Second,  // Keep connections alive longer
 		TLSHandshakeTimeout: 5 * time.Second,   // Faster TLS timeout
+		Proxy:               netutil.ProxyFromEnvironment, // HTTP(S)_PROXY / ALL_PROXY
 		DisableCompression:  true,              // We don't need compression for HEAD requests
 		DisableKeepAlives:   false,             // Keep connections alive
 		ForceAttemptHTTP2:   true,              // Use HTTP/2 when possible
@@ -60,6 +145,7 @@ func NewValidatorWithResolvers(enableCache bool, dnsServers []string) *Validator
 
 	// Create multiple resolvers (one per DNS server)
 	var resolvers []*net.Resolver
+	var servers []string
 
 	if len(dnsServers) == 0 {
 		// Use system DNS resolver
@@ -82,6 +168,7 @@ func NewValidatorWithResolvers(enableCache bool, dnsServers []string) *Validator
 				continue
 			}
 			serverAddr := server
+			servers = append(servers, serverAddr)
 			resolvers = append(resolvers, &net.Resolver{
 				PreferGo: true,
 				Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
@@ -98,6 +185,7 @@ func NewValidatorWithResolvers(enableCache bool, dnsServers []string) *Validator
 
 	return &Validator{
 		resolvers: resolvers,
+		servers:   servers,
 		httpClient: &http.Client{
 			Timeout:   8 * time.Second,
 			Transport: transport,
@@ -109,10 +197,33 @@ func NewValidatorWithResolvers(enableCache bool, dnsServers []string) *Validator
 			},
 		},
 		cache:    make(map[string]*dnsResult, 100000),
+		mxCache:  make(map[string]*dnsResult),
 		cacheTTL: 5 * time.Minute,
 		useCache: enableCache,
 		nextResolver: 0,
+		MaxCacheEntries: DefaultMaxCacheEntries,
+	}
+}
+
+// autoLookupSeconds is the assumption behind AutoWorkers that a public resolver answers
+// in about 50ms
+const autoLookupSeconds = 0.05
+
+// AutoWorkers returns a validation worker count that keeps each of resolvers resolvers
+// near qps queries per second. Every worker has one lookup per type in records (0 =
+// AllRecords) in flight for about autoLookupSeconds, so
+//
+//	workers = resolvers × qps × autoLookupSeconds / lookups per domain
+//
+// rounded up, and at least one worker per resolver.
+func AutoWorkers(resolvers int, qps float64, records RecordSet) int {
+	resolvers = max(resolvers, 1)
+	if records == 0 {
+		records = AllRecords
 	}
+	queries := float64(bits.OnesCount8(uint8(records)))
+	workers := int(math.Ceil(float64(resolvers) * qps * autoLookupSeconds / queries))
+	return max(workers, resolvers)
 }
 
 // getResolver returns a resolver using round-robin selection
@@ -120,87 +231,415 @@ func (v *Validator) getResolver() *net.Resolver {
 	if len(v.resolvers) == 1 {
 		return v.resolvers[0]
 	}
-	idx := atomic.AddUint32(&v.nextResolver, 1) % uint32(len(v.resolvers))
-	return v.resolvers[idx]
+	return v.resolvers[atomic.AddUint32(&v.nextResolver, 1)%uint32(len(v.resolvers))]
+}
+
+// traceKey carries the per-check trace set by WithTrace
+type traceKey struct{}
+
+// WithTrace returns a context whose checks also report to trace, on top of Validator.Trace.
+// Unlike Trace it only sees the lookups made with that context, so concurrent domains can
+// each be traced on their own.
+func WithTrace(ctx context.Context, trace func(format string, args ...interface{})) context.Context {
+	return context.WithValue(ctx, traceKey{}, trace)
+}
+
+// tracing reports whether anything receives the traces of ctx
+func (v *Validator) tracing(ctx context.Context) bool {
+	return v.Trace != nil || ctx.Value(traceKey{}) != nil
+}
+
+// tracef reports a validation step to Trace and to the trace of ctx, if any
+func (v *Validator) tracef(ctx context.Context, format string, args ...interface{}) {
+	if v.Trace != nil {
+		v.Trace(format, args...)
+	}
+	if trace, ok := ctx.Value(traceKey{}).(func(format string, args ...interface{})); ok {
+		trace(format, args...)
+	}
 }
 
-// ValidateDNS checks if domain has A, AAAA, or CNAME records (with caching and parallel lookups)
+// serverName names resolver idx for traces
+func (v *Validator) serverName(idx int) string {
+	if idx < len(v.servers) {
+		return v.servers[idx]
+	}
+	return "system resolver"
+}
+
+// ResolverStrategies are the ways a resolver is picked for each lookup: roundrobin
+// spreads lookups evenly, hash (HashResolvers) sends each name to the same resolver
+var ResolverStrategies = []string{"roundrobin", "hash"}
+
+// resolverIndex returns the index of the resolver to ask about name: the next one in
+// round-robin order, or the one its hash picks with HashResolvers
+func (v *Validator) resolverIndex(name string) int {
+	if len(v.resolvers) == 1 {
+		return 0
+	}
+	if v.HashResolvers {
+		h := fnv.New32a()
+		h.Write([]byte(strings.ToLower(name)))
+		return int(h.Sum32() % uint32(len(v.resolvers)))
+	}
+	return int(atomic.AddUint32(&v.nextResolver, 1) % uint32(len(v.resolvers)))
+}
+
+// DNSErrorClass categorizes lookup failures so resolver problems aren't mistaken for dead domains
+type DNSErrorClass int
+
+const (
+	DNSNoError    DNSErrorClass = iota
+	DNSNotFound                 // NXDOMAIN, or none of the checked record types - definitive
+	DNSServFail                 // resolver failure (SERVFAIL, REFUSED, misbehaving server)
+	DNSTimeout                  // no answer within the lookup timeout
+	DNSOtherError               // anything else (network errors, malformed responses)
+)
+
+// Inconclusive reports whether a failure says nothing about the domain itself,
+// so another attempt may still resolve it
+func (c DNSErrorClass) Inconclusive() bool {
+	return c == DNSTimeout || c == DNSServFail
+}
+
+// lookupFailures merges the failed lookups of one domain's record types. An answer
+// without a usable record only speaks for its own type, so the domain is DNSNotFound only
+// once every lookup answered definitively, or one got NXDOMAIN for the name itself.
+// Otherwise the most telling of the other failures stands (SERVFAIL beats timeout).
+type lookupFailures struct {
+	nxdomain bool          // a lookup got NXDOMAIN
+	class    DNSErrorClass // the worst non-definitive failure, DNSNoError if none
+}
+
+// add records one lookup's failure; DNSNoError and DNSNotFound are definitive answers.
+// nxdomain marks an NXDOMAIN, which Go's resolver reports like NODATA.
+func (f *lookupFailures) add(c DNSErrorClass, nxdomain bool) {
+	switch {
+	case nxdomain:
+		f.nxdomain = true
+	case c == DNSNoError, c == DNSNotFound:
+	case f.class == DNSNoError || c < f.class:
+		f.class = c
+	}
+}
+
+// result returns the failure class of the domain once all lookups are in
+func (f *lookupFailures) result() DNSErrorClass {
+	if f.nxdomain || f.class == DNSNoError {
+		return DNSNotFound
+	}
+	return f.class
+}
+
+// String returns a short name for the error class
+func (c DNSErrorClass) String() string {
+	switch c {
+	case DNSNoError:
+		return "ok"
+	case DNSNotFound:
+		return "nxdomain"
+	case DNSServFail:
+		return "servfail"
+	case DNSTimeout:
+		return "timeout"
+	default:
+		return "error"
+	}
+}
+
+// ClassifyDNSError maps a resolver error onto a DNSErrorClass
+func ClassifyDNSError(err error) DNSErrorClass {
+	if err == nil {
+		return DNSNoError
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		switch {
+		case dnsErr.IsNotFound:
+			return DNSNotFound
+		case dnsErr.IsTimeout:
+			return DNSTimeout
+		case dnsErr.IsTemporary, strings.Contains(dnsErr.Err, "server misbehaving"):
+			// Go's resolver reports SERVFAIL/REFUSED as "server misbehaving"
+			return DNSServFail
+		}
+		return DNSOtherError
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return DNSTimeout
+	}
+	return DNSOtherError
+}
+
+// ValidateDNS checks if domain has A, AAAA, or CNAME records, or just the Records types
+// (with caching and parallel lookups)
 func (v *Validator) ValidateDNS(ctx context.Context, domain string) (bool, error) {
+	valid, _ := v.ValidateDNSResult(ctx, domain)
+	return valid, nil
+}
+
+// ValidateDNSResult is ValidateDNS that also reports why an invalid domain failed
+func (v *Validator) ValidateDNSResult(ctx context.Context, domain string) (bool, DNSErrorClass) {
 	// Check cache first
 	if v.useCache {
 		v.cacheMu.RLock()
 		if cached, ok := v.cache[domain]; ok {
 			// Check if cache entry is still valid
-			if time.Since(cached.timestamp) < v.cacheTTL {
+			if time.Since(cached.timestamp) < cached.ttl {
 				v.cacheMu.RUnlock()
-				return cached.valid, nil
+				v.tracef(ctx, "dns %s: cached result (%s)", domain, cached.class)
+				return cached.valid, cached.class
 			}
 		}
 		v.cacheMu.RUnlock()
 	}
 
-	// Get a resolver in round-robin fashion
-	resolver := v.getResolver()
+	return v.checkDNS(ctx, domain, lookupTimeout)
+}
+
+// RecheckDNS resolves a domain again, bypassing the cache, on the next resolver in
+// rotation and with a longer timeout. Meant for a second pass over inconclusive results.
+func (v *Validator) RecheckDNS(ctx context.Context, domain string) (bool, DNSErrorClass) {
+	return v.checkDNS(ctx, domain, recheckTimeout)
+}
+
+// checkDNS resolves a domain (and its www. variant in strict mode) and caches the result
+func (v *Validator) checkDNS(ctx context.Context, domain string, timeout time.Duration) (bool, DNSErrorClass) {
+	valid, class, ttl := v.resolve(ctx, domain, timeout)
+
+	// Strict mode: half-configured (often parked) domains lack the www. record
+	if valid && v.RequireApexAndWWW {
+		var wwwTTL time.Duration
+		valid, class, wwwTTL = v.resolve(ctx, "www."+domain, timeout)
+		if wwwTTL != ttlUnknown && (ttl == ttlUnknown || wwwTTL < ttl) {
+			ttl = wwwTTL
+		}
+	}
+
+	// Cache the result
+	if v.useCache && cacheable(valid, class) {
+		v.cacheMu.Lock()
+		v.storeLocked(domain, &dnsResult{
+			valid:     valid,
+			class:     class,
+			timestamp: time.Now(),
+			ttl:       v.entryTTL(ttl),
+		})
+		v.cacheMu.Unlock()
+	}
+
+	return valid, class
+}
+
+// cacheKey identifies one cache insertion, so eviction can tell a stale queue
+// slot from a domain that was cached again later
+type cacheKey struct {
+	domain    string
+	timestamp time.Time
+}
+
+// storeLocked caches a result and evicts the oldest entries beyond MaxCacheEntries.
+// The caller must hold cacheMu for writing.
+func (v *Validator) storeLocked(domain string, r *dnsResult) {
+	v.cache[domain] = r
+	if v.MaxCacheEntries <= 0 {
+		return
+	}
+
+	v.cacheOrder = append(v.cacheOrder, cacheKey{domain: domain, timestamp: r.timestamp})
+	for len(v.cache) > v.MaxCacheEntries && len(v.cacheOrder) > 0 {
+		oldest := v.cacheOrder[0]
+		v.cacheOrder = v.cacheOrder[1:]
+		if cached, ok := v.cache[oldest.domain]; ok && cached.timestamp.Equal(oldest.timestamp) {
+			delete(v.cache, oldest.domain)
+		}
+	}
+}
+
+// cacheFileEntry is the on-disk form of a dnsResult
+type cacheFileEntry struct {
+	Valid     bool          `json:"valid"`
+	Class     DNSErrorClass `json:"class"`
+	Timestamp time.Time     `json:"timestamp"`
+	TTL       time.Duration `json:"ttl"`
+}
+
+// resolve looks a name up on the resolver resolverIndex picks. The TTL is
+// ttlUnknown unless TTL-aware lookups are enabled.
+func (v *Validator) resolve(ctx context.Context, name string, timeout time.Duration) (bool, DNSErrorClass, time.Duration) {
+	if v.Backend != nil {
+		valid, class := v.Backend.Lookup(ctx, name)
+		v.tracef(ctx, "dns %s @backend: %s", name, class)
+		return valid, class, ttlUnknown
+	}
+
+	idx := v.resolverIndex(name)
+	valid, class, ttl := v.lookupOn(ctx, idx, name, timeout)
+
+	// A SERVFAIL or timeout is the resolver's (or network's) problem, not proof the
+	// domain is dead - ask the following resolvers before concluding
+	for attempt, retries := 1, v.retriesFor(class); !valid && attempt <= retries && ctx.Err() == nil; attempt++ {
+		idx = (idx + 1) % len(v.resolvers)
+		v.tracef(ctx, "dns %s: %s, retrying on %s (%d/%d)", name, class, v.serverName(idx), attempt, retries)
+		valid, class, ttl = v.lookupOn(ctx, idx, name, timeout)
+		if !class.Inconclusive() {
+			break
+		}
+	}
+
+	return valid, class, ttl
+}
+
+// retriesFor returns how many more resolvers to ask after a failure of class: Retries
+// for inconclusive failures, and at least one for SERVFAIL with RetryServFail. Each retry
+// goes to a different resolver, so there are never more than the other resolvers.
+func (v *Validator) retriesFor(class DNSErrorClass) int {
+	if !class.Inconclusive() {
+		return 0
+	}
+	retries := v.Retries
+	if class == DNSServFail && v.RetryServFail && retries < 1 {
+		retries = 1
+	}
+	return min(retries, len(v.resolvers)-1)
+}
+
+// cacheable reports whether a result may be cached: an answer, or a definitive
+// NXDOMAIN / no records. Timeouts and resolver failures are asked again next time.
+func cacheable(valid bool, class DNSErrorClass) bool {
+	return valid || class == DNSNotFound
+}
+
+// lookupOn queries resolver idx, directly (with TTLs) when TTL-aware caching is possible
+func (v *Validator) lookupOn(ctx context.Context, idx int, name string, timeout time.Duration) (bool, DNSErrorClass, time.Duration) {
+	if v.TTLAware && len(v.servers) > 0 {
+		return v.lookupDomainTTL(ctx, v.servers[idx], name, timeout)
+	}
+	valid, class := v.lookupDomain(ctx, idx, name, timeout)
+	return valid, class, ttlUnknown
+}
+
+// entryTTL picks how long to cache a result: its DNS TTL bounded by MaxCacheTTL when
+// known, otherwise the fixed cache TTL
+func (v *Validator) entryTTL(ttl time.Duration) time.Duration {
+	if ttl == ttlUnknown {
+		return v.cacheTTL
+	}
+	if v.MaxCacheTTL > 0 && ttl > v.MaxCacheTTL {
+		return v.MaxCacheTTL
+	}
+	return ttl
+}
+
+// lookupDomain checks the Records types (A, AAAA and CNAME by default) on one resolver.
+// When nothing resolves it also returns the failure class lookupFailures settles on.
+// Go's resolver reports NXDOMAIN and NODATA alike, so a name is only DNSNotFound here
+// once every record type came back empty.
+func (v *Validator) lookupDomain(ctx context.Context, idx int, domain string, timeout time.Duration) (bool, DNSErrorClass) {
+	// A ValidateBatch worker queries over its own open connections instead
+	if conns, ok := ctx.Value(batchConnsKey{}).(*batchConns); ok && len(v.servers) > 0 {
+		return v.lookupBatched(ctx, conns, idx, domain, timeout)
+	}
+
+	resolver := v.resolvers[idx]
 
 	// Parallel DNS lookup with early exit - check all record types simultaneously
 	// This is MUCH faster than sequential lookups (0.5s vs 3s for invalid domains)
-	lookupCtx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	lookupCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	type lookupResult struct {
-		valid bool
-		err   error
+		record  string
+		answer  string
+		valid   bool
+		ignored bool // only IgnoreIPs addresses came back
+		err     error
 	}
 
 	results := make(chan lookupResult, 3)
+	records, lookups := v.records(), 0
 
 	// Check A record (IPv4) in parallel
-	go func() {
-		ips, err := resolver.LookupIP(lookupCtx, "ip4", domain)
-		results <- lookupResult{valid: err == nil && len(ips) > 0, err: err}
-	}()
+	if records&RecordA != 0 {
+		lookups++
+		go func() {
+			ips, err := resolver.LookupIP(lookupCtx, "ip4", domain)
+			ignored := v.onlyIgnored(ips)
+			results <- lookupResult{record: "A", answer: fmt.Sprint(ips), valid: err == nil && len(ips) > 0 && !ignored, ignored: ignored, err: err}
+		}()
+	}
 
 	// Check AAAA record (IPv6) in parallel
-	go func() {
-		ips, err := resolver.LookupIP(lookupCtx, "ip6", domain)
-		results <- lookupResult{valid: err == nil && len(ips) > 0, err: err}
-	}()
+	if records&RecordAAAA != 0 {
+		lookups++
+		go func() {
+			ips, err := resolver.LookupIP(lookupCtx, "ip6", domain)
+			ignored := v.onlyIgnored(ips)
+			results <- lookupResult{record: "AAAA", answer: fmt.Sprint(ips), valid: err == nil && len(ips) > 0 && !ignored, ignored: ignored, err: err}
+		}()
+	}
 
 	// Check CNAME record in parallel
-	go func() {
-		cname, err := resolver.LookupCNAME(lookupCtx, domain)
-		valid := err == nil && cname != "" && cname != domain && cname != domain+"."
-		results <- lookupResult{valid: valid, err: err}
-	}()
+	if records&RecordCNAME != 0 {
+		lookups++
+		go func() {
+			cname, err := resolver.LookupCNAME(lookupCtx, domain)
+			valid := err == nil && cname != "" && cname != domain && cname != domain+"."
+			results <- lookupResult{record: "CNAME", answer: cname, valid: valid, err: err}
+		}()
+	}
 
 	// Wait for results - early exit on first success
-	valid := false
-	for i := 0; i < 3; i++ {
+	var failures lookupFailures
+	for i := 0; i < lookups; i++ {
 		result := <-results
+		if v.tracing(ctx) {
+			if result.err != nil {
+				v.tracef(ctx, "dns %s %s @%s: %s (%v)", domain, result.record, v.serverName(idx), ClassifyDNSError(result.err), result.err)
+			} else if result.ignored {
+				v.tracef(ctx, "dns %s %s @%s: %s, ignored addresses only", domain, result.record, v.serverName(idx), result.answer)
+			} else {
+				v.tracef(ctx, "dns %s %s @%s: %s", domain, result.record, v.serverName(idx), result.answer)
+			}
+		}
 		if result.valid {
-			valid = true
-			break // Early exit - no need to wait for other lookups
+			return true, DNSNoError // Early exit - no need to wait for other lookups
 		}
-	}
-
-	// Cache the result
-	if v.useCache {
-		v.cacheMu.Lock()
-		v.cache[domain] = &dnsResult{
-			valid:     valid,
-			timestamp: time.Now(),
+		c := ClassifyDNSError(result.err)
+		if result.ignored {
+			// The resolver answered, just not with a real address
+			c = DNSNotFound
 		}
-		v.cacheMu.Unlock()
+		failures.add(c, false)
 	}
 
-	return valid, nil
+	return false, failures.result()
 }
 
 // ValidateHTTP checks if domain is reachable via HTTP/HTTPS (tries both in parallel)
 func (v *Validator) ValidateHTTP(ctx context.Context, domain string) (bool, error) {
+	// Wait for an HTTP slot before starting the timeout, so queueing doesn't eat into it
+	if v.httpSem != nil {
+		select {
+		case v.httpSem <- struct{}{}:
+			defer func() { <-v.httpSem }()
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+
 	type httpResult struct {
-		valid bool
-		err   error
+		scheme string
+		status int
+		valid  bool
+		err    error
+	}
+
+	accept := v.AcceptStatus
+	if accept == nil {
+		accept = DefaultAcceptStatus
 	}
 
 	results := make(chan httpResult, 2)
@@ -220,7 +659,7 @@ func (v *Validator) ValidateHTTP(ctx context.Context, domain string) (bool, erro
 	go func() {
 		req, err := http.NewRequestWithContext(httpCtx, "HEAD", "https://"+domain, nil)
 		if err != nil {
-			results <- httpResult{valid: false, err: err}
+			results <- httpResult{scheme: "https", valid: false, err: err}
 			return
 		}
 		req.Header.Set("User-Agent", "Magpie/1.0")
@@ -228,11 +667,11 @@ func (v *Validator) ValidateHTTP(ctx context.Context, domain string) (bool, erro
 
 		resp, err := v.httpClient.Do(req)
 		if err == nil {
-			valid := resp.StatusCode < 500
+			valid := accept(resp.StatusCode)
 			drainAndClose(resp)
-			results <- httpResult{valid: valid, err: nil}
+			results <- httpResult{scheme: "https", status: resp.StatusCode, valid: valid, err: nil}
 		} else {
-			results <- httpResult{valid: false, err: err}
+			results <- httpResult{scheme: "https", valid: false, err: err}
 		}
 	}()
 
@@ -240,7 +679,7 @@ func (v *Validator) ValidateHTTP(ctx context.Context, domain string) (bool, erro
 	go func() {
 		req, err := http.NewRequestWithContext(httpCtx, "HEAD", "http://"+domain, nil)
 		if err != nil {
-			results <- httpResult{valid: false, err: err}
+			results <- httpResult{scheme: "http", valid: false, err: err}
 			return
 		}
 		req.Header.Set("User-Agent", "Magpie/1.0")
@@ -248,17 +687,22 @@ func (v *Validator) ValidateHTTP(ctx context.Context, domain string) (bool, erro
 
 		resp, err := v.httpClient.Do(req)
 		if err == nil {
-			valid := resp.StatusCode < 500
+			valid := accept(resp.StatusCode)
 			drainAndClose(resp)
-			results <- httpResult{valid: valid, err: nil}
+			results <- httpResult{scheme: "http", status: resp.StatusCode, valid: valid, err: nil}
 		} else {
-			results <- httpResult{valid: false, err: err}
+			results <- httpResult{scheme: "http", valid: false, err: err}
 		}
 	}()
 
 	// Return true if either succeeds
 	for i := 0; i < 2; i++ {
 		result := <-results
+		if result.err != nil {
+			v.tracef(ctx, "http %s://%s: %v", result.scheme, domain, result.err)
+		} else {
+			v.tracef(ctx, "http %s://%s: status %d", result.scheme, domain, result.status)
+		}
 		if result.valid {
 			return true, nil
 		}
@@ -267,15 +711,124 @@ func (v *Validator) ValidateHTTP(ctx context.Context, domain string) (bool, erro
 	return false, nil
 }
 
+// SetProxy replaces the proxy taken from the environment for HTTP checks and, when
+// Backend is a BulkBackend, for its requests. DNS lookups never use a proxy.
+// Call before validating.
+func (v *Validator) SetProxy(proxy netutil.ProxyFunc) {
+	v.httpClient.Transport.(*http.Transport).Proxy = proxy
+	if bulk, ok := v.Backend.(*BulkBackend); ok {
+		bulk.client.Transport.(*http.Transport).Proxy = proxy
+	}
+}
+
+// SetHTTPConcurrency limits how many HTTP checks run at once, independent of how many
+// workers call the validator. n <= 0 removes the limit. Call before validating.
+func (v *Validator) SetHTTPConcurrency(n int) {
+	if n <= 0 {
+		v.httpSem = nil
+		return
+	}
+	v.httpSem = make(chan struct{}, n)
+}
+
+// Outcome classifies a domain by how far it got through full validation
+type Outcome int
+
+const (
+	OutcomeDead         Outcome = iota // no DNS records
+	OutcomeDNSOnlyAlive                // resolves, but doesn't serve HTTP or HTTPS
+	OutcomeFullyAlive                  // resolves and serves HTTP or HTTPS
+)
+
+// String returns the outcome code used in reports
+func (o Outcome) String() string {
+	switch o {
+	case OutcomeDNSOnlyAlive:
+		return "dns_only_alive"
+	case OutcomeFullyAlive:
+		return "fully_alive"
+	default:
+		return "dead"
+	}
+}
+
+// MarshalText encodes the outcome as its code
+func (o Outcome) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
 // ValidateFull performs both DNS and HTTP validation
 func (v *Validator) ValidateFull(ctx context.Context, domain string) (bool, error) {
+	outcome, err := v.ValidateFullOutcome(ctx, domain)
+	return outcome == OutcomeFullyAlive, err
+}
+
+// ValidateFullOutcome is ValidateFull that tells dead domains apart from ones that
+// resolve but don't serve HTTP
+func (v *Validator) ValidateFullOutcome(ctx context.Context, domain string) (Outcome, error) {
 	// DNS must pass first (it's faster)
 	dnsValid, err := v.ValidateDNS(ctx, domain)
 	if err != nil || !dnsValid {
-		return false, err
+		return OutcomeDead, err
 	}
 
 	// HTTP validation (parallel HTTP/HTTPS)
-	httpValid, _ := v.ValidateHTTP(ctx, domain)
-	return httpValid, nil
+	if httpValid, _ := v.ValidateHTTP(ctx, domain); !httpValid {
+		return OutcomeDNSOnlyAlive, nil
+	}
+	return OutcomeFullyAlive, nil
+}
+
+// commonTLDs are widely used, well-policed TLDs where DNS validity is a good proxy for liveness
+var commonTLDs = map[string]bool{
+	"com": true, "net": true, "org": true, "edu": true, "gov": true, "mil": true, "int": true,
+	"io": true, "co": true, "uk": true, "de": true, "fr": true, "nl": true, "it": true, "es": true,
+	"ca": true, "au": true, "jp": true, "se": true, "ch": true, "at": true, "be": true, "dk": true,
+	"no": true, "fi": true, "pl": true, "br": true, "us": true, "eu": true, "me": true, "tv": true,
+}
+
+// DefaultDeadTLDs are TLDs that are reserved, never delegated, or retired from the root zone
+var DefaultDeadTLDs = []string{
+	// Private-use and special-use names (RFC 2606, RFC 6761, ICANN name collisions)
+	"corp", "home", "mail", "lan", "local", "localdomain", "localhost", "internal", "intranet",
+	"private", "test", "example", "invalid", "onion",
+	// Retired ccTLDs
+	"an", "bu", "cs", "dd", "tp", "um", "yu", "zr",
+}
+
+// NewTLDSet builds a TLD lookup set from a list, ignoring case, blanks and leading dots
+func NewTLDSet(tlds []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(tlds))
+	for _, tld := range tlds {
+		tld = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tld), "."))
+		if tld != "" {
+			set[tld] = struct{}{}
+		}
+	}
+	return set
+}
+
+// IsDeadTLD reports whether a domain sits under one of the validator's known-dead TLDs
+func (v *Validator) IsDeadTLD(domain string) bool {
+	if len(v.DeadTLDs) == 0 {
+		return false
+	}
+	if _, dead := v.DeadTLDs[strings.ToLower(domainTLD(domain))]; !dead {
+		return false
+	}
+	v.tracef(context.Background(), "tld .%s is on the dead TLD list, no lookup needed", domainTLD(domain))
+	return true
+}
+
+// domainTLD returns the last label of a domain
+func domainTLD(domain string) string {
+	if idx := strings.LastIndex(domain, "."); idx != -1 {
+		return domain[idx+1:]
+	}
+	return domain
+}
+
+// IsCommonTLD reports whether a domain's TLD is in the low-risk common TLD set
+func IsCommonTLD(domain string) bool {
+	return commonTLDs[strings.ToLower(domainTLD(domain))]
 }
@@ -0,0 +1,149 @@
+package validator
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// wildcardProbe caches whether one TLD answers for names that don't exist
+type wildcardProbe struct {
+	once     sync.Once
+	wildcard bool
+}
+
+// IsWildcardTLD reports whether the domain's TLD wildcard-resolves, i.e. returns records
+// for any name. Under such TLDs a DNS answer doesn't prove the domain exists. Each TLD is
+// probed once, with a random label that can't be registered, and cached for the
+// validator's lifetime. Common TLDs are never probed.
+func (v *Validator) IsWildcardTLD(ctx context.Context, domain string) bool {
+	if !v.DetectWildcards {
+		return false
+	}
+
+	tld := strings.ToLower(domainTLD(domain))
+	if commonTLDs[tld] {
+		return false
+	}
+
+	v.wildcardMu.Lock()
+	if v.wildcardTLDs == nil {
+		v.wildcardTLDs = make(map[string]*wildcardProbe)
+	}
+	probe, ok := v.wildcardTLDs[tld]
+	if !ok {
+		probe = &wildcardProbe{}
+		v.wildcardTLDs[tld] = probe
+	}
+	v.wildcardMu.Unlock()
+
+	probe.once.Do(func() {
+		label := fmt.Sprintf("magpie-probe-%016x", rand.Uint64())
+		probe.wildcard, _ = v.lookupDomain(ctx, v.resolverIndex(tld), label+"."+tld, lookupTimeout)
+	})
+
+	if probe.wildcard {
+		v.tracef(ctx, "tld .%s wildcard-resolves nonexistent names, DNS alone proves nothing", tld)
+	}
+
+	return probe.wildcard
+}
+
+// parentProbe caches the addresses a parent domain returns for a name that doesn't exist.
+// No addresses means the parent doesn't wildcard-resolve.
+type parentProbe struct {
+	once  sync.Once
+	addrs map[string]struct{}
+}
+
+// IsWildcardSubdomain reports whether a subdomain only resolves because its parent
+// answers for every name, as parking pages and registrar sinkholes do: a random sibling
+// label resolves to an address the domain also has. Each parent is probed once and
+// cached, so the domain's own addresses are only looked up under wildcard parents.
+// Registrable domains (example.com) are left to IsWildcardTLD.
+func (v *Validator) IsWildcardSubdomain(ctx context.Context, domain string) bool {
+	if !v.DetectParentWildcards {
+		return false
+	}
+
+	parent, ok := wildcardParent(domain)
+	if !ok {
+		return false
+	}
+
+	v.wildcardMu.Lock()
+	if v.parentProbes == nil {
+		v.parentProbes = make(map[string]*parentProbe)
+	}
+	probe, ok := v.parentProbes[parent]
+	if !ok {
+		probe = &parentProbe{}
+		v.parentProbes[parent] = probe
+	}
+	v.wildcardMu.Unlock()
+
+	probe.once.Do(func() {
+		label := fmt.Sprintf("magpie-probe-%016x", rand.Uint64())
+		probe.addrs = v.lookupAddrs(ctx, label+"."+parent)
+		if len(probe.addrs) > 0 {
+			v.tracef(ctx, "parent %s wildcard-resolves nonexistent names", parent)
+		}
+	})
+	if len(probe.addrs) == 0 {
+		return false
+	}
+
+	for addr := range v.lookupAddrs(ctx, domain) {
+		if _, ok := probe.addrs[addr]; ok {
+			v.tracef(ctx, "dns %s: resolves to the wildcard address %s of %s", domain, addr, parent)
+			return true
+		}
+	}
+	return false
+}
+
+// wildcardParent returns the parent of a subdomain, as long as that parent is itself a
+// registrable domain or below it
+func wildcardParent(domain string) (string, bool) {
+	registrable, err := publicsuffix.EffectiveTLDPlusOne(domain)
+	if err != nil || domain == registrable {
+		return "", false
+	}
+	return domain[strings.IndexByte(domain, '.')+1:], true
+}
+
+// lookupAddrs returns the IPv4 and IPv6 addresses of a name on its resolver (see resolverIndex)
+func (v *Validator) lookupAddrs(ctx context.Context, name string) map[string]struct{} {
+	lookupCtx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
+	ips, err := v.resolvers[v.resolverIndex(name)].LookupIPAddr(lookupCtx, name)
+	if err != nil {
+		return nil
+	}
+	addrs := make(map[string]struct{}, len(ips))
+	for _, ip := range ips {
+		addrs[ip.IP.String()] = struct{}{}
+	}
+	return addrs
+}
+
+// WildcardTLDs returns the probed TLDs found to wildcard-resolve, sorted
+func (v *Validator) WildcardTLDs() []string {
+	v.wildcardMu.Lock()
+	defer v.wildcardMu.Unlock()
+
+	var tlds []string
+	for tld, probe := range v.wildcardTLDs {
+		if probe.wildcard {
+			tlds = append(tlds, tld)
+		}
+	}
+	sort.Strings(tlds)
+	return tlds
+}
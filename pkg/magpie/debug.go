@@ -0,0 +1,132 @@
+package magpie
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pigeonsec/magpie/internal/validator"
+)
+
+// debugLog writes the validation trace of every failed domain: the record types queried,
+// the resolver that answered each and the underlying error. Traces are collected per
+// domain and written as one block once its verdict is known, so concurrent workers
+// don't interleave. Domains that pass are not logged.
+type debugLog struct {
+	mu     sync.Mutex
+	out    io.Writer
+	sample uint32
+
+	// pending holds the traces of domains sent to the second DNS pass until it settles
+	pending map[string]*domainTrace
+}
+
+// domainTrace is the trace of one domain
+type domainTrace struct {
+	mu     sync.Mutex
+	domain string
+	start  time.Time
+	lines  []string
+	held   bool
+}
+
+type domainTraceKey struct{}
+
+// newDebugLog writes traces to out, of 1 in sample domains
+func newDebugLog(out io.Writer, sample int) *debugLog {
+	return &debugLog{out: out, sample: uint32(max(sample, 0)), pending: make(map[string]*domainTrace)}
+}
+
+// sampled reports whether a domain is traced: all of them with a sample of 1,
+// otherwise a deterministic 1 in n so reruns trace the same domains
+func (d *debugLog) sampled(domain string) bool {
+	if d.sample <= 1 {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(domain))
+	return h.Sum32()%d.sample == 0
+}
+
+// add appends a line to the trace
+func (t *domainTrace) add(format string, args ...interface{}) {
+	t.mu.Lock()
+	t.lines = append(t.lines, fmt.Sprintf("[%6.0fms] %s", float64(time.Since(t.start).Microseconds())/1000, fmt.Sprintf(format, args...)))
+	t.mu.Unlock()
+}
+
+// trace runs check with a context that records the domain's trace, and logs the trace
+// if the domain failed. A trace held for the second DNS pass is logged by recheck instead.
+func (d *debugLog) trace(ctx context.Context, domain string, check func(ctx context.Context) (bool, error)) (bool, error) {
+	t := &domainTrace{domain: domain, start: time.Now()}
+	ctx = context.WithValue(validator.WithTrace(ctx, t.add), domainTraceKey{}, t)
+	valid, err := check(ctx)
+
+	switch {
+	case ctx.Err() != nil:
+		// Cut short by an interrupt, there is no verdict to explain
+	case t.held:
+		d.mu.Lock()
+		d.pending[domain] = t
+		d.mu.Unlock()
+	case !valid || err != nil:
+		d.write(t, err)
+	}
+	return valid, err
+}
+
+// recheck is trace for the second DNS pass, continuing the trace held by the first
+func (d *debugLog) recheck(ctx context.Context, domain string, check func(ctx context.Context) bool) bool {
+	d.mu.Lock()
+	t := d.pending[domain]
+	delete(d.pending, domain)
+	d.mu.Unlock()
+	if t == nil {
+		return check(ctx)
+	}
+
+	t.add("dns result inconclusive, second pass with a longer timeout")
+	valid := check(context.WithValue(validator.WithTrace(ctx, t.add), domainTraceKey{}, t))
+	if !valid && ctx.Err() == nil {
+		d.write(t, nil)
+	}
+	return valid
+}
+
+// write logs a failed domain's trace as one block
+func (d *debugLog) write(t *domainTrace, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	block := fmt.Sprintf("%s debug: %s invalid after %s\n", time.Now().Format("2006/01/02 15:04:05"), t.domain, time.Since(t.start).Round(time.Millisecond))
+	for _, line := range t.lines {
+		block += "  " + line + "\n"
+	}
+	if len(t.lines) == 0 {
+		block += "  (no lookups made)\n"
+	}
+	if err != nil {
+		block += fmt.Sprintf("  error: %v\n", err)
+	}
+
+	d.mu.Lock()
+	io.WriteString(d.out, block)
+	d.mu.Unlock()
+}
+
+// debugNote adds a line to the -debug trace of the domain checked with ctx, if any
+func debugNote(ctx context.Context, format string, args ...interface{}) {
+	if t, ok := ctx.Value(domainTraceKey{}).(*domainTrace); ok {
+		t.add(format, args...)
+	}
+}
+
+// debugHold keeps the trace of the domain checked with ctx for the second DNS pass
+func debugHold(ctx context.Context) {
+	if t, ok := ctx.Value(domainTraceKey{}).(*domainTrace); ok {
+		t.held = true
+	}
+}
@@ -0,0 +1,57 @@
+package magpie
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// domainFeed hands unique domains to the validation workers. Without Config.Overlap it
+// is filled from the finished fetch; with it, the fetch collector feeds each new domain
+// as it arrives, so validation runs while sources are still being fetched.
+type domainFeed struct {
+	domains chan string
+	fed     atomic.Int64 // domains sent so far
+	size    atomic.Int64 // domains the feed holds in all, 0 until known
+}
+
+// newDomainFeed makes a feed buffering two domains per validation worker
+func newDomainFeed(workers int) *domainFeed {
+	return &domainFeed{domains: make(chan string, workers*2)}
+}
+
+// feedDomains starts feeding a fetched domain set and closes the feed when done, or
+// early on an interrupt
+func feedDomains(ctx context.Context, domains map[string]struct{}, workers int) *domainFeed {
+	feed := newDomainFeed(workers)
+	feed.size.Store(int64(len(domains)))
+	go func() {
+		for domain := range domains {
+			if ctx.Err() != nil {
+				break
+			}
+			feed.send(domain)
+		}
+		feed.close()
+	}()
+	return feed
+}
+
+// send queues a domain for validation. It blocks while the workers are busy, which
+// holds the fetch collector back instead of buffering the backlog in memory.
+func (f *domainFeed) send(domain string) {
+	f.fed.Add(1)
+	f.domains <- domain
+}
+
+// close ends the feed; the validation workers finish once it is drained
+func (f *domainFeed) close() {
+	if f.size.Load() == 0 {
+		f.size.Store(f.fed.Load())
+	}
+	close(f.domains)
+}
+
+// total returns how many domains the feed holds, or 0 while more may still arrive
+func (f *domainFeed) total() int {
+	return int(f.size.Load())
+}
@@ -0,0 +1,428 @@
+package magpie
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pigeonsec/magpie/internal/fetcher"
+	"github.com/pigeonsec/magpie/internal/netutil"
+	"github.com/pigeonsec/magpie/internal/stats"
+)
+
+// sourcedDomain is a parsed domain tagged with the index of the source it came from
+type sourcedDomain struct {
+	domain string
+	source int
+}
+
+// parseJob carries a downloaded body from a fetch worker to a parse worker
+type parseJob struct {
+	workerID int
+	url      string
+	body     []byte
+	started  time.Time
+}
+
+// expectedDomains estimates how many unique domains fetching urls yields, to size the
+// dedup set up front rather than rehash it a dozen times on the way to millions. The
+// previous run's unique count is the best guess; without one, the sources' last domain
+// counts are summed (an overestimate by whatever they share). A first run grows the set.
+func expectedDomains(urls []string, tracker *stats.Tracker) int {
+	if tracker == nil {
+		return 0
+	}
+	if global := tracker.LastGlobalStats(); global != nil && global.TotalDomainsUnique > 0 {
+		return global.TotalDomainsUnique
+	}
+	total := 0
+	for _, url := range urls {
+		if stat := tracker.GetStats(url); stat != nil {
+			total += stat.DomainsContributed
+		}
+	}
+	return total
+}
+
+// fetchOrder returns urls in the order they are handed to the fetch workers: highest
+// priority first, source order among equals. An interrupted run then already holds the
+// most important lists.
+func fetchOrder(urls []string, priority map[string]int) []string {
+	if len(priority) == 0 {
+		return urls
+	}
+	ordered := slices.Clone(urls)
+	slices.SortStableFunc(ordered, func(a, b string) int {
+		return cmp.Compare(priority[b], priority[a])
+	})
+	return ordered
+}
+
+// fetchSources fetches all sources with FetchWorkers parallel workers (adapted to the
+// failure rate with FetchAdaptive) and deduplicates the domains into result. With
+// ParseWorkers > 0, downloads and parsing run on separate pools so CPU-bound parsing of
+// large lists doesn't stall network I/O. With RetryFailed, failed sources get one more
+// pass at the end of the run before their failures are recorded. A non-nil feed is sent
+// each new domain as it is found (see Config.Overlap).
+//
+// Workers never touch result directly: they count with atomics and stream domains to a
+// single collector goroutine, and the fields are only filled in once every worker has
+// finished.
+func fetchSources(ctx context.Context, cfg *Config, result *Result, feed *domainFeed) {
+	start := time.Now()
+	urls, tracker := cfg.Sources, cfg.Tracker
+	result.Unique = make(map[string]struct{}, expectedDomains(urls, tracker))
+	result.Subdomains = make(map[string]struct{})
+
+	domainChan := make(chan sourcedDomain, 10000) // Buffered channel for streaming
+	errorChan := make(chan *SourceError, len(urls))
+
+	f := fetcher.NewFetcher(cfg.FetchTimeout, 3)
+	switch {
+	case cfg.MaxSize > 0:
+		f.MaxSize = cfg.MaxSize
+	case cfg.MaxSize < 0:
+		f.MaxSize = 0
+	}
+	if cfg.UserAgent != "" {
+		f.UserAgent = cfg.UserAgent
+	}
+	if len(cfg.Header) > 0 {
+		f.Header = cfg.Header
+	}
+	if cfg.Proxy != nil {
+		f.SetProxy(cfg.Proxy)
+	}
+	// One limiter for every worker, so many URLs on one provider don't hit it all at once
+	if cfg.PerHostLimit > 0 || cfg.PerHostRate > 0 {
+		f.Limiter = fetcher.NewHostLimiter(cfg.PerHostLimit, cfg.PerHostRate)
+	}
+	f.Cache = cfg.Cache
+
+	urlIndex := make(map[string]int, len(urls))
+	for i, url := range urls {
+		urlIndex[url] = i
+	}
+	if cfg.GroupBySource {
+		result.Attribution = &Attribution{URLs: urls, Source: make(map[string]int)}
+	}
+
+	var fetched atomic.Int64
+	var unique atomic.Int64
+	var reused atomic.Int64
+
+	// reuse serves a source fetched within MinInterval from the fetch cache, without
+	// even a conditional request; ok is false when it has to be fetched
+	reuse := func(url string) ([]string, bool) {
+		if cfg.MinInterval <= 0 || tracker == nil || !tracker.FetchedWithin(url, cfg.MinInterval, start) {
+			return nil, false
+		}
+		return f.Reuse(ctx, url)
+	}
+
+	// recordSuccess books a parsed source and streams its domains to the collector.
+	// A reused source wasn't contacted, so it doesn't count as a fetch in the tracker.
+	recordSuccess := func(workerID int, url string, domains []string, fromCache bool, started time.Time) {
+		count := int(fetched.Add(1))
+
+		// Record success in stats tracker
+		if tracker != nil {
+			if !fromCache {
+				tracker.RecordSuccess(url)
+			}
+			tracker.RecordDomains(url, len(domains))
+		}
+
+		cfg.log("fetch finished", fmt.Sprintf("[Worker %d] Found %d domains from %s", workerID, len(domains), url),
+			"worker_id", workerID, "url", url, "domains_found", len(domains), "cached", fromCache,
+			"duration_seconds", time.Since(started).Seconds())
+		if cfg.OnSource != nil {
+			cfg.OnSource(SourceProgress{
+				WorkerID: workerID,
+				URL:      url,
+				Domains:  len(domains),
+				Fetched:  count,
+				Unique:   int(unique.Load()) + len(domains),
+			})
+		}
+
+		// Stream domains to channel
+		source := urlIndex[url]
+		for _, domain := range domains {
+			domainChan <- sourcedDomain{domain: domain, source: source}
+		}
+	}
+
+	// Failures from the first pass wait here when RetryFailed is set
+	var (
+		retryMu   sync.Mutex
+		retryURLs []string
+	)
+
+	recordFailure := func(url string, err error, wrapped error, final bool) {
+		// A fetch cut short by an interrupt says nothing about the source
+		if ctx.Err() != nil {
+			return
+		}
+		if !final {
+			retryMu.Lock()
+			retryURLs = append(retryURLs, url)
+			retryMu.Unlock()
+			return
+		}
+		failure := &SourceError{URL: url, Err: err, msg: wrapped.Error()}
+		errorChan <- failure
+		if tracker != nil {
+			// Sources that report themselves gone are blacklisted sooner
+			if fetcher.IsPermanent(err) {
+				tracker.RecordPermanentFailure(url, err.Error())
+			} else {
+				tracker.RecordFailure(url, err.Error())
+			}
+		}
+		if cfg.OnSourceFailed != nil {
+			cfg.OnSourceFailed(failure)
+		}
+	}
+
+	// fetchURL fetches one source and books the result. It returns the underlying error
+	// of a failed download, for the FetchAdaptive throttle.
+	fetchURL := func(workerID int, url string, parseChan chan<- parseJob, final bool) error {
+		started := time.Now()
+		if domains, ok := reuse(url); ok {
+			cfg.log("fetch reused", fmt.Sprintf("[Worker %d] Reusing %s, fetched within -min-interval", workerID, url),
+				"worker_id", workerID, "url", url)
+			reused.Add(1)
+			recordSuccess(workerID, url, domains, true, started)
+			return nil
+		}
+		cfg.log("fetch started", fmt.Sprintf("[Worker %d] Fetching %s", workerID, url), "worker_id", workerID, "url", url)
+
+		// Split mode: download here, hand the body to the parse pool
+		if cfg.ParseWorkers > 0 && !fetcher.IsAXFRSource(url) {
+			var body []byte
+			err := withReconnect(ctx, cfg, workerID, url, func() error {
+				var downloadErr error
+				body, downloadErr = f.Download(ctx, url)
+				return downloadErr
+			})
+			if err != nil {
+				recordFailure(url, underlyingError(err), err, final)
+				return underlyingError(err)
+			}
+			parseChan <- parseJob{workerID: workerID, url: url, body: body, started: started}
+			return nil
+		}
+
+		var domains []string
+		err := withReconnect(ctx, cfg, workerID, url, func() error {
+			var fetchErr error
+			domains, fetchErr = f.Fetch(ctx, url)
+			return fetchErr
+		})
+		if err != nil {
+			recordFailure(url, underlyingError(err), err, final)
+			return underlyingError(err)
+		}
+		recordSuccess(workerID, url, domains, false, started)
+		return nil
+	}
+
+	// With FetchAdaptive the pool has the most workers allowed and the throttle decides
+	// how many fetch at once. It lives across both passes.
+	workerCount := cfg.FetchWorkers
+	var throttle *fetchThrottle
+	if cfg.FetchAdaptive {
+		workerCount = cfg.FetchWorkersMax
+		throttle = newFetchThrottle(cfg)
+	}
+
+	// runPass fetches the given URLs with fresh worker pools and waits for them to finish
+	runPass := func(passURLs []string, final bool) {
+		parseChan := make(chan parseJob, workerCount)
+
+		// Start parse workers
+		var parseWg sync.WaitGroup
+		for i := 0; i < cfg.ParseWorkers; i++ {
+			parseWg.Add(1)
+			go func() {
+				defer parseWg.Done()
+				for job := range parseChan {
+					domains, err := f.ParseBody(ctx, bytes.NewReader(job.body))
+					if err != nil {
+						recordFailure(job.url, err, fmt.Errorf("failed to parse %s: %w", job.url, err), final)
+						continue
+					}
+					recordSuccess(job.workerID, job.url, domains, false, job.started)
+				}
+			}()
+		}
+
+		// Start fetch workers
+		var fetchWg sync.WaitGroup
+		urlChan := make(chan string, len(passURLs))
+
+		for i := 0; i < workerCount; i++ {
+			fetchWg.Add(1)
+			go func(workerID int) {
+				defer fetchWg.Done()
+				for url := range urlChan {
+					if ctx.Err() != nil {
+						continue
+					}
+					if throttle == nil {
+						fetchURL(workerID, url, parseChan, final)
+						continue
+					}
+					if !throttle.acquire(ctx) {
+						continue
+					}
+					throttle.release(ctx, fetchURL(workerID, url, parseChan, final))
+				}
+			}(i)
+		}
+
+		// Feed URLs to workers
+		for _, url := range fetchOrder(passURLs, cfg.Priority) {
+			urlChan <- url
+		}
+		close(urlChan)
+
+		// Wait for all fetchers, then parsers
+		fetchWg.Wait()
+		close(parseChan)
+		parseWg.Wait()
+	}
+
+	// Collect domains in background
+	perSource := make([]int, len(urls))
+	collectorDone := make(chan bool)
+	go func() {
+		for d := range domainChan {
+			perSource[d.source]++
+			var subdomains bool
+			d.domain, subdomains = fetcher.SplitSubdomains(d.domain)
+			if cfg.Master != nil && cfg.Master.Test(d.domain) {
+				result.Duplicates++
+				result.InMaster++
+				continue
+			}
+			if subdomains {
+				result.Subdomains[d.domain] = struct{}{}
+			}
+			if _, ok := result.Unique[d.domain]; ok {
+				result.Duplicates++
+			} else {
+				result.Unique[d.domain] = struct{}{}
+				unique.Add(1)
+				// The feed blocks while the validation workers are busy, holding the fetch back
+				if feed != nil && (cfg.Skip == nil || !cfg.Skip(d.domain)) {
+					feed.send(d.domain)
+				}
+			}
+			if attr := result.Attribution; attr != nil {
+				if prev, ok := attr.Source[d.domain]; !ok || d.source < prev {
+					attr.Source[d.domain] = d.source
+				}
+			}
+		}
+		collectorDone <- true
+	}()
+
+	runPass(urls, !cfg.RetryFailed)
+
+	// Give sources that failed a second chance once the network has had time to recover,
+	// and only book the failure if the retry fails too
+	if len(retryURLs) > 0 && ctx.Err() == nil {
+		cfg.logf("Retrying %d failed sources in %v...", len(retryURLs), cfg.RetryFailedDelay)
+		select {
+		case <-time.After(cfg.RetryFailedDelay):
+		case <-ctx.Done():
+		}
+		if _, err := netutil.CheckConnectionWithRetry(ctx, cfg.Log == nil); err != nil {
+			cfg.logf("Warning: %v", err)
+		}
+		runPass(retryURLs, true)
+	}
+
+	close(domainChan)
+	<-collectorDone
+	close(errorChan)
+
+	// Collect errors, in source order
+	for failure := range errorChan {
+		result.Failures = append(result.Failures, failure)
+	}
+	slices.SortFunc(result.Failures, func(a, b *SourceError) int {
+		return cmp.Compare(urlIndex[a.URL], urlIndex[b.URL])
+	})
+
+	result.Found = len(result.Unique)
+	result.Fetched = int(fetched.Load())
+	result.Reused = int(reused.Load())
+	result.SourceDomains = make(map[string]int)
+	for i, count := range perSource {
+		if count > 0 {
+			result.SourceDomains[urls[i]] = count
+		}
+	}
+	if f.Cache != nil {
+		result.Unchanged = f.Cache.Hits()
+	}
+	result.FetchDuration = time.Since(start)
+}
+
+// fetchError keeps the underlying fetch error alongside the user-facing message
+type fetchError struct {
+	msg string
+	err error
+}
+
+func (e *fetchError) Error() string { return e.msg }
+func (e *fetchError) Unwrap() error { return e.err }
+
+// underlyingError returns the underlying fetch error recorded in the stats tracker
+func underlyingError(err error) error {
+	if fe, ok := err.(*fetchError); ok {
+		return fe.err
+	}
+	return err
+}
+
+// withReconnect runs op; on a connection error it waits for the internet to come back and retries once
+func withReconnect(ctx context.Context, cfg *Config, workerID int, url string, op func() error) error {
+	err := op()
+	if err == nil {
+		return nil
+	}
+
+	// Check if it's a connection error and wait for internet
+	if !isConnectionError(err) {
+		return &fetchError{msg: fmt.Sprintf("failed to fetch %s: %v", url, err), err: err}
+	}
+
+	cfg.log("connection lost", fmt.Sprintf("[Worker %d] Connection error detected, checking internet...", workerID),
+		"worker_id", workerID, "url", url, "error", err.Error())
+	if _, connErr := netutil.CheckConnectionWithRetry(ctx, cfg.Log == nil); connErr != nil {
+		return &fetchError{msg: fmt.Sprintf("failed to fetch %s: %v (connection lost)", url, err), err: err}
+	}
+
+	// Connection restored, retry this URL
+	cfg.log("connection restored", fmt.Sprintf("[Worker %d] Connection restored, retrying %s", workerID, url), "worker_id", workerID, "url", url)
+	if err := op(); err != nil {
+		return &fetchError{msg: fmt.Sprintf("failed to fetch %s after reconnection: %v", url, err), err: err}
+	}
+	return nil
+}
+
+// isConnectionError guesses whether an error was caused by losing network connectivity
+func isConnectionError(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "dial") || strings.Contains(msg, "connection") || strings.Contains(msg, "network")
+}
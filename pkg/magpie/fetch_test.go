@@ -0,0 +1,173 @@
+package magpie
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// fetchConfig fetches urls with the given fetch and parse pools and no validation
+func fetchConfig(urls []string, fetch, parse int) Config {
+	return Config{Sources: urls, FetchWorkers: fetch, ParseWorkers: parse, Sort: "none"}
+}
+
+// hostsBody returns a hosts file listing n domains under zone
+func hostsBody(zone string, n int) string {
+	var b strings.Builder
+	b.WriteString("# test list\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "0.0.0.0 d%d.%s\n", i, zone)
+	}
+	return b.String()
+}
+
+// serveLists starts a server answering /<name> with lists[name]
+func serveLists(tb testing.TB, lists map[string]string) *httptest.Server {
+	tb.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := lists[strings.TrimPrefix(r.URL.Path, "/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(body))
+	}))
+	tb.Cleanup(server.Close)
+	return server
+}
+
+// TestFetchSourcesCounts fetches overlapping lists with several workers and checks the
+// counters they share; run with -race to check the workers leave them to the collector
+func TestFetchSourcesCounts(t *testing.T) {
+	const (
+		sources = 6
+		perList = 2000
+		shared  = 500 // domains every list has in common
+	)
+	lists := make(map[string]string, sources)
+	for i := 0; i < sources; i++ {
+		lists[fmt.Sprintf("list%d.txt", i)] = hostsBody(fmt.Sprintf("zone%d.example", i), perList-shared) + hostsBody("shared.example", shared)
+	}
+	server := serveLists(t, lists)
+
+	var urls []string
+	for name := range lists {
+		urls = append(urls, server.URL+"/"+name)
+	}
+	urls = append(urls, server.URL+"/missing.txt")
+
+	for _, parse := range []int{0, 3} {
+		t.Run(fmt.Sprintf("parse-workers=%d", parse), func(t *testing.T) {
+			var fetchedHook atomic.Int64
+			cfg := fetchConfig(urls, 4, parse)
+			cfg.OnSource = func(SourceProgress) { fetchedHook.Add(1) }
+			result, err := Aggregate(context.Background(), cfg)
+			if err != nil {
+				t.Fatalf("Aggregate: %v", err)
+			}
+
+			if result.Fetched != sources {
+				t.Errorf("Fetched = %d, want %d", result.Fetched, sources)
+			}
+			if got := int(fetchedHook.Load()); got != sources {
+				t.Errorf("OnSource called %d times, want %d", got, sources)
+			}
+			if want := sources*(perList-shared) + shared; len(result.Unique) != want || len(result.Domains) != want {
+				t.Errorf("got %d unique and %d kept domains, want %d", len(result.Unique), len(result.Domains), want)
+			}
+			if want := (sources - 1) * shared; result.Duplicates != want {
+				t.Errorf("Duplicates = %d, want %d", result.Duplicates, want)
+			}
+			if len(result.Failures) != 1 || result.Failures[0].URL != server.URL+"/missing.txt" {
+				t.Errorf("Failures = %v, want only missing.txt", result.Failures)
+			}
+			if len(result.SourceDomains) != sources {
+				t.Errorf("SourceDomains has %d sources, want %d", len(result.SourceDomains), sources)
+			}
+			for url, count := range result.SourceDomains {
+				if count != perList {
+					t.Errorf("SourceDomains[%s] = %d, want %d", url, count, perList)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkFetchSources fetches large lists with parsing inside the fetch workers and on
+// a separate pool. The split only pays off with cores to spare for the parse workers.
+func BenchmarkFetchSources(b *testing.B) {
+	const (
+		sources = 8
+		perList = 50000
+	)
+	lists := make(map[string]string, sources)
+	var urls []string
+	for i := 0; i < sources; i++ {
+		name := fmt.Sprintf("list%d.txt", i)
+		lists[name] = hostsBody(fmt.Sprintf("zone%d.example", i), perList)
+	}
+	server := serveLists(b, lists)
+	for name := range lists {
+		urls = append(urls, server.URL+"/"+name)
+	}
+
+	for _, parse := range []int{0, 4} {
+		b.Run(fmt.Sprintf("parse-workers=%d", parse), func(b *testing.B) {
+			cfg := fetchConfig(urls, 4, parse)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				result, err := Aggregate(context.Background(), cfg)
+				if err != nil {
+					b.Fatalf("Aggregate: %v", err)
+				}
+				if len(result.Domains) != sources*perList {
+					b.Fatalf("got %d domains, want %d", len(result.Domains), sources*perList)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkDedupSet builds the set of unique domains from a 2M-domain corpus, as a
+// map[string]bool and as the map[string]struct{} the fetch collector uses, with and
+// without sizing it up front
+func BenchmarkDedupSet(b *testing.B) {
+	const n = 2_000_000
+	domains := make([]string, n)
+	for i := range domains {
+		domains[i] = fmt.Sprintf("host%d.zone%d.example.com", i, i%1000)
+	}
+
+	b.Run("bool", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			set := make(map[string]bool)
+			for _, domain := range domains {
+				set[domain] = true
+			}
+		}
+	})
+	b.Run("struct", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			set := make(map[string]struct{})
+			for _, domain := range domains {
+				set[domain] = struct{}{}
+			}
+		}
+	})
+	b.Run("struct-presized", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			set := make(map[string]struct{}, n)
+			for _, domain := range domains {
+				set[domain] = struct{}{}
+			}
+		}
+	})
+}
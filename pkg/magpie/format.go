@@ -0,0 +1,172 @@
+package magpie
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pigeonsec/magpie/internal/fetcher"
+)
+
+// Format is how one output format renders a blocklist
+type Format struct {
+	// Line renders one domain
+	Line func(domain string) string
+	// Comment starts a comment line
+	Comment string
+	// Header returns lines written before the domains; nil for none. serial is the
+	// zone's SOA serial and only used by formats with Serial set.
+	Header func(serial uint32) []string
+	// Serial reports whether Header needs a SOA serial
+	Serial bool
+	// Parse reads the domain back from an output line
+	Parse func(line string) (string, bool)
+	// Wildcard renders a domain together with all its subdomains, for leading-dot source
+	// entries (see fetcher.SplitSubdomains); nil if the format can't express that
+	Wildcard func(domain string) string
+}
+
+// Formats are the supported output formats, by Config.Format (and -format) name
+var Formats = map[string]Format{
+	"plain": {
+		Line:     func(domain string) string { return domain },
+		Comment:  "#",
+		Parse:    fetcher.ParseLine,
+		Wildcard: func(domain string) string { return domain + "\n*." + domain },
+	},
+	"hosts": {Line: func(domain string) string { return "0.0.0.0 " + domain }, Comment: "#", Parse: fetcher.ParseLine},
+	// Pi-hole takes a plain domain list as an adlist for its gravity database
+	"pihole": {Line: func(domain string) string { return domain }, Comment: "#", Parse: fetcher.ParseLine},
+	// dnsmasq also matches subdomains of each address=/domain/ entry
+	"dnsmasq": {
+		Line:     dnsmasqLine,
+		Comment:  "#",
+		Parse:    func(line string) (string, bool) { return Between(line, "address=/", "/") },
+		Wildcard: dnsmasqLine,
+	},
+	// unbound server: clause with a redirect zone per domain, answering 0.0.0.0 / :: for it
+	// and all its subdomains
+	"unbound": {
+		Line:     unboundLine,
+		Comment:  "#",
+		Header:   func(uint32) []string { return []string{"server:"} },
+		Parse:    parseUnboundLine,
+		Wildcard: unboundLine,
+	},
+	// Response Policy Zone: NXDOMAIN for the domain and all its subdomains
+	"rpz": {
+		Line:     rpzLine,
+		Comment:  ";",
+		Header:   rpzHeader,
+		Serial:   true,
+		Parse:    parseRPZLine,
+		Wildcard: rpzLine,
+	},
+	// Adblock-style rules for AdGuard Home, AdGuard DNS and uBlock: ||domain^ blocks the
+	// domain and all its subdomains
+	"adguard": {
+		Line:     adguardLine,
+		Comment:  "!",
+		Header:   adguardHeader,
+		Parse:    fetcher.ParseLine,
+		Wildcard: adguardLine,
+	},
+}
+
+// FormatNames lists the supported formats, sorted
+func FormatNames() []string {
+	names := make([]string, 0, len(Formats))
+	for name := range Formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WriteDomains writes domains to w in the named format; serial is used by zone formats
+// (rpz) and ignored otherwise
+func WriteDomains(w io.Writer, format string, domains []string, serial uint32) error {
+	f, ok := Formats[format]
+	if !ok {
+		return fmt.Errorf("unknown format %q (use %s)", format, strings.Join(FormatNames(), ", "))
+	}
+
+	writer := bufio.NewWriterSize(w, 256*1024)
+	if f.Header != nil {
+		for _, line := range f.Header(serial) {
+			fmt.Fprintln(writer, line)
+		}
+	}
+	for _, domain := range domains {
+		fmt.Fprintln(writer, f.Line(domain))
+	}
+	return writer.Flush()
+}
+
+// Between returns the text of line between prefix and the next suffix
+func Between(line, prefix, suffix string) (string, bool) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(line), prefix)
+	if !ok {
+		return "", false
+	}
+	value, _, ok := strings.Cut(rest, suffix)
+	return value, ok && value != ""
+}
+
+func dnsmasqLine(domain string) string {
+	return "address=/" + domain + "/0.0.0.0"
+}
+
+func rpzLine(domain string) string {
+	return domain + " CNAME .\n*." + domain + " CNAME ."
+}
+
+func adguardLine(domain string) string {
+	return "||" + domain + "^"
+}
+
+// adguardHeader names the list and tells AdGuard to refresh it daily
+func adguardHeader(uint32) []string {
+	return []string{"! Title: Magpie blocklist", "! Expires: 1 day", "!"}
+}
+
+// unboundLine renders one domain as a redirect zone whose apex answers with the null
+// addresses; redirect hands the same answer to every subdomain
+func unboundLine(domain string) string {
+	return `  local-zone: "` + domain + `." redirect` + "\n" +
+		`  local-data: "` + domain + `. A 0.0.0.0"` + "\n" +
+		`  local-data: "` + domain + `. AAAA ::"`
+}
+
+// parseUnboundLine returns the zone of a local-zone line; local-data lines, server:,
+// include: and comments are skipped. Zones written before the trailing dot are read too.
+func parseUnboundLine(line string) (string, bool) {
+	zone, ok := Between(line, `local-zone: "`, `"`)
+	if !ok {
+		return "", false
+	}
+	zone = strings.TrimSuffix(zone, ".")
+	return zone, zone != ""
+}
+
+// rpzHeader starts a Response Policy Zone with its SOA and NS records
+func rpzHeader(serial uint32) []string {
+	return []string{
+		"$TTL 300",
+		fmt.Sprintf("@ IN SOA localhost. hostmaster.localhost. ( %d 3600 600 604800 300 )", serial),
+		"@ IN NS localhost.",
+		"",
+	}
+}
+
+// parseRPZLine returns the owner of a "domain CNAME ." record; the *.domain twin, the
+// SOA / NS header and comments are skipped
+func parseRPZLine(line string) (string, bool) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 || fields[1] != "CNAME" || strings.HasPrefix(fields[0], "*.") {
+		return "", false
+	}
+	return fields[0], true
+}
@@ -0,0 +1,473 @@
+// Package magpie aggregates domain blocklists: it fetches every source, deduplicates the
+// domains, optionally validates them over DNS, HTTP and MX, and renders the survivors in
+// one of the output formats. It is the pipeline behind the magpie command, for programs
+// that want to embed it rather than run the binary.
+//
+//	result, err := magpie.Aggregate(ctx, magpie.Config{
+//		Sources: []string{"https://example.org/hosts.txt", "local.txt"},
+//		DNS:     true,
+//		Output:  "blocklist.txt",
+//	})
+package magpie
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/pigeonsec/magpie/internal/fetcher"
+	"github.com/pigeonsec/magpie/internal/stats"
+	"github.com/pigeonsec/magpie/internal/validator"
+)
+
+// DefaultResolvers are the public resolvers used when Config.Resolvers is empty
+var DefaultResolvers = []string{"1.1.1.1:53", "1.0.0.1:53", "8.8.8.8:53", "8.8.4.4:53", "9.9.9.9:53", "149.112.112.112:53"}
+
+// ErrNoDomains is returned by Aggregate when no source yielded a domain
+var ErrNoDomains = errors.New("no domains found from any source")
+
+// Config configures one Aggregate run. The zero value of each field picks the same
+// default as the corresponding magpie flag, except that validation is off unless DNS,
+// HTTP or MX is set.
+type Config struct {
+	// Sources are the blocklist URLs to fetch; local files (file:// or a plain path) are read directly
+	Sources []string
+	// Priority fetches the sources with a higher value first, the others in Sources order
+	Priority map[string]int
+	// FetchWorkers is the number of sources fetched in parallel (default 5)
+	FetchWorkers int
+	// FetchAdaptive halves the parallel fetches while many of them fail and adds them back
+	// as fetches succeed again, starting at FetchWorkers and kept within FetchWorkersMin
+	// (default 1) and FetchWorkersMax (default FetchWorkers)
+	FetchAdaptive   bool
+	FetchWorkersMin int
+	FetchWorkersMax int
+	// ParseWorkers, when set, parses the downloads on a pool of its own instead of in the
+	// fetch workers
+	ParseWorkers int
+	// FetchTimeout bounds each download (default 30s)
+	FetchTimeout time.Duration
+	// MaxSize caps each download in bytes (default fetcher.DefaultMaxSize, negative = unlimited)
+	MaxSize int64
+	// UserAgent replaces the default User-Agent of fetches
+	UserAgent string
+	// Header is added to every fetch request
+	Header http.Header
+	// Proxy replaces the proxy taken from the environment, for fetches only
+	Proxy func(*http.Request) (*url.URL, error)
+	// PerHostLimit and PerHostRate bound the concurrent requests and requests per second
+	// to one hostname (0 = unlimited)
+	PerHostLimit int
+	PerHostRate  float64
+	// RetryFailed gives the sources that failed one more pass, RetryFailedDelay after the
+	// others are done
+	RetryFailed      bool
+	RetryFailedDelay time.Duration
+
+	// Tracker records every source's health; Cache makes fetches conditional on the last
+	// ETag / Last-Modified and is saved by the caller; MinInterval reuses the cached copy
+	// of sources the Tracker saw fetched within it. Master holds domains that count as
+	// duplicates. These are set by the magpie command from its -data-dir.
+	Tracker     *stats.Tracker
+	Cache       *fetcher.FetchCache
+	MinInterval time.Duration
+	Master      *stats.BloomFilter
+	// GroupBySource fills in Result.Attribution
+	GroupBySource bool
+
+	// DNS keeps only domains with A, AAAA or CNAME records
+	DNS bool
+	// HTTP also requires an answer over HTTP or HTTPS; it implies the DNS check
+	HTTP bool
+	// MX requires MX records, alone or on top of the other checks
+	MX bool
+	// Workers is the number of domains validated in parallel, and the BatchWorkers of a
+	// Validator built from Resolvers (default 100)
+	Workers int
+	// Resolvers are the DNS servers (host:port) used for validation (default DefaultResolvers)
+	Resolvers []string
+	// NoCache disables the in-memory DNS result cache
+	NoCache bool
+	// Validator, when set, replaces the one built from Resolvers and NoCache, as the
+	// magpie command does to apply its resolver flags and persisted cache
+	Validator *validator.Validator
+	// SecondPass rechecks domains whose DNS lookup timed out or hit SERVFAIL once more
+	// before dropping them
+	SecondPass bool
+	// HTTPTargeted only HTTP-checks domains under uncommon TLDs plus HTTPRiskSample
+	// percent of the others, and trusts DNS for the rest
+	HTTPTargeted   bool
+	HTTPRiskSample float64
+	// HTTPDeadline is the time budget for HTTP checks, from the first one; afterwards
+	// DNS-valid domains are accepted, or rejected with HTTPDeadlineReject
+	HTTPDeadline       time.Duration
+	HTTPDeadlineReject bool
+	// Verdicts answers the DNS check of domains validated in earlier runs
+	Verdicts *stats.DomainCache
+	// Ramp starts the validation workers in staggered waves over this period
+	Ramp time.Duration
+	// Overlap validates domains as the sources are fetched instead of after the fetch
+	Overlap bool
+	// RecordInvalid fills in Result.InvalidDomains
+	RecordInvalid bool
+	// Debug receives the validation trace of every failed domain, or of 1 in DebugSample
+	// of them
+	Debug       io.Writer
+	DebugSample int
+
+	// Sort is one of SortOrders (default alpha)
+	Sort string
+	// Format is one of Formats (default plain)
+	Format string
+	// Output is the file the domains are written to; empty leaves writing to the caller
+	// (see WriteDomains)
+	Output string
+
+	// Log receives the progress lines of a run: event names the key events (for
+	// structured logs) and is empty for the others, text is the line and fields the
+	// event's attributes. Without it the run is silent.
+	Log func(event, text string, fields ...any)
+	// OnSource is called after each source was fetched and parsed. It may be called from
+	// several goroutines, as may OnSourceFailed, Keep and OnProgress.
+	OnSource func(SourceProgress)
+	// OnSourceFailed is called when a source has finally failed
+	OnSourceFailed func(*SourceError)
+	// OnFetched is called once the fetch is done, before validation
+	OnFetched func(*Result)
+	// Filter may drop domains from the fetched set before validation. With Overlap the
+	// validation is already running, so Skip has to keep them out of it too.
+	Filter func(domains map[string]struct{})
+	// Skip keeps a domain out of an Overlap validation
+	Skip func(domain string) bool
+	// Keep is handed every valid domain; returning false leaves it out of Result.Domains,
+	// for callers that write them out as they come
+	Keep func(domain string) bool
+	// OnValidationStart is called as validation begins, with the number of domains or 0
+	// with Overlap; OnValidationTotal then gives the number once the fetch is done
+	OnValidationStart func(total int)
+	OnValidationTotal func(total int)
+	// OnProgress is called as domains are validated
+	OnProgress func(ValidationProgress)
+	// OnSecondPass is called before the domains of the SecondPass are rechecked
+	OnSecondPass func(domains int)
+}
+
+// SourceProgress reports one fetched source
+type SourceProgress struct {
+	WorkerID int
+	URL      string
+	// Domains counts the source's domains, Fetched the sources fetched so far and Unique
+	// the unique domains so far, the source's included
+	Domains, Fetched, Unique int
+}
+
+// ValidationProgress reports the validation so far; Total is 0 while an Overlap fetch
+// is still running
+type ValidationProgress struct {
+	Checked, Total, Valid, Invalid int
+}
+
+// SourceError is a source that could not be fetched
+type SourceError struct {
+	URL string
+	// Err is the underlying fetch error
+	Err error
+
+	// msg is the message for the user, saying how the fetch failed
+	msg string
+}
+
+func (e *SourceError) Error() string {
+	if e.msg != "" {
+		return e.msg
+	}
+	return fmt.Sprintf("%s: %v", e.URL, e.Err)
+}
+
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+// Attribution remembers which source each domain came from: Source maps a domain to the
+// index in URLs of the first source listing it
+type Attribution struct {
+	URLs   []string
+	Source map[string]int
+}
+
+// InvalidDomain is a domain dropped by validation, with the reason
+type InvalidDomain struct {
+	Domain  string            `json:"domain"`
+	Outcome validator.Outcome `json:"outcome"`
+}
+
+// Result is the outcome of an Aggregate run
+type Result struct {
+	// Domains are the unique domains that passed validation, in Config.Sort order
+	Domains []string
+	// Unique is the fetched domain set, after Config.Filter
+	Unique map[string]struct{}
+	// Subdomains holds the domains some source listed as a leading-dot entry
+	// (".example.com"), meant to block all their subdomains too
+	Subdomains map[string]struct{}
+	// Found counts the unique domains fetched, before Config.Filter and validation
+	Found int
+	// Duplicates counts domains listed more than once across the sources, or already in
+	// Config.Master (InMaster of them)
+	Duplicates int
+	InMaster   int
+	// Fetched counts the sources fetched, Unchanged those answered with 304 Not Modified
+	// and Reused those served from the cache without a request (see Config.MinInterval)
+	Fetched   int
+	Unchanged int
+	Reused    int
+	// Failures lists the sources that could not be fetched, in source order; the run
+	// carries on without them
+	Failures []*SourceError
+	// SourceDomains counts the domains each source contributed, duplicates included
+	SourceDomains map[string]int
+	// Attribution is only filled in with Config.GroupBySource
+	Attribution *Attribution
+
+	// Valid and Invalid count the validated domains; with validation off every domain is valid
+	Valid   int
+	Invalid int
+	// HTTPChecked counts domains that got an HTTP check, DNSTrusted the DNS-valid ones
+	// accepted without one (Config.HTTPTargeted) and HTTPDeadlineSkipped those whose
+	// check Config.HTTPDeadline skipped
+	HTTPChecked         int
+	DNSTrusted          int
+	HTTPDeadlineSkipped int
+	// DeadTLDSkipped counts domains rejected by the dead TLD list without a lookup
+	DeadTLDSkipped int
+	// WildcardTLDs lists the TLDs found to wildcard-resolve; WildcardChecked counts the
+	// DNS-valid domains under them that were HTTP-checked instead
+	WildcardTLDs    []string
+	WildcardChecked int
+	// WildcardSubdomains counts subdomains dropped because only their parent's wildcard answered
+	WildcardSubdomains int
+	// NoMX counts domains dropped by Config.MX
+	NoMX int
+	// DNSOnlyAlive counts domains that resolve but failed the HTTP check
+	DNSOnlyAlive int
+	// SecondPassChecked counts the domains of the Config.SecondPass, SecondPassRescued
+	// those that turned out valid
+	SecondPassChecked int
+	SecondPassRescued int
+	// InvalidDomains lists every dropped domain with Config.RecordInvalid
+	InvalidDomains []InvalidDomain
+
+	FetchDuration      time.Duration
+	ValidationDuration time.Duration
+}
+
+// Aggregate runs the pipeline: fetch Config.Sources, deduplicate, validate and, with
+// Config.Output, write the result. Sources that fail are reported in Result.Failures
+// rather than as an error; the error is for bad configuration, no domains found
+// (ErrNoDomains), write failures and the cancellation of ctx. A cancelled run returns
+// ctx's error with what it gathered: Result.Domains holds the domains validated so far,
+// nil if validation hadn't started.
+func Aggregate(ctx context.Context, cfg Config) (*Result, error) {
+	if err := cfg.setDefaults(); err != nil {
+		return nil, err
+	}
+	if len(cfg.Sources) == 0 {
+		return nil, errors.New("no sources")
+	}
+
+	// With Overlap the validation starts now, fed each new domain by the fetch
+	result := &Result{}
+	var (
+		check      *validation
+		overlapped chan []string
+		feed       *domainFeed
+	)
+	if cfg.Overlap && cfg.validating() {
+		check = newValidation(&cfg)
+		feed = newDomainFeed(cfg.Workers)
+		overlapped = make(chan []string, 1)
+		start := time.Now()
+		go func() {
+			valid := check.run(ctx, feed)
+			result.ValidationDuration = time.Since(start)
+			overlapped <- valid
+		}()
+	}
+
+	fetchSources(ctx, &cfg, result, feed)
+	if feed != nil {
+		feed.close()
+		if cfg.OnValidationTotal != nil && ctx.Err() == nil {
+			cfg.OnValidationTotal(feed.total())
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		if feed != nil {
+			result.Domains = <-overlapped
+			check.report(result)
+		}
+		return result, err
+	}
+
+	if cfg.OnFetched != nil {
+		cfg.OnFetched(result)
+	}
+	if result.Found == 0 && result.InMaster == 0 {
+		if feed != nil {
+			<-overlapped
+		}
+		if n := len(result.Failures); n > 0 && n == len(cfg.Sources) {
+			return result, fmt.Errorf("%w: all %d sources failed, first: %w", ErrNoDomains, n, result.Failures[0])
+		}
+		return result, ErrNoDomains
+	}
+	if cfg.Filter != nil {
+		cfg.Filter(result.Unique)
+	}
+
+	switch {
+	case feed != nil:
+		// Running since the fetch began; Skip kept out what Filter just removed
+		result.Domains = <-overlapped
+		check.report(result)
+	case cfg.validating():
+		check = newValidation(&cfg)
+		start := time.Now()
+		result.Domains = check.run(ctx, feedDomains(ctx, result.Unique, cfg.Workers))
+		result.ValidationDuration = time.Since(start)
+		check.report(result)
+	default:
+		result.Domains = make([]string, 0, len(result.Unique))
+		for domain := range result.Unique {
+			if cfg.keep(domain) {
+				result.Domains = append(result.Domains, domain)
+			}
+		}
+		result.Valid = len(result.Unique)
+	}
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+
+	SortDomains(result.Domains, cfg.Sort)
+	if cfg.Output != "" {
+		if err := writeFile(cfg.Output, cfg.Format, result.Domains); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// Validate runs the validation stage of Aggregate on a list of domains the caller already
+// has, with the validation fields of cfg. The valid domains are left in the order they
+// finished.
+func Validate(ctx context.Context, cfg Config, domains []string) (*Result, error) {
+	if err := cfg.setDefaults(); err != nil {
+		return nil, err
+	}
+
+	feed := newDomainFeed(cfg.Workers)
+	feed.size.Store(int64(len(domains)))
+	go func() {
+		for _, domain := range domains {
+			if ctx.Err() != nil {
+				break
+			}
+			feed.send(domain)
+		}
+		feed.close()
+	}()
+
+	result := &Result{Found: len(domains)}
+	check := newValidation(&cfg)
+	start := time.Now()
+	result.Domains = check.run(ctx, feed)
+	result.ValidationDuration = time.Since(start)
+	check.report(result)
+	return result, ctx.Err()
+}
+
+// setDefaults fills in the zero fields and rejects unknown names
+func (cfg *Config) setDefaults() error {
+	if cfg.FetchWorkers <= 0 {
+		cfg.FetchWorkers = 5
+	}
+	if cfg.FetchTimeout <= 0 {
+		cfg.FetchTimeout = 30 * time.Second
+	}
+	if cfg.FetchWorkersMin <= 0 {
+		cfg.FetchWorkersMin = 1
+	}
+	if cfg.FetchWorkersMax <= 0 {
+		cfg.FetchWorkersMax = cfg.FetchWorkers
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 100
+	}
+	if len(cfg.Resolvers) == 0 {
+		cfg.Resolvers = DefaultResolvers
+	}
+	if cfg.Sort == "" {
+		cfg.Sort = "alpha"
+	}
+	if cfg.Format == "" {
+		cfg.Format = "plain"
+	}
+	if !slices.Contains(SortOrders, cfg.Sort) {
+		return fmt.Errorf("unknown sort order %q", cfg.Sort)
+	}
+	if _, ok := Formats[cfg.Format]; !ok {
+		return fmt.Errorf("unknown format %q", cfg.Format)
+	}
+	return nil
+}
+
+// validating reports whether any check is enabled
+func (cfg *Config) validating() bool {
+	return cfg.DNS || cfg.HTTP || cfg.MX
+}
+
+// log passes a line to Config.Log, if set
+func (cfg *Config) log(event, text string, fields ...any) {
+	if cfg.Log != nil {
+		cfg.Log(event, text, fields...)
+	}
+}
+
+// logf passes a plain line to Config.Log, if set
+func (cfg *Config) logf(format string, args ...any) {
+	if cfg.Log != nil {
+		cfg.Log("", fmt.Sprintf(format, args...))
+	}
+}
+
+// keep hands a valid domain to Config.Keep, reporting whether it goes in Result.Domains
+func (cfg *Config) keep(domain string) bool {
+	return cfg.Keep == nil || cfg.Keep(domain)
+}
+
+// writeFile writes the domains to path in format, replacing it atomically. Zone formats
+// get a serial from the current time.
+func writeFile(path, format string, domains []string) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := WriteDomains(file, format, domains, uint32(time.Now().Unix())); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,34 @@
+package magpie
+
+import (
+	"context"
+	"time"
+)
+
+// rampWaves is how many staggered waves Config.Ramp starts the validation workers in
+const rampWaves = 10
+
+// rampDelay returns how long worker i of n waits before starting over a ramp. Workers
+// start in rampWaves evenly spaced waves, so all n are running once the ramp is over.
+func rampDelay(ramp time.Duration, i, n int) time.Duration {
+	if ramp <= 0 || n <= 1 {
+		return 0
+	}
+	wave := i * rampWaves / n
+	return ramp * time.Duration(wave) / rampWaves
+}
+
+// waitRamp holds worker i of n back for its ramp delay, or until ctx is done
+func waitRamp(ctx context.Context, ramp time.Duration, i, n int) {
+	delay := rampDelay(ramp, i, n)
+	if delay <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
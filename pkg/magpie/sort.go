@@ -0,0 +1,60 @@
+package magpie
+
+import (
+	"slices"
+	"strings"
+)
+
+// SortOrders are the accepted Config.Sort (and -sort) values
+var SortOrders = []string{"alpha", "tld", "none"}
+
+// SortDomains orders domains in place per order: alpha sorts lexically, tld by reversed
+// labels (so siblings like a.example.com and b.example.com end up together) and none
+// leaves them as they are.
+func SortDomains(domains []string, order string) {
+	switch order {
+	case "alpha":
+		slices.Sort(domains)
+	case "tld":
+		slices.SortFunc(domains, CompareReversedLabels)
+	}
+}
+
+// DomainCompare returns the comparison behind order; none compares lexically, for the
+// places that need some order (such as -append)
+func DomainCompare(order string) func(a, b string) int {
+	if order == "tld" {
+		return CompareReversedLabels
+	}
+	return strings.Compare
+}
+
+// CompareReversedLabels compares two domains label by label from the TLD down, so
+// "example.com" < "a.example.com" < "example.net". It doesn't allocate.
+func CompareReversedLabels(a, b string) int {
+	for a != "" && b != "" {
+		var la, lb string
+		if i := strings.LastIndexByte(a, '.'); i >= 0 {
+			la, a = a[i+1:], a[:i]
+		} else {
+			la, a = a, ""
+		}
+		if i := strings.LastIndexByte(b, '.'); i >= 0 {
+			lb, b = b[i+1:], b[:i]
+		} else {
+			lb, b = b, ""
+		}
+		if c := strings.Compare(la, lb); c != 0 {
+			return c
+		}
+	}
+	// The domain with labels left is the longer, more specific one
+	switch {
+	case a == "" && b == "":
+		return 0
+	case a == "":
+		return -1
+	default:
+		return 1
+	}
+}
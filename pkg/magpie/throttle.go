@@ -0,0 +1,122 @@
+package magpie
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/pigeonsec/magpie/internal/fetcher"
+)
+
+const (
+	// throttleWindow is how many recent fetches the failure rate is taken over
+	throttleWindow = 10
+	// throttleMinSamples is how many fetches the window needs before backing off
+	throttleMinSamples = 4
+	// throttleBackoffRate halves the fetchers when at least this share of the window failed
+	throttleBackoffRate = 0.5
+	// throttleRecoverRate adds a fetcher back after a full window at or below this share
+	throttleRecoverRate = 0.1
+)
+
+// fetchThrottle is the Config.FetchAdaptive gate in front of the fetch workers. The pool has
+// max workers but only limit of them fetch at once: the limit halves when the rolling
+// failure rate climbs (a degrading connection only gets worse with every worker and
+// retry thrown at it) and grows by one per clean window once fetches succeed again.
+//
+// Only failures that may be the network's count; a source answering 404 or 410 is gone
+// whatever the concurrency. A worker waiting in netutil.CheckConnectionWithRetry holds
+// its slot, so once the limit is down only that many probe a lost connection, and a
+// fetch that succeeded after the connection came back counts as a success.
+type fetchThrottle struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	min, max int
+	limit    int
+	active   int
+	cfg      *Config
+
+	// outcomes holds the recent fetches since the last change, true for a failure
+	outcomes []bool
+}
+
+// newFetchThrottle starts a throttle at cfg.FetchWorkers fetchers, kept within
+// [cfg.FetchWorkersMin, cfg.FetchWorkersMax]
+func newFetchThrottle(cfg *Config) *fetchThrottle {
+	lo, hi := cfg.FetchWorkersMin, cfg.FetchWorkersMax
+	t := &fetchThrottle{min: lo, max: hi, limit: max(lo, min(cfg.FetchWorkers, hi)), cfg: cfg}
+	t.cond = sync.NewCond(&t.mu)
+	return t
+}
+
+// acquire waits for a free fetch slot. It returns false once ctx is done.
+func (t *fetchThrottle) acquire(ctx context.Context) bool {
+	// A cancelled run wakes every waiting worker so it can drain its URLs
+	stop := context.AfterFunc(ctx, func() {
+		t.mu.Lock()
+		t.cond.Broadcast()
+		t.mu.Unlock()
+	})
+	defer stop()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for t.active >= t.limit && ctx.Err() == nil {
+		t.cond.Wait()
+	}
+	if ctx.Err() != nil {
+		return false
+	}
+	t.active++
+	return true
+}
+
+// release frees the slot of a finished fetch and adapts the limit to its outcome, err
+// being the underlying fetch error (nil on success). Fetches cut short by an interrupt
+// are left out.
+func (t *fetchThrottle) release(ctx context.Context, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.active--
+	defer t.cond.Broadcast()
+
+	if ctx.Err() != nil {
+		return
+	}
+	t.outcomes = append(t.outcomes, err != nil && !fetcher.IsPermanent(err))
+	if len(t.outcomes) > throttleWindow {
+		t.outcomes = t.outcomes[1:]
+	}
+
+	failures := 0
+	for _, failed := range t.outcomes {
+		if failed {
+			failures++
+		}
+	}
+	rate := float64(failures) / float64(len(t.outcomes))
+
+	switch {
+	case len(t.outcomes) >= throttleMinSamples && rate >= throttleBackoffRate && t.limit > t.min:
+		t.setLimit(max(t.limit/2, t.min), rate)
+	case len(t.outcomes) == throttleWindow && rate <= throttleRecoverRate && t.limit < t.max:
+		t.setLimit(t.limit+1, rate)
+	}
+}
+
+// setLimit changes the number of concurrent fetches and starts a new window, so the next
+// change is judged on fetches made at the new limit. The caller holds mu.
+func (t *fetchThrottle) setLimit(limit int, rate float64) {
+	direction := "down"
+	if limit > t.limit {
+		direction = "up"
+	}
+	noun := "fetchers"
+	if limit == 1 {
+		noun = "fetcher"
+	}
+	t.limit = limit
+	t.outcomes = t.outcomes[:0]
+	t.cfg.log("fetch throttle", fmt.Sprintf("Fetch failures at %.0f%% of the last fetches, %s to %d parallel %s", rate*100, direction, limit, noun),
+		"fetchers", limit, "failure_rate", rate)
+}
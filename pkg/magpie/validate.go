@@ -0,0 +1,468 @@
+package magpie
+
+import (
+	"context"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pigeonsec/magpie/internal/validator"
+)
+
+// validation is the validation stage of one run: the checks Config enables, run by
+// Config.Workers workers, and the counts of how domains were validated across them
+type validation struct {
+	cfg   *Config
+	v     *validator.Validator
+	debug *debugLog // nil without Config.Debug
+
+	valid   atomic.Int64
+	invalid atomic.Int64
+
+	httpChecked atomic.Int64 // domains that received an HTTP check
+	dnsTrusted  atomic.Int64 // DNS-valid domains accepted without HTTP in targeted mode
+	deadTLD     atomic.Int64 // domains rejected by the known-dead TLD short-circuit
+	wildcard    atomic.Int64 // DNS-valid domains under wildcard TLDs that needed an HTTP check
+	wildcardSub atomic.Int64 // subdomains dropped because only their parent's wildcard answered
+	noMX        atomic.Int64 // domains dropped for having no MX records
+	httpSkipped atomic.Int64 // DNS-valid domains whose HTTP check was skipped by HTTPDeadline
+
+	dnsOnlyAlive atomic.Int64 // domains that resolve but failed the HTTP check
+
+	// invalidDomains collects the outcome of every dropped domain with RecordInvalid
+	invalidMu      sync.Mutex
+	invalidDomains []InvalidDomain
+
+	// httpDeadlineAt is set by the first HTTP check when HTTPDeadline is used
+	httpStart      sync.Once
+	httpDeadlineAt time.Time
+
+	// inconclusive collects domains whose DNS lookup timed out or hit SERVFAIL,
+	// for the SecondPass recheck
+	inconclusiveMu sync.Mutex
+	inconclusive   []string
+	rescued        int // inconclusive domains that passed on the second pass
+}
+
+// newValidation sets up the validation stage of cfg, with its Validator or one built
+// from Resolvers
+func newValidation(cfg *Config) *validation {
+	check := &validation{cfg: cfg, v: cfg.Validator}
+	if check.v == nil {
+		check.v = validator.NewValidatorWithResolvers(!cfg.NoCache, cfg.Resolvers)
+		check.v.BatchWorkers = cfg.Workers
+	}
+	if cfg.Debug != nil {
+		check.debug = newDebugLog(cfg.Debug, cfg.DebugSample)
+	}
+	return check
+}
+
+// lookup is a domain on its way to the validation workers, with its DNS result when
+// ValidateStream already resolved it
+type lookup struct {
+	domain  string
+	batched bool
+	valid   bool
+	class   validator.DNSErrorClass
+}
+
+// run validates the domains of feed with Workers workers, then gives the inconclusive
+// ones their SecondPass, and returns the valid domains Config.Keep let through. After an
+// interrupt the rest of the feed is only drained.
+func (c *validation) run(ctx context.Context, feed *domainFeed) []string {
+	cfg := c.cfg
+	var (
+		wg           sync.WaitGroup
+		validMu      sync.Mutex
+		validDomains []string
+		total        = feed.total() // 0 while an overlapping fetch is running
+		processed    atomic.Int64
+	)
+	if cfg.OnValidationStart != nil {
+		cfg.OnValidationStart(total)
+	}
+
+	// Pre-allocate with estimated capacity (assume ~80% valid)
+	validDomains = make([]string, 0, total*4/5)
+	lookups := c.lookups(ctx, feed)
+
+	for i := 0; i < cfg.Workers; i++ {
+		wg.Add(1)
+		go func(workerID int) {
+			defer wg.Done()
+			waitRamp(ctx, cfg.Ramp, workerID, cfg.Workers)
+			localValid := make([]string, 0, total/cfg.Workers)
+
+			for item := range lookups {
+				// After an interrupt the remaining domains are only drained
+				if ctx.Err() != nil {
+					continue
+				}
+				domain := item.domain
+				var (
+					valid bool
+					err   error
+				)
+				if item.batched {
+					valid, err = c.afterLookup(ctx, domain, item.valid, item.class)
+				} else {
+					valid, err = c.validateDomain(ctx, domain)
+				}
+				// A check cut short by the interrupt has no verdict
+				if ctx.Err() != nil {
+					continue
+				}
+
+				if err == nil && valid {
+					if cfg.keep(domain) {
+						localValid = append(localValid, domain)
+					}
+					c.valid.Add(1)
+				} else {
+					c.invalid.Add(1)
+				}
+
+				current := processed.Add(1)
+				if cfg.OnProgress != nil {
+					cfg.OnProgress(ValidationProgress{
+						Checked: int(current),
+						Total:   feed.total(),
+						Valid:   int(c.valid.Load()),
+						Invalid: int(c.invalid.Load()),
+					})
+				}
+			}
+
+			validMu.Lock()
+			validDomains = append(validDomains, localValid...)
+			validMu.Unlock()
+		}(i)
+	}
+
+	wg.Wait()
+
+	if len(c.inconclusive) > 0 && ctx.Err() == nil {
+		if cfg.OnSecondPass != nil {
+			cfg.OnSecondPass(len(c.inconclusive))
+		}
+		rescued := c.recheckInconclusive(ctx)
+		for _, domain := range rescued {
+			if cfg.keep(domain) {
+				validDomains = append(validDomains, domain)
+			}
+		}
+		c.valid.Add(int64(len(rescued)))
+		c.invalid.Add(-int64(len(rescued)))
+		c.rescued = len(rescued)
+	}
+	return validDomains
+}
+
+// lookups hands the domains of feed to the validation workers. With DNS or HTTP checks
+// and no Ramp, the DNS lookups run ahead on a Validator.ValidateStream, whose workers
+// keep one connection per resolver open for the whole run; the workers then take each
+// domain on from its DNS result. Dead TLDs, fresh Verdicts and traced domains skip it.
+func (c *validation) lookups(ctx context.Context, feed *domainFeed) <-chan lookup {
+	cfg := c.cfg
+	out := make(chan lookup, cfg.Workers*2)
+	// A ramp staggers the lookups themselves, which the stream would undo
+	if cfg.Ramp > 0 || !(cfg.DNS || cfg.HTTP) {
+		go func() {
+			for domain := range feed.domains {
+				out <- lookup{domain: domain}
+			}
+			close(out)
+		}()
+		return out
+	}
+
+	var wg sync.WaitGroup
+	stream := make(chan string, cfg.Workers*2)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for domain := range feed.domains {
+			if c.streamed(ctx, domain) {
+				stream <- domain
+			} else {
+				out <- lookup{domain: domain}
+			}
+		}
+		close(stream)
+	}()
+	go func() {
+		defer wg.Done()
+		for result := range c.v.ValidateStream(ctx, stream) {
+			out <- lookup{domain: result.Domain, batched: true, valid: result.Valid, class: result.Class}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+// streamed reports whether a domain's DNS lookup goes through the ValidateStream of
+// lookups, or whether the worker checks it from scratch
+func (c *validation) streamed(ctx context.Context, domain string) bool {
+	if ctx.Err() != nil || c.v.IsDeadTLD(domain) || (c.debug != nil && c.debug.sampled(domain)) {
+		return false
+	}
+	if c.cfg.Verdicts != nil {
+		if _, ok := c.cfg.Verdicts.Lookup(domain, time.Now()); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// report copies the counts of a finished run into result
+func (c *validation) report(result *Result) {
+	result.Valid = int(c.valid.Load())
+	result.Invalid = int(c.invalid.Load())
+	result.HTTPChecked = int(c.httpChecked.Load())
+	result.DNSTrusted = int(c.dnsTrusted.Load())
+	result.DeadTLDSkipped = int(c.deadTLD.Load())
+	result.WildcardChecked = int(c.wildcard.Load())
+	result.WildcardTLDs = c.v.WildcardTLDs()
+	result.WildcardSubdomains = int(c.wildcardSub.Load())
+	result.NoMX = int(c.noMX.Load())
+	result.HTTPDeadlineSkipped = int(c.httpSkipped.Load())
+	result.DNSOnlyAlive = int(c.dnsOnlyAlive.Load())
+	result.SecondPassChecked = len(c.inconclusive)
+	result.SecondPassRescued = c.rescued
+	result.InvalidDomains = c.invalidDomains
+}
+
+// recordInvalid notes why a domain was dropped
+func (c *validation) recordInvalid(domain string, outcome validator.Outcome) {
+	if outcome == validator.OutcomeDNSOnlyAlive {
+		c.dnsOnlyAlive.Add(1)
+	}
+	if !c.cfg.RecordInvalid {
+		return
+	}
+	c.invalidMu.Lock()
+	c.invalidDomains = append(c.invalidDomains, InvalidDomain{Domain: domain, Outcome: outcome})
+	c.invalidMu.Unlock()
+}
+
+// validateDomain runs the configured validation for a single domain, traced for Config.Debug
+func (c *validation) validateDomain(ctx context.Context, domain string) (bool, error) {
+	if c.debug != nil && c.debug.sampled(domain) {
+		return c.debug.trace(ctx, domain, func(ctx context.Context) (bool, error) {
+			return c.checkDomain(ctx, domain)
+		})
+	}
+	return c.checkDomain(ctx, domain)
+}
+
+// checkDomain runs the checks of validateDomain.
+// In targeted HTTP mode every domain gets DNS, and only risky ones get the extra HTTP check.
+func (c *validation) checkDomain(ctx context.Context, domain string) (bool, error) {
+	cfg, v := c.cfg, c.v
+	if v.IsDeadTLD(domain) {
+		debugNote(ctx, "tld .%s is on the dead TLD list, no lookup needed", domain[strings.LastIndex(domain, ".")+1:])
+		c.deadTLD.Add(1)
+		c.recordInvalid(domain, validator.OutcomeDead)
+		return false, nil
+	}
+
+	if !cfg.DNS && !cfg.HTTP {
+		// With MX alone the MX lookup replaces the address check
+		if !cfg.MX {
+			return false, nil
+		}
+		return c.requireMX(ctx, domain), nil
+	}
+
+	// A verdict from an earlier run stands in for the lookup while it is fresh
+	if cfg.Verdicts != nil {
+		if valid, ok := cfg.Verdicts.Lookup(domain, time.Now()); ok {
+			if !valid {
+				debugNote(ctx, "dns %s: invalid verdict from an earlier run (-domain-cache-ttl)", domain)
+				c.recordInvalid(domain, validator.OutcomeDead)
+				return false, nil
+			}
+			return c.validateAfterDNS(ctx, domain)
+		}
+	}
+
+	// DNS must pass first, even with HTTP (it's faster)
+	valid, class := v.ValidateDNSResult(ctx, domain)
+	return c.afterLookup(ctx, domain, valid, class)
+}
+
+// afterLookup takes a domain on from its DNS result: an inconclusive one is held for the
+// SecondPass, a resolving one gets the remaining checks
+func (c *validation) afterLookup(ctx context.Context, domain string, valid bool, class validator.DNSErrorClass) (bool, error) {
+	cfg := c.cfg
+	// Timeouts and SERVFAIL say nothing about the domain, so they are never remembered
+	if cfg.Verdicts != nil && ctx.Err() == nil && (valid || !class.Inconclusive()) {
+		cfg.Verdicts.Record(domain, valid, time.Now())
+	}
+	if !valid {
+		if cfg.SecondPass && class.Inconclusive() {
+			// Its outcome is recorded after the second pass
+			debugHold(ctx)
+			c.inconclusiveMu.Lock()
+			c.inconclusive = append(c.inconclusive, domain)
+			c.inconclusiveMu.Unlock()
+		} else {
+			c.recordInvalid(domain, validator.OutcomeDead)
+		}
+		return false, nil
+	}
+
+	return c.validateAfterDNS(ctx, domain)
+}
+
+// validateAfterDNS runs the checks that follow a successful DNS lookup
+func (c *validation) validateAfterDNS(ctx context.Context, domain string) (bool, error) {
+	cfg, v := c.cfg, c.v
+	if cfg.MX && !c.requireMX(ctx, domain) {
+		return false, nil
+	}
+
+	// A parking or sinkhole wildcard answers for the subdomain whether it exists or not
+	if v.IsWildcardSubdomain(ctx, domain) {
+		c.wildcardSub.Add(1)
+		c.recordInvalid(domain, validator.OutcomeDead)
+		return false, nil
+	}
+
+	if !cfg.HTTP {
+		if !v.IsWildcardTLD(ctx, domain) {
+			return true, nil
+		}
+
+		// The TLD answers for any name, so the DNS result proves nothing
+		c.wildcard.Add(1)
+		valid, err := c.httpCheck(ctx, domain)
+		if !valid {
+			c.recordInvalid(domain, validator.OutcomeDead)
+		}
+		return valid, err
+	}
+
+	if cfg.HTTPTargeted && !needsHTTPCheck(domain, cfg.HTTPRiskSample) {
+		c.dnsTrusted.Add(1)
+		return true, nil
+	}
+
+	valid, err := c.httpCheck(ctx, domain)
+	if !valid {
+		c.recordInvalid(domain, validator.OutcomeDNSOnlyAlive)
+	}
+	return valid, err
+}
+
+// requireMX reports whether a domain has MX records, recording it as dead otherwise
+func (c *validation) requireMX(ctx context.Context, domain string) bool {
+	valid, _ := c.v.ValidateMXResult(ctx, domain)
+	if !valid {
+		c.noMX.Add(1)
+		c.recordInvalid(domain, validator.OutcomeDead)
+	}
+	return valid
+}
+
+// httpCheck HTTP-checks a DNS-valid domain within the HTTPDeadline budget. Once the
+// budget is spent, including for checks still in flight, the domain is accepted, or
+// rejected with HTTPDeadlineReject.
+func (c *validation) httpCheck(ctx context.Context, domain string) (bool, error) {
+	deadline := c.cfg.HTTPDeadline
+	if deadline <= 0 {
+		c.httpChecked.Add(1)
+		return c.v.ValidateHTTP(ctx, domain)
+	}
+
+	c.httpStart.Do(func() { c.httpDeadlineAt = time.Now().Add(deadline) })
+	if time.Now().Before(c.httpDeadlineAt) {
+		httpCtx, cancel := context.WithDeadline(ctx, c.httpDeadlineAt)
+		defer cancel()
+
+		valid, err := c.v.ValidateHTTP(httpCtx, domain)
+		if ctx.Err() != nil || httpCtx.Err() == nil {
+			c.httpChecked.Add(1)
+			return valid, err
+		}
+	}
+
+	c.httpSkipped.Add(1)
+	return !c.cfg.HTTPDeadlineReject, nil
+}
+
+// recheckInconclusive gives domains whose first lookup timed out or hit SERVFAIL a
+// second, more patient DNS attempt on another resolver, and returns the ones that
+// now pass validation. NXDOMAIN results are definitive and never reach this pass.
+func (c *validation) recheckInconclusive(ctx context.Context) []string {
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		rescued []string
+	)
+
+	domainChan := make(chan string, c.cfg.Workers*2)
+	for i := 0; i < c.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for domain := range domainChan {
+				if c.recheckDomain(ctx, domain) {
+					mu.Lock()
+					rescued = append(rescued, domain)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, domain := range c.inconclusive {
+		domainChan <- domain
+	}
+	close(domainChan)
+	wg.Wait()
+
+	return rescued
+}
+
+// recheckDomain is the second DNS attempt of recheckInconclusive for one domain, followed
+// by the remaining checks, traced for Config.Debug
+func (c *validation) recheckDomain(ctx context.Context, domain string) bool {
+	verdicts := c.cfg.Verdicts
+	check := func(ctx context.Context) bool {
+		ok, class := c.v.RecheckDNS(ctx, domain)
+		if verdicts != nil && ctx.Err() == nil && (ok || !class.Inconclusive()) {
+			verdicts.Record(domain, ok, time.Now())
+		}
+		if !ok {
+			c.recordInvalid(domain, validator.OutcomeDead)
+			return false
+		}
+		ok, err := c.validateAfterDNS(ctx, domain)
+		return err == nil && ok
+	}
+	if c.debug != nil {
+		return c.debug.recheck(ctx, domain, check)
+	}
+	return check(ctx)
+}
+
+// needsHTTPCheck flags domains under uncommon TLDs, plus a deterministic sample of
+// riskSample percent of the rest
+func needsHTTPCheck(domain string, riskSample float64) bool {
+	if !validator.IsCommonTLD(domain) {
+		return true
+	}
+	if riskSample <= 0 {
+		return false
+	}
+	h := fnv.New32a()
+	h.Write([]byte(domain))
+	return float64(h.Sum32()%10000) < riskSample*100
+}
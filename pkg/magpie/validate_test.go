@@ -0,0 +1,85 @@
+package magpie
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// startSlowResolver runs a local DNS server that answers A queries under example.com
+// after delay and NXDOMAIN for everything else, and never answers names starting with
+// "lost", and returns its address
+func startSlowResolver(tb testing.TB, delay time.Duration) string {
+	tb.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatalf("listen: %v", err)
+	}
+
+	started := make(chan struct{})
+	server := &dns.Server{
+		PacketConn:        conn,
+		NotifyStartedFunc: func() { close(started) },
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			q := r.Question[0]
+			if strings.HasPrefix(q.Name, "lost") {
+				return
+			}
+			time.Sleep(delay)
+
+			m := new(dns.Msg)
+			m.SetReply(r)
+			m.RecursionAvailable = true
+			switch {
+			case !strings.HasSuffix(q.Name, "example.com."):
+				m.Rcode = dns.RcodeNameError
+			case q.Qtype == dns.TypeA:
+				m.Answer = append(m.Answer, &dns.A{
+					Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+					A:   net.IPv4(192, 0, 2, 1),
+				})
+			}
+			w.WriteMsg(m)
+		}),
+	}
+	go server.ActivateAndServe()
+	<-started
+	tb.Cleanup(func() { server.Shutdown() })
+	return conn.LocalAddr().String()
+}
+
+// BenchmarkValidationRun validates 10000 domains against a resolver that takes 2ms per
+// answer and never answers one domain in 100, so every worker keeps hitting timeouts
+func BenchmarkValidationRun(b *testing.B) {
+	const n = 10000
+	addr := startSlowResolver(b, 2*time.Millisecond)
+	domains := make(map[string]struct{}, n)
+	for i := 0; i < n; i++ {
+		switch {
+		case i%100 == 0:
+			domains[fmt.Sprintf("lost%d.example.com", i)] = struct{}{}
+		case i%2 == 0:
+			domains[fmt.Sprintf("host%d.example.com", i)] = struct{}{}
+		default:
+			domains[fmt.Sprintf("host%d.example.org", i)] = struct{}{}
+		}
+	}
+
+	cfg := Config{DNS: true, Workers: 20, Resolvers: []string{addr}, NoCache: true}
+	if err := cfg.setDefaults(); err != nil {
+		b.Fatalf("setDefaults: %v", err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		check := newValidation(&cfg)
+		valid := check.run(context.Background(), feedDomains(context.Background(), domains, cfg.Workers))
+		if len(valid) != n/2-n/100 {
+			b.Fatalf("got %d valid domains, want %d", len(valid), n/2-n/100)
+		}
+	}
+}